@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		trust     bool
+		want      string
+	}{
+		{"no proxy", nil, true, "192.0.2.1"},
+		{"untrusted header", []string{"203.0.113.7"}, false, "192.0.2.1"},
+		{"appended by the proxy", []string{"203.0.113.7"}, true, "203.0.113.7"},
+		{"spoofed entries are ignored", []string{"10.9.9.9, 203.0.113.7"}, true, "203.0.113.7"},
+		{"spoofed header line is ignored", []string{"10.9.9.9", "203.0.113.7"}, true, "203.0.113.7"},
+		{"empty entry", []string{"10.9.9.9, "}, true, "192.0.2.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/chat", nil)
+			r.RemoteAddr = "192.0.2.1:4321"
+			for _, value := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := requestIP(r, test.trust); got != test.want {
+				t.Errorf("requestIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"same origin", "https://zephyr.example", nil, true},
+		{"same origin with the port", "http://zephyr.example:8000", nil, false},
+		{"cross origin by default", "https://evil.example", nil, false},
+		{"listed", "https://app.example", []string{"https://other.example", "https://app.example"}, true},
+		{"not listed", "https://evil.example", []string{"https://app.example"}, false},
+		{"the list replaces same origin", "https://zephyr.example", []string{"https://app.example"}, false},
+		{"any", "https://evil.example", []string{"*"}, true},
+		{"malformed", "://", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://zephyr.example/chat", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if got := originAllowed(r, test.allowed); got != test.want {
+				t.Errorf("originAllowed = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// pkg/assistant/assistant.go
+package assistant
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats an assistant can be told to answer in.
+const (
+	FormatMarkdown = "markdown"
+	FormatPlain    = "plain"
+)
+
+// Assistant is a subject-specialized persona: the system prompt, model and
+// sampling parameters used for chats addressed to it.
+type Assistant struct {
+	// ID is what clients send in metadata.assistant. It defaults to the
+	// file name without its extension.
+	ID          string `yaml:"id"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Provider and Model are used when the chat does not name its own. Empty
+	// values fall back to the deployment defaults.
+	Provider     string `yaml:"provider"`
+	Model        string `yaml:"model"`
+	SystemPrompt string `yaml:"system_prompt"`
+	// Template names a prompt template rendered as the system prompt
+	// instead of SystemPrompt. TemplateVersion pins a version; 0 follows
+	// the latest. Variables are passed to the template unless the chat
+	// sets them.
+	Template        string         `yaml:"template"`
+	TemplateVersion int            `yaml:"template_version"`
+	Variables       map[string]any `yaml:"variables"`
+	Generation      Generation     `yaml:"generation"`
+	// Tools lists the tools the assistant may call.
+	Tools  []string `yaml:"tools"`
+	Output Output   `yaml:"output"`
+	// NoCache opts the assistant out of the response cache, for answers
+	// that must not be shared between students.
+	NoCache bool `yaml:"no_cache"`
+	// Keywords are matched against messages by KeywordClassifier.
+	Keywords []string `yaml:"keywords"`
+}
+
+// Generation overrides the deployment's sampling parameters. Unset fields
+// keep the configured value, so unlike the config file a temperature of 0
+// can be asked for.
+type Generation struct {
+	Temperature     *float64 `yaml:"temperature"`
+	TopK            *int     `yaml:"top_k"`
+	TopP            *float64 `yaml:"top_p"`
+	MaxOutputTokens *int     `yaml:"max_output_tokens"`
+}
+
+// Apply returns base with the overrides set in g.
+func (g Generation) Apply(base llm.GenerationConfig) llm.GenerationConfig {
+	if g.Temperature != nil {
+		base.Temperature = *g.Temperature
+	}
+	if g.TopK != nil {
+		base.TopK = *g.TopK
+	}
+	if g.TopP != nil {
+		base.TopP = *g.TopP
+	}
+	if g.MaxOutputTokens != nil {
+		base.MaxOutputTokens = *g.MaxOutputTokens
+	}
+	return base
+}
+
+// Output constrains how answers are written. The rules are appended to the
+// system prompt.
+type Output struct {
+	Format string   `yaml:"format"`
+	Rules  []string `yaml:"rules"`
+}
+
+// SystemInstruction is the system prompt followed by the output rules.
+func (a *Assistant) SystemInstruction() string {
+	return a.WithOutputRules(a.SystemPrompt)
+}
+
+// WithOutputRules appends the output rules to prompt.
+func (a *Assistant) WithOutputRules(prompt string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(prompt))
+
+	var rules []string
+	switch a.Output.Format {
+	case FormatMarkdown:
+		rules = append(rules, "Format the answer as Markdown.")
+	case FormatPlain:
+		rules = append(rules, "Answer in plain text without Markdown formatting.")
+	}
+	rules = append(rules, a.Output.Rules...)
+	if len(rules) > 0 {
+		b.WriteString("\n\nOutput rules:")
+		for _, rule := range rules {
+			b.WriteString("\n- ")
+			b.WriteString(strings.TrimSpace(rule))
+		}
+	}
+	return b.String()
+}
+
+func (a *Assistant) validate() error {
+	var problems []string
+	if strings.TrimSpace(a.SystemPrompt) == "" && a.Template == "" {
+		problems = append(problems, "system_prompt or template is required")
+	}
+	switch a.Output.Format {
+	case "", FormatMarkdown, FormatPlain:
+	default:
+		problems = append(problems, fmt.Sprintf("output.format must be %s or %s", FormatMarkdown, FormatPlain))
+	}
+	if t := a.Generation.Temperature; t != nil && (*t < 0 || *t > 2) {
+		problems = append(problems, "generation.temperature must be between 0 and 2")
+	}
+	if p := a.Generation.TopP; p != nil && (*p < 0 || *p > 1) {
+		problems = append(problems, "generation.top_p must be between 0 and 1")
+	}
+	if n := a.Generation.MaxOutputTokens; n != nil && *n <= 0 {
+		problems = append(problems, "generation.max_output_tokens must be positive")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Registry holds the assistants defined in a directory, one YAML file each,
+// and the one used for chats that do not pick an assistant.
+type Registry struct {
+	dir string
+
+	mu         sync.RWMutex
+	assistants map[string]*Assistant
+	defaultID  string
+}
+
+// Load reads every *.yaml and *.yml file in dir. defaultID must name one of
+// the assistants.
+func Load(dir, defaultID string) (*Registry, error) {
+	r := &Registry{dir: dir}
+	if err := r.Reload(defaultID); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the directory. On error the registry is left unchanged.
+func (r *Registry) Reload(defaultID string) error {
+	assistants, err := loadDir(r.dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := assistants[defaultID]; !ok {
+		return fmt.Errorf("default assistant %q is not defined in %s", defaultID, r.dir)
+	}
+
+	r.mu.Lock()
+	r.assistants = assistants
+	r.defaultID = defaultID
+	r.mu.Unlock()
+	return nil
+}
+
+func loadDir(dir string) (map[string]*Assistant, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assistants directory: %w", err)
+	}
+
+	assistants := make(map[string]*Assistant)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		a, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if a.ID == "" {
+			a.ID = strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		}
+		if _, exists := assistants[a.ID]; exists {
+			return nil, fmt.Errorf("assistant %q is defined twice (again in %s)", a.ID, path)
+		}
+		assistants[a.ID] = a
+	}
+	return assistants, nil
+}
+
+func loadFile(path string) (*Assistant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assistant: %w", err)
+	}
+	defer f.Close()
+
+	var a Assistant
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&a); err != nil {
+		return nil, fmt.Errorf("failed to parse assistant %s: %w", path, err)
+	}
+	if err := a.validate(); err != nil {
+		return nil, fmt.Errorf("invalid assistant %s: %w", path, err)
+	}
+	return &a, nil
+}
+
+// Get returns the assistant with the given id, or the default assistant if
+// id is empty.
+func (r *Registry) Get(id string) (*Assistant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id == "" {
+		id = r.defaultID
+	}
+	a, ok := r.assistants[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown assistant %q", id)
+	}
+	return a, nil
+}
+
+// List returns the assistants sorted by id.
+func (r *Registry) List() []*Assistant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Assistant, 0, len(r.assistants))
+	for _, a := range r.assistants {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
@@ -0,0 +1,88 @@
+package assistant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// The definitions shipped with the gateway must always load.
+func TestLoadShippedAssistants(t *testing.T) {
+	registry, err := Load("../../assistants", "general")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	math, err := registry.Get("math-physics")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	instruction := math.SystemInstruction()
+	if !strings.Contains(instruction, "Output rules:") || !strings.Contains(instruction, "LaTeX") {
+		t.Errorf("system instruction lacks output rules:\n%s", instruction)
+	}
+
+	config := math.Generation.Apply(llm.DefaultGenerationConfig())
+	if config.Temperature != 0.2 || config.MaxOutputTokens != 4096 || config.TopK != 40 {
+		t.Errorf("generation = %+v", config)
+	}
+
+	if a, _ := registry.Get(""); a.ID != "general" {
+		t.Errorf("default assistant = %q", a.ID)
+	}
+	if _, err := registry.Get("astrology"); err == nil {
+		t.Error("expected an error for an unknown assistant")
+	}
+}
+
+func TestKeywordClassifier(t *testing.T) {
+	registry, err := Load("../../assistants", "general")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	classifier := KeywordClassifier{Registry: registry}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"What is the derivative of x^2 sin(x)?", "math-physics"},
+		{"Why does my Python function recurse forever?", "computer-science"},
+		{"Can you summarize chapter 3 for me", "document-analysis"},
+		{"How is C++ different from C#?", "computer-science"},
+		{"hello there", ""},
+	}
+	for _, tt := range tests {
+		got, ok := classifier.Classify(context.Background(), tt.text)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Classify(%q) = %q, %v; want %q", tt.text, got, ok, tt.want)
+		}
+	}
+}
+
+func TestReloadKeepsAssistantsOnError(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("tutor.yaml", "system_prompt: Be helpful.\n")
+
+	registry, err := Load(dir, "tutor")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	write("broken.yaml", "system_prompt: Hi\nunknown_field: true\n")
+	if err := registry.Reload("tutor"); err == nil {
+		t.Fatal("expected Reload to reject an unknown field")
+	}
+	if _, err := registry.Get("tutor"); err != nil {
+		t.Errorf("previous assistants were dropped: %v", err)
+	}
+}
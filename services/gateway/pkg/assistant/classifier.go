@@ -0,0 +1,55 @@
+// pkg/assistant/classifier.go
+package assistant
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Classifier picks an assistant for a message that did not name one. ok is
+// false when it has no confident answer and the default should be used.
+type Classifier interface {
+	Classify(ctx context.Context, text string) (id string, ok bool)
+}
+
+// KeywordClassifier routes a message to the assistant whose keywords it
+// mentions most. It is deliberately cheap: no model call, so routing adds
+// nothing to time to first token. Ties go to the default assistant.
+type KeywordClassifier struct {
+	Registry *Registry
+}
+
+func (c KeywordClassifier) Classify(ctx context.Context, text string) (string, bool) {
+	words := " " + normalize(text) + " "
+
+	best, bestScore, tied := "", 0, false
+	for _, a := range c.Registry.List() {
+		score := 0
+		for _, keyword := range a.Keywords {
+			if keyword = normalize(keyword); keyword != "" && strings.Contains(words, " "+keyword+" ") {
+				score++
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = a.ID, score, false
+		case score == bestScore && score > 0:
+			tied = true
+		}
+	}
+	if bestScore == 0 || tied {
+		return "", false
+	}
+	return best, true
+}
+
+// normalize lower-cases text and reduces it to words separated by single
+// spaces. Characters common in subject names, such as the ones in "c++" and
+// "c#", are kept.
+func normalize(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,98 @@
+// pkg/attachment/attachment.go
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// Defaults for Limits.
+const (
+	DefaultMaxBytes          = 8 << 20
+	DefaultMaxImageDimension = 2048
+)
+
+// Errors for attachments the gateway refuses. The wrapping error describes
+// the problem well enough to show to the user.
+var (
+	ErrEmpty           = errors.New("attachment is empty")
+	ErrTooLarge        = errors.New("attachment is too large")
+	ErrUnsupportedType = errors.New("unsupported attachment type")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// Limits bound what an attachment may be.
+type Limits struct {
+	// MaxBytes bounds an attachment as received, before downscaling.
+	MaxBytes int
+	// MaxImageDimension is the longest side images are downscaled to. Zero
+	// sends images at their original size.
+	MaxImageDimension int
+}
+
+// supportedTypes are the types vision models read: the image formats
+// Gemini accepts, PDFs and plain text. GIFs are converted to PNG.
+var supportedTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"image/heif":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// Prepare checks an attachment against limits and turns it into the blob
+// sent to the model. The type is sniffed from the content, never taken
+// from the file name or the client. Images larger than the limit are
+// downscaled, and GIFs converted to PNG.
+func Prepare(data []byte, limits Limits) (*llm.Blob, error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return nil, fmt.Errorf("%w: the limit is %s", ErrTooLarge, formatSize(limits.MaxBytes))
+	}
+
+	mimeType := Sniff(data)
+	if !supportedTypes[mimeType] {
+		return nil, fmt.Errorf("%w %s: send a PNG, JPEG, WebP or HEIC image, a PDF or plain text", ErrUnsupportedType, mimeType)
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		return prepareImage(data, mimeType, limits.MaxImageDimension)
+	}
+	return &llm.Blob{MIMEType: mimeType, Data: data}, nil
+}
+
+// Sniff returns the media type of data, without parameters.
+func Sniff(data []byte) string {
+	// HEIF photos, the iPhone default, are ISO media files that
+	// http.DetectContentType does not know
+	if len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")) {
+		switch string(data[8:12]) {
+		case "heic", "heix", "heim", "heis", "hevc", "hevx":
+			return "image/heic"
+		case "mif1", "msf1":
+			return "image/heif"
+		}
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return mimeType
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KiB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
@@ -0,0 +1,114 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrepareSniffsAndLimits(t *testing.T) {
+	limits := Limits{MaxBytes: 1 << 20, MaxImageDimension: 100}
+
+	blob, err := Prepare([]byte("%PDF-1.7\n..."), limits)
+	if err != nil || blob.MIMEType != "application/pdf" {
+		t.Errorf("pdf = %+v, %v", blob, err)
+	}
+	if _, err := Prepare([]byte("MZ\x90\x00binary"), limits); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("executable error = %v", err)
+	}
+	if _, err := Prepare(make([]byte, 2<<20), limits); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized error = %v", err)
+	}
+	if _, err := Prepare([]byte("\x89PNG\r\n\x1a\nnot really"), limits); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("corrupt png error = %v", err)
+	}
+
+	small := encodePNG(t, 50, 20)
+	if blob, err := Prepare(small, limits); err != nil || !bytes.Equal(blob.Data, small) {
+		t.Errorf("small image was not passed through unchanged: %v", err)
+	}
+	blob, err = Prepare(encodePNG(t, 400, 100), limits)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(blob.Data))
+	if err != nil || config.Width != 100 || config.Height != 25 {
+		t.Errorf("downscaled to %dx%d (%v), want 100x25", config.Width, config.Height, err)
+	}
+}
+
+func TestPrepareConvertsGIFToPNG(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 4, 4), []color.Color{color.Black, color.White})
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := Prepare(buf.Bytes(), Limits{MaxBytes: 1 << 20})
+	if err != nil || blob.MIMEType != "image/png" {
+		t.Fatalf("gif = %+v, %v", blob, err)
+	}
+}
+
+func TestPrepareAppliesEXIFOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 100)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// APP1 Exif segment with IFD0 holding orientation 6 (rotate 90° clockwise)
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	data := append(append([]byte{0xFF, 0xD8}, app1...), buf.Bytes()[2:]...)
+
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("orientation = %d, want 6", got)
+	}
+	blob, err := Prepare(data, Limits{MaxBytes: 1 << 20, MaxImageDimension: 150})
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(blob.Data))
+	if err != nil || config.Width != 50 || config.Height != 150 {
+		t.Errorf("result is %dx%d (%v), want the upright 50x150", config.Width, config.Height, err)
+	}
+}
+
+func TestMemoryStoreEvictsAndChecksOwner(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	expires := time.Now().Add(time.Hour)
+	store.Put(ctx, &Upload{ID: "a", Owner: "alice", ExpiresAt: expires, Blob: llm.Blob{MIMEType: "text/plain", Data: make([]byte, 6)}})
+	store.Put(ctx, &Upload{ID: "b", Owner: "alice", ExpiresAt: expires, Blob: llm.Blob{MIMEType: "text/plain", Data: make([]byte, 6)}})
+
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("oldest upload was kept past the size limit: %v", err)
+	}
+	if _, err := Lookup(ctx, store, "b", "alice"); err != nil {
+		t.Errorf("owner lookup: %v", err)
+	}
+	if _, err := Lookup(ctx, store, "b", "mallory"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("another user could attach the upload: %v", err)
+	}
+}
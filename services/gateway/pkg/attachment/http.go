@@ -0,0 +1,129 @@
+// pkg/attachment/http.go
+package attachment
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+)
+
+// DefaultTTL is how long uploads are kept when Handler does not say.
+const DefaultTTL = time.Hour
+
+// multipartOverhead allows for the form encoding around an uploaded file.
+const multipartOverhead = 64 << 10
+
+// Handler accepts uploads for later chats to attach by id.
+type Handler struct {
+	Store  Store
+	Limits Limits
+	TTL    time.Duration
+}
+
+// UploadResponse describes a stored upload. MIMEType and Size are those
+// of the file as it will be sent to the model, after downscaling.
+type UploadResponse struct {
+	UploadID  string    `json:"upload_id"`
+	Name      string    `json:"name,omitempty"`
+	MIMEType  string    `json:"mime_type"`
+	Size      int       `json:"size"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeUpload answers POST with the file either as a multipart form field
+// named "file" or as the raw request body, named by the "name" query
+// parameter. The upload belongs to the authenticated caller.
+func (h *Handler) ServeUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use POST"})
+		return
+	}
+
+	limits := h.Limits
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultMaxBytes
+	}
+	limit := int64(limits.MaxBytes)
+	body := http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+	name := r.URL.Query().Get("name")
+	var file io.Reader = body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = body
+		part, header, err := r.FormFile("file")
+		if err != nil {
+			writeJSON(w, uploadStatus(err), errorResponse{Error: "invalid upload: " + err.Error()})
+			return
+		}
+		defer part.Close()
+		file, name = part, header.Filename
+	}
+
+	// Read one byte past the limit so oversized files are reported as such
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		writeJSON(w, uploadStatus(err), errorResponse{Error: "failed to read upload: " + err.Error()})
+		return
+	}
+	blob, err := Prepare(data, limits)
+	if err != nil {
+		writeJSON(w, uploadStatus(err), errorResponse{Error: err.Error()})
+		return
+	}
+
+	ttl := h.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	upload := &Upload{ID: NewID(), Blob: *blob, ExpiresAt: time.Now().Add(ttl).UTC()}
+	if name != "" {
+		upload.Name = filepath.Base(name)
+	}
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		upload.Owner = identity.UserID
+	}
+	if err := h.Store.Put(r.Context(), upload); err != nil {
+		log.Printf("Failed to store upload: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to store upload"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, UploadResponse{
+		UploadID:  upload.ID,
+		Name:      upload.Name,
+		MIMEType:  blob.MIMEType,
+		Size:      len(blob.Data),
+		ExpiresAt: upload.ExpiresAt,
+	})
+}
+
+// uploadStatus maps a rejected upload to its HTTP status.
+func uploadStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrTooLarge), errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write upload response: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// pkg/attachment/image.go
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// maxPixels bounds the images decoded for downscaling, so a small file
+// declaring huge dimensions cannot exhaust memory.
+const maxPixels = 50_000_000
+
+const jpegQuality = 85
+
+// prepareImage downscales images whose longest side exceeds maxDimension
+// and converts GIFs to PNG. WebP and HEIF images cannot be decoded here and
+// are sent as they are.
+func prepareImage(data []byte, mimeType string, maxDimension int) (*llm.Blob, error) {
+	original := &llm.Blob{MIMEType: mimeType, Data: data}
+	if mimeType != "image/png" && mimeType != "image/jpeg" && mimeType != "image/gif" {
+		return original, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large to process", ErrInvalidImage, config.Width, config.Height)
+	}
+	oversized := maxDimension > 0 && max(config.Width, config.Height) > maxDimension
+	if !oversized && mimeType != "image/gif" {
+		return original, nil
+	}
+
+	var decoded image.Image
+	switch mimeType {
+	case "image/jpeg":
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		decoded, err = png.Decode(bytes.NewReader(data))
+	default:
+		decoded, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	// Re-encoding drops the EXIF orientation phones rely on, so apply it
+	if mimeType == "image/jpeg" {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+	if maxDimension > 0 {
+		rgba = downscale(rgba, maxDimension)
+	}
+
+	var out bytes.Buffer
+	if mimeType == "image/jpeg" {
+		err = jpeg.Encode(&out, rgba, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		mimeType = "image/png"
+		err = png.Encode(&out, rgba)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return &llm.Blob{MIMEType: mimeType, Data: out.Bytes()}, nil
+}
+
+// downscale shrinks src so its longest side is at most maxDimension,
+// averaging the source pixels each destination pixel covers.
+func downscale(src *image.RGBA, maxDimension int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if max(w, h) <= maxDimension {
+		return src
+	}
+	scale := float64(maxDimension) / float64(max(w, h))
+	dw := max(1, int(math.Round(float64(w)*scale)))
+	dh := max(1, int(math.Round(float64(h)*scale)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			pixel := dst.Pix[dst.PixOffset(x, y):]
+			for c := range sum {
+				pixel[c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient turns an image stored with EXIF orientation 2-8 upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, 1 (upright) if it
+// has none.
+func jpegOrientation(data []byte) int {
+	// Walk the segments before the image data looking for APP1 Exif
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,47 @@
+// pkg/attachment/redis.go
+package attachment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "zephyr:upload:"
+
+// RedisStore shares uploads between gateway replicas, so a chat can use an
+// upload taken by any of them.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (r *RedisStore) Put(ctx context.Context, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload: %w", err)
+	}
+	return r.client.Set(ctx, redisKeyPrefix+upload.ID, data, time.Until(upload.ExpiresAt)).Err()
+}
+
+func (r *RedisStore) Get(ctx context.Context, id string) (*Upload, error) {
+	data, err := r.client.Get(ctx, redisKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload: %w", err)
+	}
+	return &upload, nil
+}
@@ -0,0 +1,105 @@
+// pkg/attachment/store.go
+package attachment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// ErrNotFound is returned for uploads that never existed, have expired or
+// belong to someone else.
+var ErrNotFound = errors.New("upload not found")
+
+// Upload is an attachment uploaded ahead of the chat that uses it, already
+// checked and downscaled.
+type Upload struct {
+	ID string `json:"id"`
+	// Owner is the user who uploaded it, empty without authentication.
+	// Only they can attach it.
+	Owner     string    `json:"owner,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Blob      llm.Blob  `json:"blob"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store keeps uploads until they expire.
+type Store interface {
+	Put(ctx context.Context, upload *Upload) error
+	// Get returns ErrNotFound if there is no live upload with id.
+	Get(ctx context.Context, id string) (*Upload, error)
+}
+
+// Lookup returns the upload with id if owner may use it.
+func Lookup(ctx context.Context, store Store, id, owner string) (*Upload, error) {
+	upload, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
+
+// NewID returns a random upload id. Ids are unguessable, since without
+// authentication knowing one is enough to attach it.
+func NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return "up_" + hex.EncodeToString(b[:])
+}
+
+// MemoryStore keeps uploads in the process, up to a total size, dropping
+// the oldest first. A chat must reach the replica that took its upload.
+type MemoryStore struct {
+	maxBytes int
+
+	mu      sync.Mutex
+	uploads map[string]*Upload
+	order   []string
+	size    int
+}
+
+func NewMemoryStore(maxBytes int) *MemoryStore {
+	return &MemoryStore{maxBytes: maxBytes, uploads: make(map[string]*Upload)}
+}
+
+func (m *MemoryStore) Put(ctx context.Context, upload *Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploads[upload.ID] = upload
+	m.order = append(m.order, upload.ID)
+	m.size += len(upload.Blob.Data)
+
+	now := time.Now()
+	for len(m.order) > 1 {
+		oldest, ok := m.uploads[m.order[0]]
+		if ok && m.size <= m.maxBytes && now.Before(oldest.ExpiresAt) {
+			break
+		}
+		if ok {
+			m.size -= len(oldest.Blob.Data)
+			delete(m.uploads, oldest.ID)
+		}
+		m.order = m.order[1:]
+	}
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id string) (*Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[id]
+	if !ok || time.Now().After(upload.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
@@ -0,0 +1,271 @@
+// pkg/auth/auth.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// WebSocket close codes sent when a connection fails authentication. They
+// are in the 4000-4999 range reserved for applications and mirror the
+// equivalent HTTP statuses.
+const (
+	CloseUnauthorized = 4401
+	CloseForbidden    = 4403
+)
+
+// SubprotocolPrefix marks a bearer token passed as a WebSocket subprotocol,
+// for browser clients that cannot set headers. Clients offer both "bearer"
+// and "bearer.<jwt>"; the server selects "bearer".
+const (
+	Subprotocol       = "bearer"
+	SubprotocolPrefix = "bearer."
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid bearer token")
+	ErrTokenExpired = errors.New("bearer token expired")
+)
+
+// Identity is the authenticated caller attached to a connection.
+type Identity struct {
+	UserID    string
+	TenantID  string
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+func (id *Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+type Config struct {
+	Keys     KeySource
+	Issuer   string
+	Audience string
+	// TenantClaim names the claim holding the tenant id.
+	TenantClaim string
+	Leeway      time.Duration
+}
+
+// Authenticator validates HS256 and RS256 bearer tokens. Keys can be
+// rotated by publishing a new kid in the JWKS file and calling Reload, or
+// by letting Watch pick up the change.
+type Authenticator struct {
+	config Config
+
+	mu       sync.RWMutex
+	keys     []Key
+	modTimes map[string]time.Time
+}
+
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	a := &Authenticator{config: config}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload re-reads every key file.
+func (a *Authenticator) Reload() error {
+	keys, err := a.config.Keys.Load()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no JWT verification keys configured")
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.modTimes = a.fileModTimes()
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Authenticator) files() []string {
+	var files []string
+	for _, path := range []string{a.config.Keys.HS256SecretFile, a.config.Keys.RS256PublicKey, a.config.Keys.JWKSFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func (a *Authenticator) fileModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range a.files() {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// Watch reloads the keys whenever one of the key files changes, until ctx
+// is cancelled. A failed reload keeps the previous keys.
+func (a *Authenticator) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := a.fileModTimes()
+			a.mu.RLock()
+			changed := false
+			for path, modTime := range current {
+				if !modTime.Equal(a.modTimes[path]) {
+					changed = true
+				}
+			}
+			a.mu.RUnlock()
+
+			if !changed {
+				continue
+			}
+			if err := a.Reload(); err != nil {
+				log.Printf("Failed to reload JWT keys: %v", err)
+				continue
+			}
+			log.Printf("Reloaded JWT verification keys")
+		}
+	}
+}
+
+func (a *Authenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var set jwt.VerificationKeySet
+	for _, key := range a.keys {
+		if key.Algorithm != alg {
+			continue
+		}
+		if kid != "" && key.Kid != "" && key.Kid != kid {
+			continue
+		}
+		if key.PublicKey != nil {
+			set.Keys = append(set.Keys, key.PublicKey)
+		} else {
+			set.Keys = append(set.Keys, key.Secret)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("no %s key for kid %q", alg, kid)
+	}
+	return set, nil
+}
+
+// Verify validates a raw token and returns the identity it carries.
+func (a *Authenticator) Verify(raw string) (*Identity, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.config.Leeway),
+	}
+	if a.config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.config.Issuer))
+	}
+	if a.config.Audience != "" {
+		options = append(options, jwt.WithAudience(a.config.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(raw, claims, a.keyFunc, options...); err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	identity := &Identity{UserID: subject}
+	if tenant, ok := claims[a.config.TenantClaim].(string); ok {
+		identity.TenantID = tenant
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				identity.Roles = append(identity.Roles, s)
+			}
+		}
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		identity.ExpiresAt = exp.Time
+	}
+	return identity, nil
+}
+
+// Authenticate validates the bearer token on r, taken from the
+// Authorization header, the access_token query parameter or a
+// "bearer.<jwt>" WebSocket subprotocol, in that order.
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := TokenFromRequest(r)
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	return a.Verify(token)
+}
+
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, SubprotocolPrefix) {
+				return strings.TrimPrefix(protocol, SubprotocolPrefix)
+			}
+		}
+	}
+	return ""
+}
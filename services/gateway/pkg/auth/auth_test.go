@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret-of-at-least-32-bytes!"
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// jwksFile writes the public halves of keys, by kid, as a JWKS.
+func jwksFile(t *testing.T, path string, keys map[string]*rsa.PrivateKey) string {
+	t.Helper()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(set)
+	return writeFile(t, path, data)
+}
+
+// sign returns a token for sub u1, valid for an hour unless claims say
+// otherwise.
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	all := jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+	for name, value := range claims {
+		if value == nil {
+			delete(all, name)
+			continue
+		}
+		all[name] = value
+	}
+	token := jwt.NewWithClaims(method, all)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	signing, rotated, stranger := newRSAKey(t), newRSAKey(t), newRSAKey(t)
+	publicPEM := publicKeyPEM(t, signing)
+
+	authenticator, err := NewAuthenticator(Config{
+		Keys: KeySource{
+			HS256Secret:    testSecret,
+			RS256PublicKey: writeFile(t, filepath.Join(dir, "public.pem"), publicPEM),
+			JWKSFile:       jwksFile(t, filepath.Join(dir, "jwks.json"), map[string]*rsa.PrivateKey{"k1": signing, "k2": rotated}),
+		},
+		Issuer:   "phoenix",
+		Audience: "zephyr",
+		Leeway:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := jwt.MapClaims{"iss": "phoenix", "aud": "zephyr", "tenant_id": "t1", "roles": []string{"student"}}
+	with := func(claims jwt.MapClaims) jwt.MapClaims {
+		merged := jwt.MapClaims{}
+		for name, value := range valid {
+			merged[name] = value
+		}
+		for name, value := range claims {
+			merged[name] = value
+		}
+		return merged
+	}
+	hour := time.Hour
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"hs256", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), valid), nil},
+		{"rs256 from the PEM key", sign(t, jwt.SigningMethodRS256, "", signing, valid), nil},
+		{"rs256 by kid", sign(t, jwt.SigningMethodRS256, "k2", rotated, valid), nil},
+		{"kid of another key", sign(t, jwt.SigningMethodRS256, "k1", rotated, valid), ErrInvalidToken},
+		{"unknown signer", sign(t, jwt.SigningMethodRS256, "", stranger, valid), ErrInvalidToken},
+		{"wrong secret", sign(t, jwt.SigningMethodHS256, "", []byte("another secret of at least 32 bytes"), valid), ErrInvalidToken},
+		{"hs256 signed with the rsa public key", sign(t, jwt.SigningMethodHS256, "", publicPEM, valid), ErrInvalidToken},
+		{"hs256 signed with the rsa public key by kid", sign(t, jwt.SigningMethodHS256, "k1", publicPEM, valid), ErrInvalidToken},
+		{"unsupported algorithm", sign(t, jwt.SigningMethodHS512, "", []byte(testSecret), valid), ErrInvalidToken},
+		{"expired", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"exp": time.Now().Add(-hour).Unix()})), ErrTokenExpired},
+		{"expired within leeway", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"exp": time.Now().Unix()})), nil},
+		{"no exp", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"exp": nil})), ErrInvalidToken},
+		{"not yet valid", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"nbf": time.Now().Add(hour).Unix()})), ErrInvalidToken},
+		{"wrong issuer", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"iss": "someone"})), ErrInvalidToken},
+		{"no issuer", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"iss": nil})), ErrInvalidToken},
+		{"wrong audience", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"aud": []string{"other"}})), ErrInvalidToken},
+		{"no sub", sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(jwt.MapClaims{"sub": ""})), ErrInvalidToken},
+		{"garbage", "not.a.token", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := authenticator.Verify(test.token)
+			if test.want != nil {
+				if !errors.Is(err, test.want) {
+					t.Fatalf("Verify = %+v, %v, want %v", identity, err, test.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if identity.UserID != "u1" || identity.TenantID != "t1" || !identity.HasRole("student") || identity.ExpiresAt.IsZero() {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestVerifyAfterJWKSRotation(t *testing.T) {
+	dir := t.TempDir()
+	old, rotated := newRSAKey(t), newRSAKey(t)
+	path := jwksFile(t, filepath.Join(dir, "jwks.json"), map[string]*rsa.PrivateKey{"k1": old})
+	authenticator, err := NewAuthenticator(Config{Keys: KeySource{JWKSFile: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, jwt.SigningMethodRS256, "k2", rotated, nil)
+	if _, err := authenticator.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify before k2 was published = %v", err)
+	}
+	jwksFile(t, path, map[string]*rsa.PrivateKey{"k2": rotated})
+	if err := authenticator.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticator.Verify(token); err != nil {
+		t.Errorf("Verify after k2 was published: %v", err)
+	}
+	if _, err := authenticator.Verify(sign(t, jwt.SigningMethodRS256, "k1", old, nil)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify with the retired k1 = %v", err)
+	}
+
+	// A broken file keeps the keys loaded before
+	writeFile(t, path, []byte("{"))
+	if err := authenticator.Reload(); err == nil {
+		t.Error("Reload of a broken JWKS succeeded")
+	}
+	if _, err := authenticator.Verify(token); err != nil {
+		t.Errorf("Verify after a failed reload: %v", err)
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		header      string
+		subprotocol string
+		want        string
+	}{
+		{"header", "/chat", "Bearer from-header", "", "from-header"},
+		{"scheme is case insensitive", "/chat", "bearer from-header", "", "from-header"},
+		{"header wins over the query", "/chat?access_token=from-query", "Bearer from-header", "bearer, bearer.from-protocol", "from-header"},
+		{"query wins over the subprotocol", "/chat?access_token=from-query", "", "bearer, bearer.from-protocol", "from-query"},
+		{"other schemes are ignored", "/chat?access_token=from-query", "Basic dXNlcjpwYXNz", "", "from-query"},
+		{"subprotocol", "/chat", "", "zephyr.chat.v1, bearer, bearer.from-protocol", "from-protocol"},
+		{"none", "/chat", "", "zephyr.chat.v1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.url, nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			if test.subprotocol != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", test.subprotocol)
+			}
+			if got := TokenFromRequest(r); got != test.want {
+				t.Errorf("TokenFromRequest = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
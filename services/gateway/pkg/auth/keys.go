@@ -0,0 +1,158 @@
+// pkg/auth/keys.go
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Key is a verification key. Kid may be empty for keys loaded from a bare
+// secret or PEM file; those are tried for any token without a matching kid.
+type Key struct {
+	Kid       string
+	Algorithm string
+	// Secret is set for HS256 keys, PublicKey for RS256 keys.
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+}
+
+// KeySource describes where verification keys are loaded from.
+type KeySource struct {
+	HS256Secret     string
+	HS256SecretFile string
+	RS256PublicKey  string // path to a PEM encoded public key
+	JWKSFile        string
+}
+
+func (s KeySource) Empty() bool {
+	return s.HS256Secret == "" && s.HS256SecretFile == "" && s.RS256PublicKey == "" && s.JWKSFile == ""
+}
+
+// Load reads every configured key. It is called again on rotation, so a
+// JWKS file can gain a new kid before tokens signed with it appear.
+func (s KeySource) Load() ([]Key, error) {
+	var keys []Key
+
+	if s.HS256Secret != "" {
+		keys = append(keys, Key{Algorithm: "HS256", Secret: []byte(s.HS256Secret)})
+	}
+
+	if s.HS256SecretFile != "" {
+		data, err := os.ReadFile(s.HS256SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HS256 secret: %w", err)
+		}
+		keys = append(keys, Key{Algorithm: "HS256", Secret: []byte(strings.TrimSpace(string(data)))})
+	}
+
+	if s.RS256PublicKey != "" {
+		key, err := loadRSAPublicKey(s.RS256PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, Key{Algorithm: "RS256", PublicKey: key})
+	}
+
+	if s.JWKSFile != "" {
+		jwks, err := loadJWKS(s.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+
+	return keys, nil
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RS256 public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key in %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func loadJWKS(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS %s: %w", path, err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("invalid modulus for key %q: %w", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exponent for key %q: %w", k.Kid, err)
+			}
+			keys = append(keys, Key{
+				Kid:       k.Kid,
+				Algorithm: "RS256",
+				PublicKey: &rsa.PublicKey{
+					N: new(big.Int).SetBytes(n),
+					E: int(new(big.Int).SetBytes(e).Int64()),
+				},
+			})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret for key %q: %w", k.Kid, err)
+			}
+			keys = append(keys, Key{Kid: k.Kid, Algorithm: "HS256", Secret: secret})
+		default:
+			return nil, fmt.Errorf("unsupported key type %q for key %q", k.Kty, k.Kid)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,176 @@
+// pkg/cache/cache.go
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// Entry is a cached answer.
+type Entry struct {
+	Text         string    `json:"text"`
+	FinishReason string    `json:"finish_reason"`
+	Usage        llm.Usage `json:"usage"`
+	Provider     string    `json:"provider"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Backend stores entries by key.
+type Backend interface {
+	// Get returns nil and no error on a miss.
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+}
+
+// Index finds the cached question most similar to a new one. Vectors are
+// grouped by scope, so only questions asked of the same assistant with the
+// same settings are compared.
+type Index interface {
+	// Nearest returns the key of the closest vector in scope and its cosine
+	// similarity, or an empty key if the scope is empty.
+	Nearest(ctx context.Context, scope string, vector []float32) (key string, similarity float64, err error)
+	Add(ctx context.Context, scope, key string, vector []float32, ttl time.Duration) error
+}
+
+// Cache answers repeated questions without calling the provider. Lookups
+// match the normalized prompt exactly and, when an Embedder and Index are
+// set, fall back to the most similar earlier prompt above Threshold.
+type Cache struct {
+	Backend Backend
+	TTL     time.Duration
+
+	Embedder  llm.Embedder
+	Index     Index
+	Threshold float64
+}
+
+// Request is everything that decides the answer to a single-turn chat.
+type Request struct {
+	Prompt            string
+	Assistant         string
+	SystemInstruction string
+	Provider          string
+	Model             string
+	Config            llm.GenerationConfig
+}
+
+// Match kinds reported by Lookup.
+const (
+	MatchExact    = "exact"
+	MatchSemantic = "semantic"
+)
+
+// Lookup is the outcome of looking a request up. On a miss, Store saves the
+// answer under the same key.
+type Lookup struct {
+	// Entry is nil on a miss.
+	Entry      *Entry
+	Match      string
+	Similarity float64
+
+	cache  *Cache
+	key    string
+	scope  string
+	vector []float32
+}
+
+// Lookup finds a cached answer to req. The returned Lookup is never nil,
+// even with an error, and can be used as a miss.
+func (c *Cache) Lookup(ctx context.Context, req Request) (*Lookup, error) {
+	prompt := Normalize(req.Prompt)
+	scope := scopeKey(req)
+	lookup := &Lookup{cache: c, scope: scope, key: scope + ":" + hash(prompt)}
+
+	entry, err := c.Backend.Get(ctx, lookup.key)
+	if err != nil {
+		return lookup, fmt.Errorf("cache lookup failed: %w", err)
+	}
+	if entry != nil {
+		lookup.Entry, lookup.Match, lookup.Similarity = entry, MatchExact, 1
+		return lookup, nil
+	}
+	if c.Embedder == nil || c.Index == nil {
+		return lookup, nil
+	}
+
+	lookup.vector, err = c.Embedder.Embed(ctx, prompt)
+	if err != nil {
+		return lookup, fmt.Errorf("failed to embed prompt: %w", err)
+	}
+	key, similarity, err := c.Index.Nearest(ctx, scope, lookup.vector)
+	if err != nil {
+		return lookup, fmt.Errorf("similarity lookup failed: %w", err)
+	}
+	if key == "" || similarity < c.Threshold {
+		return lookup, nil
+	}
+	// The entry may have expired while its vector lingered
+	if entry, err = c.Backend.Get(ctx, key); err != nil || entry == nil {
+		return lookup, err
+	}
+	lookup.Entry, lookup.Match, lookup.Similarity = entry, MatchSemantic, similarity
+	return lookup, nil
+}
+
+// Store caches the answer to a request that missed.
+func (l *Lookup) Store(ctx context.Context, entry *Entry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	if err := l.cache.Backend.Set(ctx, l.key, entry, l.cache.TTL); err != nil {
+		return fmt.Errorf("failed to cache answer: %w", err)
+	}
+	if l.vector != nil {
+		if err := l.cache.Index.Add(ctx, l.scope, l.key, l.vector, l.cache.TTL); err != nil {
+			return fmt.Errorf("failed to index answer: %w", err)
+		}
+	}
+	return nil
+}
+
+// Normalize folds the differences between prompts that do not change the
+// question: case, spacing and trailing punctuation.
+func Normalize(prompt string) string {
+	prompt = strings.Join(strings.Fields(strings.ToLower(prompt)), " ")
+	return strings.TrimRight(prompt, " .?!")
+}
+
+// scopeKey hashes everything but the prompt.
+func scopeKey(req Request) string {
+	data, _ := json.Marshal(struct {
+		Assistant, SystemInstruction, Provider, Model string
+		Config                                        llm.GenerationConfig
+	}{req.Assistant, req.SystemInstruction, req.Provider, req.Model, req.Config})
+	return hash(string(data))
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Cosine is the cosine similarity of a and b, or 0 if they differ in
+// length or either is zero.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
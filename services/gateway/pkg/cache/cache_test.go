@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// wordEmbedder maps text to counts of a few fixed words, so questions
+// sharing those words are similar.
+type wordEmbedder struct{}
+
+func (wordEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	vector := make([]float32, 4)
+	for i, word := range []string{"newton", "law", "second", "recursion"} {
+		vector[i] = float32(strings.Count(text, word))
+	}
+	return vector, nil
+}
+
+func TestLookupExactAndSemantic(t *testing.T) {
+	ctx := context.Background()
+	c := &Cache{
+		Backend:   NewMemoryBackend(100),
+		TTL:       time.Minute,
+		Embedder:  wordEmbedder{},
+		Index:     NewMemoryIndex(100),
+		Threshold: 0.9,
+	}
+	req := Request{Prompt: "Explain Newton's second law", Assistant: "math-physics", Config: llm.DefaultGenerationConfig()}
+
+	lookup, err := c.Lookup(ctx, req)
+	if err != nil || lookup.Entry != nil {
+		t.Fatalf("first lookup = %+v, %v; want a miss", lookup, err)
+	}
+	if err := lookup.Store(ctx, &Entry{Text: "F = ma", FinishReason: "STOP"}); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	exact := req
+	exact.Prompt = "explain  newton's second LAW?"
+	if lookup, _ := c.Lookup(ctx, exact); lookup.Entry == nil || lookup.Match != MatchExact {
+		t.Errorf("normalized prompt = %+v, want an exact hit", lookup)
+	}
+
+	similar := req
+	similar.Prompt = "what does newton's second law say"
+	if lookup, _ := c.Lookup(ctx, similar); lookup.Entry == nil || lookup.Match != MatchSemantic {
+		t.Errorf("similar prompt = %+v, want a semantic hit", lookup)
+	}
+
+	unrelated := req
+	unrelated.Prompt = "explain recursion"
+	if lookup, _ := c.Lookup(ctx, unrelated); lookup.Entry != nil {
+		t.Errorf("unrelated prompt hit %+v", lookup.Entry)
+	}
+
+	otherAssistant := req
+	otherAssistant.Assistant = "general"
+	if lookup, _ := c.Lookup(ctx, otherAssistant); lookup.Entry != nil {
+		t.Errorf("another assistant's answer was reused")
+	}
+}
+
+func TestMemoryBackendEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend(2)
+	backend.Set(ctx, "a", &Entry{Text: "a"}, time.Minute)
+	backend.Set(ctx, "b", &Entry{Text: "b"}, time.Minute)
+	backend.Get(ctx, "a")
+	backend.Set(ctx, "c", &Entry{Text: "c"}, time.Minute)
+
+	if entry, _ := backend.Get(ctx, "b"); entry != nil {
+		t.Errorf("least recently used entry was kept")
+	}
+	if entry, _ := backend.Get(ctx, "a"); entry == nil {
+		t.Errorf("recently used entry was evicted")
+	}
+
+	backend.Set(ctx, "d", &Entry{Text: "d"}, -time.Second)
+	if entry, _ := backend.Get(ctx, "d"); entry != nil {
+		t.Errorf("expired entry was returned")
+	}
+}
@@ -0,0 +1,125 @@
+// pkg/cache/memory.go
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	key      string
+	entry    *Entry
+	expireAt time.Time
+}
+
+// MemoryBackend keeps up to a fixed number of entries in the process,
+// evicting the least recently used. Each replica has its own cache.
+type MemoryBackend struct {
+	maxEntries int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+func NewMemoryBackend(maxEntries int) *MemoryBackend {
+	return &MemoryBackend{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryBackend) Get(ctx context.Context, key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*memoryItem)
+	if time.Now().After(item.expireAt) {
+		m.order.Remove(element)
+		delete(m.items, key)
+		return nil, nil
+	}
+	m.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (m *MemoryBackend) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := &memoryItem{key: key, entry: entry, expireAt: time.Now().Add(ttl)}
+	if element, ok := m.items[key]; ok {
+		element.Value = item
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.items[key] = m.order.PushFront(item)
+	for m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+type memoryVector struct {
+	key      string
+	vector   []float32
+	expireAt time.Time
+}
+
+// MemoryIndex searches the vectors of a scope by brute force. Scopes are
+// small, one per assistant and configuration, and capped at maxPerScope.
+type MemoryIndex struct {
+	maxPerScope int
+
+	mu     sync.Mutex
+	scopes map[string][]memoryVector
+}
+
+func NewMemoryIndex(maxPerScope int) *MemoryIndex {
+	return &MemoryIndex{maxPerScope: maxPerScope, scopes: make(map[string][]memoryVector)}
+}
+
+func (m *MemoryIndex) Nearest(ctx context.Context, scope string, vector []float32) (string, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	best, bestSimilarity := "", -1.0
+	for _, candidate := range m.scopes[scope] {
+		if now.After(candidate.expireAt) {
+			continue
+		}
+		if similarity := Cosine(vector, candidate.vector); similarity > bestSimilarity {
+			best, bestSimilarity = candidate.key, similarity
+		}
+	}
+	return best, bestSimilarity, nil
+}
+
+func (m *MemoryIndex) Add(ctx context.Context, scope, key string, vector []float32, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	kept := m.scopes[scope][:0]
+	for _, candidate := range m.scopes[scope] {
+		if candidate.key != key && now.Before(candidate.expireAt) {
+			kept = append(kept, candidate)
+		}
+	}
+	kept = append(kept, memoryVector{key: key, vector: vector, expireAt: now.Add(ttl)})
+	if m.maxPerScope > 0 && len(kept) > m.maxPerScope {
+		kept = kept[len(kept)-m.maxPerScope:]
+	}
+	m.scopes[scope] = kept
+	return nil
+}
@@ -0,0 +1,144 @@
+// pkg/cache/redis.go
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "zephyr:cache:"
+
+// RedisBackend shares cached answers between gateway replicas.
+type RedisBackend struct {
+	client *redis.Client
+}
+
+func NewRedisBackend(client *redis.Client) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+func (r *RedisBackend) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := r.client.Get(ctx, redisKeyPrefix+"entry:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cache entry: %w", err)
+	}
+	return &entry, nil
+}
+
+func (r *RedisBackend) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	return r.client.Set(ctx, redisKeyPrefix+"entry:"+key, data, ttl).Err()
+}
+
+// RedisIndex keeps the vectors of each scope in a hash, with a sorted set
+// of expiry times used to prune them since hash fields cannot expire.
+type RedisIndex struct {
+	client      *redis.Client
+	maxPerScope int
+}
+
+func NewRedisIndex(client *redis.Client, maxPerScope int) *RedisIndex {
+	return &RedisIndex{client: client, maxPerScope: maxPerScope}
+}
+
+func (r *RedisIndex) keys(scope string) (vectors, expiry string) {
+	return redisKeyPrefix + "vectors:" + scope, redisKeyPrefix + "expiry:" + scope
+}
+
+func (r *RedisIndex) Nearest(ctx context.Context, scope string, vector []float32) (string, float64, error) {
+	vectorsKey, _ := r.keys(scope)
+	candidates, err := r.client.HGetAll(ctx, vectorsKey).Result()
+	if err != nil {
+		return "", 0, err
+	}
+
+	best, bestSimilarity := "", -1.0
+	for key, data := range candidates {
+		if similarity := Cosine(vector, decodeVector([]byte(data))); similarity > bestSimilarity {
+			best, bestSimilarity = key, similarity
+		}
+	}
+	return best, bestSimilarity, nil
+}
+
+func (r *RedisIndex) Add(ctx context.Context, scope, key string, vector []float32, ttl time.Duration) error {
+	vectorsKey, expiryKey := r.keys(scope)
+	now := time.Now()
+
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, vectorsKey, key, encodeVector(vector))
+	pipe.ZAdd(ctx, expiryKey, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: key})
+	pipe.PExpire(ctx, vectorsKey, ttl)
+	pipe.PExpire(ctx, expiryKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// Drop expired vectors, then the soonest to expire beyond the cap
+	stale, err := r.client.ZRangeByScore(ctx, expiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	if r.maxPerScope > 0 {
+		count, err := r.client.ZCard(ctx, expiryKey).Result()
+		if err != nil {
+			return err
+		}
+		if excess := count - int64(len(stale)) - int64(r.maxPerScope); excess > 0 {
+			oldest, err := r.client.ZRange(ctx, expiryKey, int64(len(stale)), int64(len(stale))+excess-1).Result()
+			if err != nil {
+				return err
+			}
+			stale = append(stale, oldest...)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	members := make([]any, len(stale))
+	for i, member := range stale {
+		members[i] = member
+	}
+	pipe = r.client.TxPipeline()
+	pipe.HDel(ctx, vectorsKey, stale...)
+	pipe.ZRem(ctx, expiryKey, members...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
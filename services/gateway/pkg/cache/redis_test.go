@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+func TestRedisBackendAndIndex(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	backend := NewRedisBackend(client)
+	if err := backend.Set(ctx, "k", &Entry{Text: "cached", Usage: llm.Usage{PromptTokens: 3, OutputTokens: 5, TotalTokens: 8}}, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	entry, err := backend.Get(ctx, "k")
+	if err != nil || entry == nil || entry.Text != "cached" || entry.Usage.OutputTokens != 5 {
+		t.Fatalf("Get = %+v, %v", entry, err)
+	}
+	if entry, err := backend.Get(ctx, "missing"); entry != nil || err != nil {
+		t.Errorf("Get(missing) = %+v, %v; want a miss", entry, err)
+	}
+
+	index := NewRedisIndex(client, 2)
+	for i, key := range []string{"a", "b", "c"} {
+		vector := []float32{float32(i), 1}
+		if err := index.Add(ctx, "scope", key, vector, time.Duration(i+1)*time.Minute); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if keys, _ := server.HKeys("zephyr:cache:vectors:scope"); len(keys) != 2 {
+		t.Errorf("index kept %v, want the two newest", keys)
+	}
+
+	key, similarity, err := index.Nearest(ctx, "scope", []float32{2, 1})
+	if err != nil || key != "c" || similarity < 0.999 {
+		t.Errorf("Nearest = %q, %v, %v; want c", key, similarity, err)
+	}
+}
@@ -0,0 +1,315 @@
+// pkg/chat/http.go
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/attachment"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+)
+
+// DefaultKeepAlive is how often an idle event stream sends a comment when
+// StreamHandler does not say.
+const DefaultKeepAlive = 15 * time.Second
+
+// StreamHandler serves chats over Server-Sent Events, for clients such as
+// serverless functions and the CLI that cannot hold a WebSocket. Each
+// request carries one message and runs in a session of its own, so rate
+// limits, cancellation and the frames sent are those of /chat.
+type StreamHandler struct {
+	Service *Service
+	// ClientIP returns the address per-IP limits apply to.
+	ClientIP func(*http.Request) string
+	// MaxBodyBytes bounds the request body, as the read limit bounds
+	// WebSocket frames. Zero allows a frame with attachments of the
+	// default size.
+	MaxBodyBytes int64
+	// WriteTimeout bounds writing each event to the client.
+	WriteTimeout time.Duration
+	// KeepAlive is how often an idle stream sends a comment so proxies do
+	// not time it out. Zero means DefaultKeepAlive.
+	KeepAlive time.Duration
+	// Draining turns new chats away while it returns true, as during
+	// shutdown.
+	Draining func() bool
+
+	mu sync.Mutex
+	// streams are the running generations by caller and message_id, for
+	// cancel requests to find. Cancels only reach streams on this replica.
+	streams map[string]*Session
+}
+
+// keepAlive is written as an SSE comment rather than an event.
+type keepAlive struct{}
+
+// ServeStream answers POST with a chat message by streaming its frames as
+// events named after their type, start, token, complete and so on, with
+// the frame as data. A rejection before the generation starts, such as a
+// rate limit, is answered with its HTTP status and the error frame as a
+// JSON body instead. A cancel message stops the caller's stream with that
+// message_id; closing the request stops it too, unless the service keeps
+// streams to resume and the chat set metadata.resumable.
+//
+// A resume message, or a chat with a message_id repeated with the
+// Last-Event-ID header, streams the frames after that seq of an earlier
+// stream and then follows it live.
+func (h *StreamHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeRejection(w, http.StatusMethodNotAllowed, errorMessage("", newError(CodeMalformedMessage, "use POST")))
+		return
+	}
+
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = MaxFrameBytes(attachment.DefaultMaxBytes)
+	}
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeRejection(w, http.StatusRequestEntityTooLarge, errorMessage("", newError(CodeMalformedMessage, "message is larger than %d bytes", tooLarge.Limit)))
+		return
+	}
+	if err != nil {
+		writeRejection(w, http.StatusBadRequest, errorMessage("", newError(CodeMalformedMessage, "failed to read message: %v", err)))
+		return
+	}
+	message, invalid := DecodeMessage(raw)
+	if invalid != nil {
+		metrics.Messages.WithLabelValues("in", "invalid").Inc()
+		writeRejection(w, invalid.HTTPStatus(), errorMessage(message.MessageID, invalid))
+		return
+	}
+	metrics.Messages.WithLabelValues("in", message.Type).Inc()
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" && message.Type == TypeChat && message.MessageID != "" {
+		lastSeq, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || lastSeq < 0 {
+			writeRejection(w, http.StatusBadRequest, errorMessage(message.MessageID, newError(CodeMalformedMessage, "Last-Event-ID must be a seq")))
+			return
+		}
+		message = Message{Type: TypeResume, MessageID: message.MessageID, LastSeq: lastSeq, Metadata: message.Metadata}
+	}
+
+	ctx := context.Background()
+	clientIP := h.ClientIP(r)
+	caller, user := "ip:"+clientIP, "ip:"+clientIP
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		ctx = auth.WithIdentity(ctx, identity)
+		caller, user = identity.UserID, identity.UserID
+		if id := message.MetadataString("user_id"); id != "" && identity.HasRole(ServiceRole) {
+			user = id
+		}
+	}
+
+	switch message.Type {
+	case TypeChat, TypeResume:
+	case TypeCancel:
+		h.mu.Lock()
+		session := h.streams[generationKey(caller, message.MessageID)]
+		h.mu.Unlock()
+		if session == nil && h.Service.cancelRunning(generationKey(user, message.MessageID), ErrCancelledByClient) {
+			// Streams the client left, which keep running for it to resume
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if session == nil {
+			writeRejection(w, http.StatusNotFound, errorMessage(message.MessageID,
+				newError(CodeUnknownMessageID, "No active generation with this message_id")))
+			return
+		}
+		// The stream itself reports the cancellation
+		session.HandleMessage(message)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	default:
+		writeRejection(w, http.StatusBadRequest, errorMessage(message.MessageID,
+			newError(CodeUnsupportedType, "unsupported message type %q", message.Type)))
+		return
+	}
+
+	if message.MessageID == "" {
+		message.MessageID = newMessageID()
+	}
+	if h.Draining != nil && h.Draining() {
+		writeRejection(w, http.StatusServiceUnavailable, shutdownRejection(message.MessageID))
+		return
+	}
+	key := generationKey(caller, message.MessageID)
+	events := &eventWriter{w: w, rc: http.NewResponseController(w), timeout: h.WriteTimeout}
+	session := h.Service.NewSession(ctx, events, clientIP)
+	// A resumed stream may still be registered for the connection it was
+	// lost on; cancels reach it through the service instead
+	if message.Type == TypeChat {
+		if !h.register(key, session) {
+			session.Close()
+			writeRejection(w, http.StatusConflict, errorMessage(message.MessageID,
+				newError(CodeDuplicateMessageID, "A generation with this message_id is already running")))
+			return
+		}
+		defer h.unregister(key)
+	}
+
+	// Closing cancels the generation if the client went away, which
+	// detaching leaves running for it to resume
+	gone := false
+	defer func() {
+		if gone {
+			session.Detach()
+		} else {
+			session.Close()
+		}
+	}()
+
+	if err := session.HandleMessage(message); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(done)
+	}()
+
+	interval := h.KeepAlive
+	if interval <= 0 {
+		interval = DefaultKeepAlive
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-r.Context().Done():
+			gone = true
+			return
+		case <-ticker.C:
+			if err := session.writer.WriteJSON(keepAlive{}); err != nil {
+				gone = true
+				return
+			}
+		}
+	}
+}
+
+// register records the session streaming a chat for cancels to find. It
+// reports false if the caller already streams one with the same
+// message_id.
+func (h *StreamHandler) register(key string, session *Session) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.streams[key]; exists {
+		return false
+	}
+	if h.streams == nil {
+		h.streams = make(map[string]*Session)
+	}
+	h.streams[key] = session
+	return true
+}
+
+func (h *StreamHandler) unregister(key string) {
+	h.mu.Lock()
+	delete(h.streams, key)
+	h.mu.Unlock()
+}
+
+// eventWriter writes frames as Server-Sent Events. The response is only
+// committed by the first frame, so a rejection sent before the generation
+// starts can still become an HTTP error.
+type eventWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+
+	started  bool
+	rejected bool
+}
+
+func (e *eventWriter) WriteJSON(v interface{}) error {
+	if e.rejected {
+		return ErrWriterClosed
+	}
+	if e.timeout > 0 {
+		e.rc.SetWriteDeadline(time.Now().Add(e.timeout))
+	}
+
+	message, isMessage := v.(Message)
+	if !e.started && isMessage && message.Seq == 0 && message.Error != nil {
+		e.rejected = true
+		writeRejection(e.w, message.Error.HTTPStatus(), message)
+		return nil
+	}
+	if !e.started {
+		e.started = true
+		header := e.w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		// nginx buffers proxied responses unless told not to
+		header.Set("X-Accel-Buffering", "no")
+		e.w.WriteHeader(http.StatusOK)
+	}
+
+	var err error
+	switch {
+	case !isMessage:
+		_, err = io.WriteString(e.w, ": keep-alive\n\n")
+	default:
+		var data []byte
+		if data, err = json.Marshal(message); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		event := "event: " + message.Type + "\n"
+		if message.Seq > 0 {
+			event += "id: " + strconv.FormatInt(message.Seq, 10) + "\n"
+		}
+		_, err = io.WriteString(e.w, event+"data: "+string(data)+"\n\n")
+	}
+	if err != nil {
+		return err
+	}
+	return e.rc.Flush()
+}
+
+// HTTPStatus is the status a rejection is answered with over HTTP.
+func (err *Error) HTTPStatus() int {
+	switch err.Code {
+	case CodeDuplicateMessageID, CodeVideoNotReady:
+		return http.StatusConflict
+	case CodeUnknownMessageID, CodeUnknownVideo, CodeStreamNotResumable:
+		return http.StatusNotFound
+	case CodeRateLimited, CodeTooManyGenerations:
+		return http.StatusTooManyRequests
+	case CodeServerShuttingDown:
+		return http.StatusServiceUnavailable
+	case CodeInternal:
+		return http.StatusInternalServerError
+	}
+	switch {
+	case err.Code < 2000:
+		return http.StatusBadRequest
+	case err.Code >= 3000 && err.Code < 4000:
+		return http.StatusBadGateway
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func writeRejection(w http.ResponseWriter, status int, message Message) {
+	w.Header().Set("Content-Type", "application/json")
+	if retryAfter := message.Error.RetryAfterMs; retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt((retryAfter+999)/1000, 10))
+	}
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		log.Printf("Failed to write chat rejection: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+func newStreamServer(t *testing.T, provider llm.Provider) *httptest.Server {
+	t.Helper()
+	providers := llm.NewRegistry()
+	providers.Register(provider)
+	handler := &StreamHandler{
+		Service:  &Service{Providers: providers},
+		ClientIP: func(r *http.Request) string { return "127.0.0.1" },
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler.ServeStream))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readEvents returns the frames of an event stream, checking each event is
+// named after its frame's type. next is called after every event.
+func readEvents(t *testing.T, resp *http.Response, next func(Message)) []Message {
+	t.Helper()
+	var frames []Message
+	var event string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var frame Message
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame); err != nil {
+				t.Fatalf("invalid event data %q: %v", line, err)
+			}
+			if frame.Type != event {
+				t.Errorf("event %s carries a %s frame", event, frame.Type)
+			}
+			frames = append(frames, frame)
+			if next != nil {
+				next(frame)
+			}
+		}
+	}
+	return frames
+}
+
+func TestServeStreamSendsFramesAsEvents(t *testing.T) {
+	server := newStreamServer(t, llm.NewEchoProvider())
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"chat","message_id":"m1","content":"hello there"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	frames := readEvents(t, resp, nil)
+	if len(frames) < 3 || frames[0].Type != TypeStart || frames[len(frames)-1].Type != TypeComplete {
+		t.Fatalf("frames = %+v", frames)
+	}
+	var text strings.Builder
+	for _, frame := range frames {
+		text.WriteString(frame.Content)
+	}
+	if text.String() != "Echo: hello there" {
+		t.Errorf("streamed %q", text.String())
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"type":"chat","content":`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rejection Message
+	json.NewDecoder(resp.Body).Decode(&rejection)
+	if resp.StatusCode != http.StatusBadRequest || rejection.Error == nil || rejection.Error.Code != CodeMalformedMessage {
+		t.Errorf("malformed message answered %d %+v", resp.StatusCode, rejection)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"type":"chat","content":"hi","metadata":{"provider":"nope"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unknown provider answered %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestServeStreamCancelsByMessageID(t *testing.T) {
+	slow := llm.NewScriptedProvider(llm.Script{Default: strings.Repeat("word ", 200), TokenDelayMs: 10})
+	server := newStreamServer(t, slow)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"chat","message_id":"long","content":"go on"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	cancelled := false
+	frames := readEvents(t, resp, func(frame Message) {
+		if frame.Type != TypeToken || cancelled {
+			return
+		}
+		cancelled = true
+		cancel, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"cancel","message_id":"long"}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		cancel.Body.Close()
+		if cancel.StatusCode != http.StatusAccepted {
+			t.Errorf("cancel answered %d", cancel.StatusCode)
+		}
+	})
+	if last := frames[len(frames)-1]; last.Type != TypeCancelled {
+		t.Errorf("stream ended with %+v, want cancelled", last)
+	}
+
+	cancel, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"cancel","message_id":"long"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel.Body.Close()
+	if cancel.StatusCode != http.StatusNotFound {
+		t.Errorf("cancel of a finished stream answered %d", cancel.StatusCode)
+	}
+}
+
+func TestServeStreamResumesWithLastEventID(t *testing.T) {
+	handler := &StreamHandler{
+		Service:  newResumableService(100),
+		ClientIP: func(r *http.Request) string { return "127.0.0.1" },
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler.ServeStream))
+	t.Cleanup(server.Close)
+	body := `{"type":"chat","message_id":"m1","content":"go on","metadata":{"resumable":true}}`
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the connection after the third frame
+	scanner := bufio.NewScanner(resp.Body)
+	for seen := 0; seen < 3 && scanner.Scan(); {
+		if strings.HasPrefix(scanner.Text(), "data: ") {
+			seen++
+		}
+	}
+	resp.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	req.Header.Set("Last-Event-ID", "3")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	frames := readEvents(t, resp, nil)
+	if len(frames) == 0 || frames[0].Seq != 4 || frames[len(frames)-1].Type != TypeComplete {
+		t.Fatalf("resumed frames = %+v", frames)
+	}
+}
@@ -0,0 +1,406 @@
+// pkg/chat/protocol.go
+package chat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/assistant"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// The chat protocol is versioned through the WebSocket subprotocol. Clients
+// offer "zephyr.chat.v1"; clients that offer no zephyr.chat subprotocol at
+// all are spoken to in the current version for compatibility.
+const (
+	ProtocolVersion   = 1
+	SubprotocolPrefix = "zephyr.chat.v"
+	Subprotocol       = "zephyr.chat.v1"
+)
+
+// Message types. Clients send chat, cancel and resume; everything else is
+// sent by the gateway.
+const (
+	TypeChat           = "chat"
+	TypeCancel         = "cancel"
+	TypeResume         = "resume"
+	TypeStart          = "start"
+	TypeToken          = "token"
+	TypeComplete       = "complete"
+	TypeToolCall       = "tool_call"
+	TypeToolResult     = "tool_result"
+	TypeCancelled      = "cancelled"
+	TypeError          = "error"
+	TypeRateLimited    = "rate_limited"
+	TypeServerShutdown = "server_shutdown"
+)
+
+// Limits on inbound messages.
+const (
+	MaxContentLength   = 32000
+	MaxAttachments     = 4
+	maxMetadataEntries = 32
+	maxMetadataValue   = 1024
+)
+
+// Message is the envelope of every frame. Type decides which of the other
+// fields are set.
+//
+// Frames belonging to a generation carry its message_id and a seq that
+// starts at 1 with the start frame and increases by one per frame, so
+// clients can detect gaps and order frames. The one exception is a token
+// coalesced from several for a client reading too slowly, which carries
+// the seq of its last token. Frames not tied to a running generation,
+// such as rejections, have no seq. A client that lost its connection sends
+// resume with the last seq it saw to receive the frames after it again. The
+// generation only keeps running while the client is away if its chat set
+// metadata.resumable to true; otherwise it is cancelled on disconnect.
+type Message struct {
+	Type      string         `json:"type"`
+	MessageID string         `json:"message_id,omitempty"`
+	Seq       int64          `json:"seq,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	// Attachments are files sent with a chat, such as a photographed
+	// worksheet. Only providers with vision can read them.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Cached is set on every frame of an answer replayed from the response
+	// cache instead of generated.
+	Cached bool `json:"cached,omitempty"`
+
+	// Set on resume messages to the last seq the client received.
+	LastSeq int64 `json:"last_seq,omitempty"`
+
+	// Set on tool_call and tool_result frames.
+	Tool *ToolEvent `json:"tool,omitempty"`
+
+	// Set on complete frames.
+	FinishReason  string             `json:"finish_reason,omitempty"`
+	Usage         *Usage             `json:"usage,omitempty"`
+	SafetyRatings []llm.SafetyRating `json:"safety_ratings,omitempty"`
+
+	// Set on error, rate_limited and server_shutdown frames.
+	Error *Error `json:"error,omitempty"`
+
+	// Set by transports other than the chat protocol, such as the OpenAI
+	// compatible API, and never by frames. History replaces conversation
+	// memory with earlier turns the client sent itself, Instructions are
+	// added to the assistant's system prompt and Generation overrides its
+	// sampling parameters.
+	History      []llm.Content         `json:"-"`
+	Instructions string                `json:"-"`
+	Generation   *assistant.Generation `json:"-"`
+}
+
+// Usage is the token accounting of one generation. Estimated is set when
+// the provider did not report usage and the gateway counted instead.
+type Usage struct {
+	llm.Usage
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Attachment is a file sent with a chat, either inline as base64 data or
+// by the id /v1/uploads returned for it. Its type is sniffed from the
+// content, and images are downscaled before they reach the model.
+type Attachment struct {
+	UploadID string `json:"upload_id,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// MaxFrameBytes is the largest frame a client may send when attachments
+// are at most maxAttachmentBytes: a full message with every attachment
+// inline in base64.
+func MaxFrameBytes(maxAttachmentBytes int) int64 {
+	return int64(MaxContentLength*4+maxMetadataEntries*maxMetadataValue*2) +
+		int64(MaxAttachments)*int64(base64.StdEncoding.EncodedLen(maxAttachmentBytes)) + 64<<10
+}
+
+// ToolEvent is a tool the model called while generating. A tool_call frame
+// is sent before the tool runs and a tool_result frame with the same
+// call_id once it returns.
+type ToolEvent struct {
+	CallID string          `json:"call_id"`
+	Name   string          `json:"name"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	// Set on tool_result frames. Error replaces Result if the call failed;
+	// the model is told and carries on.
+	Result     any    `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+// MetadataString returns metadata[key] if it is a string.
+func (m Message) MetadataString(key string) string {
+	if m.Metadata == nil {
+		return ""
+	}
+	value, _ := m.Metadata[key].(string)
+	return value
+}
+
+// ErrorCode identifies a class of failure. Codes are stable across protocol
+// versions; messages are for humans and may change.
+type ErrorCode int
+
+const (
+	// 1xxx: the client sent something the gateway cannot act on.
+	CodeMalformedMessage       ErrorCode = 1000
+	CodeValidationFailed       ErrorCode = 1001
+	CodeUnsupportedType        ErrorCode = 1002
+	CodeDuplicateMessageID     ErrorCode = 1003
+	CodeUnknownMessageID       ErrorCode = 1004
+	CodeUnknownProvider        ErrorCode = 1005
+	CodeUnknownAssistant       ErrorCode = 1006
+	CodeUnknownVideo           ErrorCode = 1007
+	CodeAttachmentsUnsupported ErrorCode = 1008
+	CodeStreamNotResumable     ErrorCode = 1009
+
+	// 2xxx: the request was valid but a limit refused it.
+	CodeRateLimited        ErrorCode = 2000
+	CodeTooManyGenerations ErrorCode = 2001
+	CodeServerShuttingDown ErrorCode = 2002
+	CodePromptBlocked      ErrorCode = 2003
+	CodeVideoNotReady      ErrorCode = 2004
+
+	// 3xxx: the upstream provider failed.
+	CodeProviderError     ErrorCode = 3000
+	CodeStreamInterrupted ErrorCode = 3001
+	CodeProviderRateLimit ErrorCode = 3002
+
+	// 4xxx: the gateway itself failed.
+	CodeInternal ErrorCode = 4000
+)
+
+var codeNames = map[ErrorCode]string{
+	CodeMalformedMessage:       "malformed_message",
+	CodeValidationFailed:       "validation_failed",
+	CodeUnsupportedType:        "unsupported_type",
+	CodeDuplicateMessageID:     "duplicate_message_id",
+	CodeUnknownMessageID:       "unknown_message_id",
+	CodeUnknownProvider:        "unknown_provider",
+	CodeUnknownAssistant:       "unknown_assistant",
+	CodeUnknownVideo:           "unknown_video",
+	CodeAttachmentsUnsupported: "attachments_unsupported",
+	CodeStreamNotResumable:     "stream_not_resumable",
+	CodeRateLimited:            "rate_limited",
+	CodeTooManyGenerations:     "too_many_generations",
+	CodeServerShuttingDown:     "server_shutting_down",
+	CodePromptBlocked:          "prompt_blocked",
+	CodeVideoNotReady:          "video_not_ready",
+	CodeProviderError:          "provider_error",
+	CodeStreamInterrupted:      "stream_interrupted",
+	CodeProviderRateLimit:      "provider_rate_limited",
+	CodeInternal:               "internal_error",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("error_%d", int(c))
+}
+
+// Error is the payload of failure frames.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Name    string    `json:"name"`
+	Message string    `json:"message"`
+	// Fields lists the problems found by validation.
+	Fields []FieldError `json:"fields,omitempty"`
+	// RetryAfterMs is set when retrying later may succeed.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+func newError(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Name: code.String(), Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Name, e.Code, e.Message)
+}
+
+// errorMessage builds an error frame.
+func errorMessage(messageID string, err *Error) Message {
+	return Message{Type: TypeError, MessageID: messageID, Error: err}
+}
+
+// NegotiateSubprotocol picks the protocol for the subprotocols a client
+// offered. ok is false if the client only offered zephyr.chat versions this
+// gateway does not speak.
+func NegotiateSubprotocol(offered []string) (version int, ok bool) {
+	versioned := false
+	for _, protocol := range offered {
+		if protocol == Subprotocol {
+			return ProtocolVersion, true
+		}
+		if strings.HasPrefix(protocol, SubprotocolPrefix) {
+			versioned = true
+		}
+	}
+	return ProtocolVersion, !versioned
+}
+
+var (
+	messageIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+	// Metadata keys the gateway interprets, which must be strings.
+	stringMetadata = []string{"provider", "model", "assistant", "conversation_id", "user_id", "video_id"}
+)
+
+// TimeRange returns the part of the video a chat asks about, in seconds
+// from the start. A zero end means the end of the video.
+func (m Message) TimeRange() (start, end float64) {
+	start, end, _ = timeRange(m.Metadata["time_range"])
+	return start, end
+}
+
+// timeRange reads a time_range of the form {"start": 60, "end": 300}, where
+// either bound may be left out. problem describes why value is not one.
+func timeRange(value any) (start, end float64, problem string) {
+	if value == nil {
+		return 0, 0, ""
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return 0, 0, "must be an object with start and end in seconds"
+	}
+	for key, field := range fields {
+		seconds, ok := field.(float64)
+		switch {
+		case key != "start" && key != "end":
+			return 0, 0, fmt.Sprintf("has unknown field %q", key)
+		case !ok || seconds < 0:
+			return 0, 0, fmt.Sprintf("%s must be a non-negative number of seconds", key)
+		case key == "start":
+			start = seconds
+		default:
+			end = seconds
+		}
+	}
+	if end != 0 && end <= start {
+		return 0, 0, "end must be after start"
+	}
+	return start, end, ""
+}
+
+// DecodeMessage parses and validates a frame received from a client. The
+// returned error is ready to be sent back; its message_id is the decoded
+// one when the frame got that far.
+func DecodeMessage(raw []byte) (Message, *Error) {
+	var message Message
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&message); err != nil {
+		return message, newError(CodeMalformedMessage, "invalid JSON: %v", err)
+	}
+	if decoder.More() {
+		return message, newError(CodeMalformedMessage, "expected a single JSON object per frame")
+	}
+	return message, message.Validate()
+}
+
+// Validate checks a message received from a client, however it arrived.
+// The returned error is ready to be sent back.
+func (message Message) Validate() *Error {
+	var problems []FieldError
+	problem := func(field, format string, args ...any) {
+		problems = append(problems, FieldError{Field: field, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	switch message.Type {
+	case TypeChat:
+		if message.MessageID != "" && !messageIDPattern.MatchString(message.MessageID) {
+			problem("message_id", "must be 1-128 letters, digits or _.:-")
+		}
+		if strings.TrimSpace(message.Content) == "" && len(message.Attachments) == 0 {
+			problem("content", "is required")
+		} else if utf8.RuneCountInString(message.Content) > MaxContentLength {
+			problem("content", "must be at most %d characters", MaxContentLength)
+		}
+		if len(message.Attachments) > MaxAttachments {
+			problem("attachments", "must have at most %d entries", MaxAttachments)
+		}
+		for i, attachment := range message.Attachments {
+			field := fmt.Sprintf("attachments[%d]", i)
+			switch {
+			case (attachment.UploadID == "") == (len(attachment.Data) == 0):
+				problem(field, "must have either data or upload_id")
+			case attachment.UploadID != "" && !messageIDPattern.MatchString(attachment.UploadID):
+				problem(field+".upload_id", "is not a valid upload id")
+			}
+			if len(attachment.Name) > maxMetadataValue {
+				problem(field+".name", "must be at most %d bytes", maxMetadataValue)
+			}
+		}
+		if len(message.Metadata) > maxMetadataEntries {
+			problem("metadata", "must have at most %d entries", maxMetadataEntries)
+		}
+		for _, key := range stringMetadata {
+			value, present := message.Metadata[key]
+			if !present {
+				continue
+			}
+			if text, ok := value.(string); !ok {
+				problem("metadata."+key, "must be a string")
+			} else if len(text) > maxMetadataValue {
+				problem("metadata."+key, "must be at most %d bytes", maxMetadataValue)
+			}
+		}
+		if value, present := message.Metadata["resumable"]; present {
+			if _, ok := value.(bool); !ok {
+				problem("metadata.resumable", "must be a boolean")
+			}
+		}
+		if variables, present := message.Metadata["variables"]; present {
+			if _, ok := variables.(map[string]any); !ok {
+				problem("metadata.variables", "must be an object")
+			}
+		}
+		if value, present := message.Metadata["time_range"]; present {
+			if message.MetadataString("video_id") == "" {
+				problem("metadata.time_range", "requires metadata.video_id")
+			}
+			if _, _, err := timeRange(value); err != "" {
+				problem("metadata.time_range", "%s", err)
+			}
+		}
+	case TypeCancel, TypeResume:
+		if message.MessageID == "" {
+			problem("message_id", "is required")
+		}
+		if message.Attachments != nil {
+			problem("attachments", "are only allowed on chat messages")
+		}
+		if message.LastSeq < 0 {
+			problem("last_seq", "must not be negative")
+		}
+	case "":
+		problem("type", "is required")
+	default:
+		return newError(CodeUnsupportedType, "unsupported message type %q", message.Type)
+	}
+
+	if message.Seq != 0 || message.Cached || message.Tool != nil || message.Error != nil || message.Usage != nil || message.FinishReason != "" || message.SafetyRatings != nil {
+		problem("type", "%q messages may only set type, message_id, content, metadata and attachments", message.Type)
+	}
+	if message.LastSeq != 0 && message.Type != TypeResume {
+		problem("last_seq", "is only allowed on resume messages")
+	}
+
+	if len(problems) > 0 {
+		err := newError(CodeValidationFailed, "invalid %s message", message.Type)
+		err.Fields = problems
+		return err
+	}
+	return nil
+}
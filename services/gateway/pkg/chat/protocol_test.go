@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMessageAcceptsValidMessages(t *testing.T) {
+	for _, raw := range []string{
+		`{"type":"chat","content":"What is entropy?"}`,
+		`{"type":"chat","content":"hi","message_id":"msg_1","metadata":{"conversation_id":"c1","extra":3}}`,
+		`{"type":"cancel","message_id":"msg_1"}`,
+		`{"type":"resume","message_id":"msg_1","last_seq":12}`,
+		`{"type":"chat","content":"hi","metadata":{"video_id":"v1","time_range":{"start":60,"end":90.5}}}`,
+		`{"type":"chat","attachments":[{"data":"aGVsbG8=","name":"notes.txt"},{"upload_id":"up_1"}]}`,
+	} {
+		if _, err := DecodeMessage([]byte(raw)); err != nil {
+			t.Errorf("DecodeMessage(%s) = %v", raw, err)
+		}
+	}
+}
+
+func TestDecodeMessageRejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		raw   string
+		code  ErrorCode
+		field string
+	}{
+		{`{"type":"chat","content":`, CodeMalformedMessage, ""},
+		{`{"type":"chat","content":"hi","messageId":"m"}`, CodeMalformedMessage, ""},
+		{`{"type":"subscribe"}`, CodeUnsupportedType, ""},
+		{`{"content":"hi"}`, CodeValidationFailed, "type"},
+		{`{"type":"chat","content":"  "}`, CodeValidationFailed, "content"},
+		{`{"type":"chat","content":"` + strings.Repeat("a", MaxContentLength+1) + `"}`, CodeValidationFailed, "content"},
+		{`{"type":"chat","content":"hi","message_id":"bad id"}`, CodeValidationFailed, "message_id"},
+		{`{"type":"chat","content":"hi","metadata":{"model":42}}`, CodeValidationFailed, "metadata.model"},
+		{`{"type":"chat","content":"hi","metadata":{"resumable":"yes"}}`, CodeValidationFailed, "metadata.resumable"},
+		{`{"type":"chat","content":"hi","seq":3}`, CodeValidationFailed, "type"},
+		{`{"type":"chat","content":"hi","metadata":{"video_id":"v1","time_range":{"start":90,"end":60}}}`, CodeValidationFailed, "metadata.time_range"},
+		{`{"type":"chat","content":"hi","metadata":{"time_range":{"start":0}}}`, CodeValidationFailed, "metadata.time_range"},
+		{`{"type":"cancel"}`, CodeValidationFailed, "message_id"},
+		{`{"type":"resume","last_seq":3}`, CodeValidationFailed, "message_id"},
+		{`{"type":"chat","content":"hi","last_seq":3}`, CodeValidationFailed, "last_seq"},
+		{`{"type":"chat","attachments":[{"data":"aGVsbG8=","upload_id":"up_1"}]}`, CodeValidationFailed, "attachments[0]"},
+		{`{"type":"chat","content":"hi","attachments":[{"data":"not base64!"}]}`, CodeMalformedMessage, ""},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeMessage([]byte(tt.raw))
+		if err == nil {
+			t.Errorf("DecodeMessage(%.60s) accepted an invalid message", tt.raw)
+			continue
+		}
+		if err.Code != tt.code {
+			t.Errorf("DecodeMessage(%.60s) code = %d, want %d", tt.raw, err.Code, tt.code)
+		}
+		if tt.field != "" && (len(err.Fields) == 0 || err.Fields[0].Field != tt.field) {
+			t.Errorf("DecodeMessage(%.60s) fields = %+v, want %s", tt.raw, err.Fields, tt.field)
+		}
+	}
+}
+
+func TestNegotiateSubprotocol(t *testing.T) {
+	tests := []struct {
+		offered []string
+		ok      bool
+	}{
+		{nil, true},
+		{[]string{"bearer", "bearer.token"}, true},
+		{[]string{"zephyr.chat.v2", Subprotocol}, true},
+		{[]string{"zephyr.chat.v2"}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := NegotiateSubprotocol(tt.offered); ok != tt.ok {
+			t.Errorf("NegotiateSubprotocol(%v) ok = %v, want %v", tt.offered, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// pkg/chat/resume.go
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/replay"
+)
+
+// resumeWait bounds each wait of a resumed stream for its next frame, after
+// which the buffer is asked again and reports if the stream expired.
+const resumeWait = 5 * time.Second
+
+// bufferTimeout bounds each write to the replay buffer.
+const bufferTimeout = 5 * time.Second
+
+// generationKey identifies a generation across connections. message_ids
+// are chosen by clients, so they are only unique per user.
+func generationKey(user, messageID string) string {
+	return user + "\x00" + messageID
+}
+
+// track registers a resumable generation. It reports false if the user
+// already runs one with the same message_id, on any connection.
+func (s *Service) track(key string, cancel context.CancelCauseFunc) bool {
+	if s.Replay == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.running[key]; exists {
+		return false
+	}
+	if s.running == nil {
+		s.running = make(map[string]context.CancelCauseFunc)
+	}
+	s.running[key] = cancel
+	return true
+}
+
+func (s *Service) untrack(key string) {
+	s.mu.Lock()
+	delete(s.running, key)
+	s.mu.Unlock()
+}
+
+// cancelRunning cancels a resumable generation running on this replica,
+// reporting whether there was one.
+func (s *Service) cancelRunning(key string, cause error) bool {
+	s.mu.Lock()
+	cancel, ok := s.running[key]
+	s.mu.Unlock()
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+// Shutdown waits for the generations of clients that went away to finish
+// into the replay buffer. Those still running once ctx is done are cut
+// short, and clients resuming them are told so.
+func (s *Service) Shutdown(ctx context.Context) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	done := ctx.Done()
+	for {
+		s.mu.Lock()
+		running := len(s.running)
+		s.mu.Unlock()
+		if running == 0 {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			done = nil
+			s.mu.Lock()
+			for _, cancel := range s.running {
+				cancel(ErrSessionClosed)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// recorder buffers the frames of a generation while passing them to the
+// client. Once the client is gone frames are only buffered, and the
+// generation carries on for the client to resume. Frames are appended to the
+// buffer in the background, in batches of those that queued up meanwhile,
+// so a slow buffer does not hold up the generation.
+type recorder struct {
+	buffer    replay.Buffer
+	key       string
+	messageID string
+	conn      MessageWriter
+
+	seq   int64
+	final bool
+
+	mu       sync.Mutex
+	pending  []replay.Frame
+	flushing bool
+	flushed  sync.WaitGroup
+}
+
+func (r *recorder) WriteJSON(v interface{}) error {
+	message, ok := v.(Message)
+	if !ok || message.Seq == 0 {
+		return r.conn.WriteJSON(v)
+	}
+	r.record(message)
+	// A failed write is caught up on by resuming
+	r.conn.WriteJSON(v)
+	return nil
+}
+
+func (r *recorder) record(message Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to encode frame %d of message %s: %v", message.Seq, r.messageID, err)
+		return
+	}
+	r.seq = message.Seq
+	r.final = message.Type == TypeComplete || message.Type == TypeCancelled || message.Type == TypeError
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, replay.Frame{Seq: message.Seq, Data: data, Final: r.final})
+	if !r.flushing {
+		r.flushing = true
+		r.flushed.Add(1)
+		go r.flush()
+	}
+}
+
+// flush appends the pending frames until none are left.
+func (r *recorder) flush() {
+	defer r.flushed.Done()
+	for {
+		r.mu.Lock()
+		frames := r.pending
+		r.pending = nil
+		if len(frames) == 0 {
+			r.flushing = false
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), bufferTimeout)
+		if err := r.buffer.Append(ctx, r.key, frames...); err != nil {
+			log.Printf("Failed to buffer frames of message %s: %v", r.messageID, err)
+		}
+		cancel()
+	}
+}
+
+// close ends a stream the generation left without a final frame, as when
+// its session closed, so resumed clients stop waiting for one, and waits
+// for the frames to be buffered.
+func (r *recorder) close() {
+	if r.seq != 0 && !r.final {
+		interrupted := errorMessage(r.messageID, newError(CodeStreamInterrupted, "Response was interrupted before it finished"))
+		interrupted.Seq = r.seq + 1
+		r.record(interrupted)
+	}
+	r.flushed.Wait()
+}
+
+// resume sends the frames of a generation after the client's last seq and
+// then follows it live until its final frame. The generation may run on
+// this connection, an earlier one or, with a shared buffer, another
+// replica.
+func (s *Session) resume(message Message) error {
+	buffer := s.service.Replay
+	if buffer == nil {
+		metrics.Resumes.WithLabelValues("disabled").Inc()
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeStreamNotResumable, "This server does not keep streams to resume")))
+	}
+	key := generationKey(s.userFor(message), message.MessageID)
+	frames, err := buffer.Read(s.ctx, key, message.LastSeq, 0)
+	if err != nil {
+		return s.writer.WriteJSON(errorMessage(message.MessageID, notResumable(err)))
+	}
+
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	s.mu.Lock()
+	if s.idle != nil {
+		s.mu.Unlock()
+		cancel(nil)
+		return s.writer.WriteJSON(shutdownRejection(message.MessageID))
+	}
+	_, generating := s.active[message.MessageID]
+	if _, following := s.following[message.MessageID]; following || generating {
+		s.mu.Unlock()
+		cancel(nil)
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeDuplicateMessageID, "This message_id is already streaming on this connection")))
+	}
+	if s.following == nil {
+		s.following = make(map[string]context.CancelCauseFunc)
+	}
+	s.following[message.MessageID] = cancel
+	s.wg.Add(1)
+	s.mu.Unlock()
+	metrics.Resumes.WithLabelValues("resumed").Inc()
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.following, message.MessageID)
+			s.mu.Unlock()
+			cancel(nil)
+		}()
+		s.follow(ctx, key, message.MessageID, message.LastSeq, frames)
+	}()
+	return nil
+}
+
+// follow writes frames, read after seq, and then those that follow them
+// until the final one.
+func (s *Session) follow(ctx context.Context, key, messageID string, after int64, frames []replay.Frame) {
+	for {
+		for _, frame := range frames {
+			var message Message
+			if err := json.Unmarshal(frame.Data, &message); err != nil {
+				log.Printf("Failed to decode buffered frame %d of message %s: %v", frame.Seq, messageID, err)
+				return
+			}
+			if err := s.writer.WriteContext(ctx, message); err != nil || frame.Final || ctx.Err() != nil {
+				return
+			}
+			after = frame.Seq
+		}
+
+		var err error
+		frames, err = s.service.Replay.Read(ctx, key, after, resumeWait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.writer.WriteContext(ctx, errorMessage(messageID, notResumable(err)))
+			return
+		}
+	}
+}
+
+// notResumable maps a failed buffer read to the error sent to the client.
+func notResumable(err error) *Error {
+	switch {
+	case errors.Is(err, replay.ErrNotFound):
+		metrics.Resumes.WithLabelValues("not_found").Inc()
+		return newError(CodeStreamNotResumable, "No stream to resume with this message_id; it finished too long ago or never started")
+	case errors.Is(err, replay.ErrTruncated):
+		metrics.Resumes.WithLabelValues("truncated").Inc()
+		return newError(CodeStreamNotResumable, "The frames after last_seq are no longer buffered; send the message again")
+	default:
+		log.Printf("Failed to read buffered stream: %v", err)
+		metrics.Resumes.WithLabelValues("error").Inc()
+		return newError(CodeInternal, "Failed to resume the stream")
+	}
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/replay"
+)
+
+// channelWriter hands frames to the test as they are written.
+type channelWriter chan Message
+
+func (w channelWriter) WriteJSON(v interface{}) error {
+	w <- v.(Message)
+	return nil
+}
+
+func (w channelWriter) next(t *testing.T) Message {
+	t.Helper()
+	select {
+	case frame := <-w:
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame within 5s")
+		return Message{}
+	}
+}
+
+// resumable is the metadata of chats that keep generating after a
+// disconnect.
+var resumable = map[string]any{"resumable": true}
+
+func newResumableService(words int) *Service {
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewScriptedProvider(llm.Script{Default: strings.Repeat("word ", words), TokenDelayMs: 5}))
+	return &Service{Providers: providers, Replay: replay.NewMemoryBuffer(time.Minute, 0)}
+}
+
+func TestResumeAfterReconnect(t *testing.T) {
+	service := newResumableService(40)
+	ctx := context.Background()
+
+	first := make(channelWriter, 1000)
+	session := service.NewSession(ctx, first, "10.0.0.1")
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on", Metadata: resumable})
+	var text strings.Builder
+	var lastSeq int64
+	for lastSeq < 4 {
+		frame := first.next(t)
+		text.WriteString(frame.Content)
+		lastSeq = frame.Seq
+	}
+	// The connection drops mid-answer and the answer keeps generating
+	session.Detach()
+
+	other := make(channelWriter, 10)
+	stranger := service.NewSession(ctx, other, "10.0.0.2")
+	defer stranger.Close()
+	stranger.HandleMessage(Message{Type: TypeResume, MessageID: "m1", LastSeq: lastSeq})
+	if frame := other.next(t); frame.Error == nil || frame.Error.Code != CodeStreamNotResumable {
+		t.Errorf("another user resumed the stream: %+v", frame)
+	}
+
+	second := make(channelWriter, 1000)
+	resumed := service.NewSession(ctx, second, "10.0.0.1")
+	defer resumed.Close()
+	resumed.HandleMessage(Message{Type: TypeResume, MessageID: "m1", LastSeq: lastSeq})
+	for {
+		frame := second.next(t)
+		if frame.Seq != lastSeq+1 {
+			t.Fatalf("resumed with seq %d after %d", frame.Seq, lastSeq)
+		}
+		lastSeq = frame.Seq
+		text.WriteString(frame.Content)
+		if frame.Type == TypeComplete {
+			break
+		}
+	}
+	if want := strings.TrimSpace(strings.Repeat("word ", 40)); strings.TrimSpace(text.String()) != want {
+		t.Errorf("answer across connections = %q", text.String())
+	}
+
+	resumed.HandleMessage(Message{Type: TypeResume, MessageID: "unknown"})
+	if frame := second.next(t); frame.Error == nil || frame.Error.Code != CodeStreamNotResumable {
+		t.Errorf("resume of an unknown stream = %+v", frame)
+	}
+}
+
+func TestCancelResumedGeneration(t *testing.T) {
+	service := newResumableService(400)
+	ctx := context.Background()
+
+	first := make(channelWriter, 1000)
+	session := service.NewSession(ctx, first, "10.0.0.1")
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on", Metadata: resumable})
+	first.next(t)
+	session.Detach()
+
+	second := make(channelWriter, 1000)
+	resumed := service.NewSession(ctx, second, "10.0.0.1")
+	defer resumed.Close()
+	resumed.HandleMessage(Message{Type: TypeResume, MessageID: "m1", LastSeq: 1})
+	second.next(t)
+	resumed.HandleMessage(Message{Type: TypeCancel, MessageID: "m1"})
+	for {
+		frame := second.next(t)
+		if frame.Type == TypeCancelled {
+			break
+		}
+		if frame.Type != TypeToken {
+			t.Fatalf("stream ended with %+v, want cancelled", frame)
+		}
+	}
+
+	// Once finished the generation is no longer running anywhere
+	shutdown, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	service.Shutdown(shutdown)
+	if shutdown.Err() != nil {
+		t.Error("the cancelled generation kept running")
+	}
+}
+
+func TestDetachCancelsUnlessResumable(t *testing.T) {
+	service := newResumableService(400)
+	ctx := context.Background()
+
+	first := make(channelWriter, 1000)
+	session := service.NewSession(ctx, first, "10.0.0.1")
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on"})
+	first.next(t)
+	session.Detach()
+
+	// Nobody asked to resume it, so it stops as if the session closed
+	shutdown, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	service.Shutdown(shutdown)
+	if shutdown.Err() != nil {
+		t.Error("a generation nobody will resume kept running")
+	}
+}
@@ -0,0 +1,507 @@
+// pkg/chat/service.go
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/assistant"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/attachment"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/cache"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/history"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/lecture"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/memory"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/prompt"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/ratelimit"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/replay"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/tools"
+)
+
+// Service turns chat messages into provider requests and streams the
+// replies back to the client.
+type Service struct {
+	Providers *llm.Registry
+	// Memory stores multi-turn history. A nil Memory makes every message a
+	// standalone, single-turn request.
+	Memory memory.Store
+	// HistoryTokenBudget bounds the estimated tokens of replayed history,
+	// including the new message.
+	HistoryTokenBudget int
+	// MaxConcurrentGenerations limits the generations a single connection
+	// may run at once. Zero means DefaultMaxConcurrentGenerations.
+	MaxConcurrentGenerations int
+	// Limiter enforces per-user and per-IP rates and token quotas. A nil
+	// Limiter disables them.
+	Limiter *ratelimit.Limiter
+	// Generation returns the sampling parameters for a provider and model.
+	// It is consulted per request so reloaded defaults apply immediately. A
+	// nil Generation uses llm.DefaultGenerationConfig.
+	Generation func(provider, model string) llm.GenerationConfig
+	// Assistants are the subject-specialized personas chats can address
+	// with metadata.assistant. A nil Assistants sends raw user text with no
+	// system instruction.
+	Assistants *assistant.Registry
+	// Classifier picks an assistant for chats that do not name one. A nil
+	// Classifier sends them to the default assistant.
+	Classifier assistant.Classifier
+	// Prompts holds the templates assistants render their system prompt
+	// from.
+	Prompts *prompt.Library
+	// Cache answers repeated single-turn questions without calling the
+	// provider. A nil Cache disables it.
+	Cache *cache.Cache
+	// Tools are offered to models that support function calling, limited
+	// to the tools the chat's assistant lists. A nil Tools disables tool
+	// calling.
+	Tools *tools.Registry
+	// MaxToolRounds bounds the tool rounds of one generation. Zero means
+	// DefaultMaxToolRounds.
+	MaxToolRounds int
+	// Lectures grounds chats that name a metadata.video_id in that video's
+	// frames. A nil Lectures rejects such chats.
+	Lectures lecture.Retriever
+	// AttachmentLimits bound inline attachments. Uploads were checked
+	// against the same limits when they were taken.
+	AttachmentLimits attachment.Limits
+	// Uploads resolves attachments sent by upload_id. A nil Uploads rejects
+	// them.
+	Uploads attachment.Store
+	// History persists conversations for users to list and export later,
+	// and restores their turns once Memory has forgotten them. A nil
+	// History keeps conversations only as long as Memory does.
+	History history.Repository
+	// Replay buffers the frames of every generation so a client that loses
+	// its connection can resume the answer, which keeps generating while it
+	// is away. A nil Replay ends generations with their connection.
+	Replay replay.Buffer
+	// SendQueue bounds the frames waiting for each client and says what
+	// happens to clients that read too slowly to keep up.
+	SendQueue SendQueue
+
+	mu sync.Mutex
+	// running are the resumable generations on this replica by
+	// generationKey, for resumed clients to cancel.
+	running map[string]context.CancelCauseFunc
+}
+
+func (s *Service) maxConcurrentGenerations() int {
+	if s.MaxConcurrentGenerations > 0 {
+		return s.MaxConcurrentGenerations
+	}
+	return DefaultMaxConcurrentGenerations
+}
+
+func (s *Service) generationConfig(provider, model string) llm.GenerationConfig {
+	if s.Generation != nil {
+		return s.Generation(provider, model)
+	}
+	return llm.DefaultGenerationConfig()
+}
+
+// assistantFor returns the assistant a chat is addressed to and how it was
+// chosen: "requested", "classified" or "default". It returns a nil
+// assistant when none are configured.
+func (s *Service) assistantFor(ctx context.Context, message Message) (*assistant.Assistant, string, error) {
+	if s.Assistants == nil {
+		return nil, "", nil
+	}
+	if id := message.MetadataString("assistant"); id != "" {
+		a, err := s.Assistants.Get(id)
+		return a, "requested", err
+	}
+	if s.Classifier != nil {
+		if id, ok := s.Classifier.Classify(ctx, message.Content); ok {
+			if a, err := s.Assistants.Get(id); err == nil {
+				return a, "classified", nil
+			}
+		}
+	}
+	a, err := s.Assistants.Get("")
+	return a, "default", err
+}
+
+// systemInstruction renders the system prompt of spec for message, from
+// its template if it has one. The template is nil for inline prompts.
+func (s *Service) systemInstruction(spec *assistant.Assistant, message Message) (string, *prompt.Template, *Error) {
+	if spec.Template == "" {
+		return spec.SystemInstruction(), nil, nil
+	}
+	if s.Prompts == nil {
+		return "", nil, newError(CodeInternal, "Assistant %q needs prompt templates, which are not configured", spec.ID)
+	}
+	t, err := s.Prompts.Get(spec.Template, spec.TemplateVersion)
+	if err != nil {
+		log.Printf("Assistant %s: %v", spec.ID, err)
+		return "", nil, newError(CodeInternal, "Assistant %q is misconfigured", spec.ID)
+	}
+
+	variables := make(map[string]any, len(spec.Variables))
+	for name, value := range spec.Variables {
+		variables[name] = value
+	}
+	if chatVariables, ok := message.Metadata["variables"].(map[string]any); ok {
+		for name, value := range chatVariables {
+			variables[name] = value
+		}
+	}
+
+	text, err := t.Render(variables)
+	var invalid prompt.VariablesError
+	switch {
+	case errors.As(err, &invalid):
+		rejection := newError(CodeValidationFailed, "invalid variables for %s", t.Ref())
+		for _, problem := range invalid {
+			rejection.Fields = append(rejection.Fields, FieldError{
+				Field:   "metadata.variables." + problem.Variable,
+				Problem: problem.Problem,
+			})
+		}
+		return "", nil, rejection
+	case err != nil:
+		log.Printf("Assistant %s: %v", spec.ID, err)
+		return "", nil, newError(CodeInternal, "Failed to build the prompt for assistant %q", spec.ID)
+	}
+	return spec.WithOutputRules(text), t, nil
+}
+
+// owner returns the user a message is sent by. Trusted backends send
+// messages on behalf of the user named in metadata.user_id, whose uploads
+// and conversations they use.
+func owner(ctx context.Context, message Message) string {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if user := message.MetadataString("user_id"); user != "" && identity.HasRole(ServiceRole) {
+		return user
+	}
+	return identity.UserID
+}
+
+// conversationKey identifies a conversation in Memory. conversation_ids are
+// chosen by clients, so they are only unique per owner.
+func conversationKey(owner, conversationID string) string {
+	return owner + "\x00" + conversationID
+}
+
+// attachmentParts prepares the attachments of message for the model. Each
+// also gets a note standing in for it in conversation history, which keeps
+// text only. The returned error is ready to be sent back.
+func (s *Service) attachmentParts(ctx context.Context, message Message) (parts []llm.Part, notes []string, rejection *Error) {
+	var problems []FieldError
+	for i, a := range message.Attachments {
+		field := fmt.Sprintf("attachments[%d]", i)
+		name := a.Name
+		var blob *llm.Blob
+		if a.UploadID != "" {
+			if s.Uploads == nil {
+				problems = append(problems, FieldError{Field: field + ".upload_id", Problem: "uploads are not enabled"})
+				continue
+			}
+			upload, err := attachment.Lookup(ctx, s.Uploads, a.UploadID, owner(ctx, message))
+			if errors.Is(err, attachment.ErrNotFound) {
+				problems = append(problems, FieldError{Field: field + ".upload_id", Problem: "is unknown or has expired"})
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to load upload %s for message %s: %v", a.UploadID, message.MessageID, err)
+				return nil, nil, newError(CodeInternal, "Failed to load the attachment")
+			}
+			blob = &upload.Blob
+			if name == "" {
+				name = upload.Name
+			}
+		} else {
+			var err error
+			if blob, err = attachment.Prepare(a.Data, s.AttachmentLimits); err != nil {
+				problems = append(problems, FieldError{Field: field, Problem: err.Error()})
+				continue
+			}
+		}
+
+		parts = append(parts, llm.Part{InlineData: blob})
+		note := "[Attached " + blob.MIMEType
+		if name != "" {
+			note += ": " + name
+		}
+		notes = append(notes, note+"]")
+	}
+	if len(problems) > 0 {
+		rejection = newError(CodeValidationFailed, "invalid attachments")
+		rejection.Fields = problems
+		return nil, nil, rejection
+	}
+	return parts, notes, nil
+}
+
+// lectureContext retrieves the parts of the video a chat asks about. The
+// returned error is ready to be sent back.
+func (s *Service) lectureContext(ctx context.Context, message Message) (*lecture.Context, *Error) {
+	videoID := message.MetadataString("video_id")
+	if s.Lectures == nil {
+		rejection := newError(CodeValidationFailed, "lecture videos are not available")
+		rejection.Fields = []FieldError{{Field: "metadata.video_id", Problem: "is not supported by this gateway"}}
+		return nil, rejection
+	}
+
+	start, end := message.TimeRange()
+	grounding, err := s.Lectures.Retrieve(ctx, lecture.Query{Text: message.Content, VideoID: videoID, Start: start, End: end})
+	switch {
+	case errors.Is(err, lecture.ErrVideoNotFound):
+		return nil, newError(CodeUnknownVideo, "unknown video %q", videoID)
+	case errors.Is(err, lecture.ErrVideoNotReady):
+		return nil, newError(CodeVideoNotReady, "Video %q is still being processed, try again once it is complete", videoID)
+	case err != nil:
+		log.Printf("Failed to retrieve video %s for message %s: %v", videoID, message.MessageID, err)
+		return nil, newError(CodeInternal, "Failed to load the lecture video")
+	}
+	return grounding, nil
+}
+
+// HandleChat streams a reply to message from its assistant, using the
+// provider and model named in its metadata or else the assistant's, falling
+// back to the deployment default. Messages carrying a conversation_id are
+// answered with the prior turns of that conversation and saved to its
+// history, and messages carrying a video_id with excerpts of that lecture,
+// whose timestamps the answer cites. The reply is nil if no generation was
+// started.
+func (s *Service) HandleChat(ctx context.Context, conn MessageWriter, message Message) (*Reply, error) {
+	spec, routing, err := s.assistantFor(ctx, message)
+	if err != nil {
+		return nil, conn.WriteJSON(errorMessage(message.MessageID, newError(CodeUnknownAssistant, "%v", err)))
+	}
+
+	providerName, model := message.MetadataString("provider"), message.MetadataString("model")
+	if spec != nil && providerName == "" {
+		providerName = spec.Provider
+	}
+	if spec != nil && model == "" {
+		model = spec.Model
+	}
+
+	provider, err := s.Providers.Get(providerName)
+	if err != nil {
+		return nil, conn.WriteJSON(errorMessage(message.MessageID, newError(CodeUnknownProvider, "%v", err)))
+	}
+
+	attachments, notes, rejection := s.attachmentParts(ctx, message)
+	if rejection != nil {
+		return nil, conn.WriteJSON(errorMessage(message.MessageID, rejection))
+	}
+	if len(attachments) > 0 && !provider.Capabilities().Vision {
+		return nil, conn.WriteJSON(errorMessage(message.MessageID, newError(CodeAttachmentsUnsupported,
+			"Provider %s cannot read attachments; send the message without them or choose a provider with vision", provider.Name())))
+	}
+
+	// History keeps notes in place of the files, which would be resent and
+	// stored with every later turn
+	userTurn := llm.Content{Role: llm.RoleUser}
+	historyTurn := llm.Content{Role: llm.RoleUser}
+	userTurn.Parts = append(userTurn.Parts, attachments...)
+	for _, note := range notes {
+		historyTurn.Parts = append(historyTurn.Parts, llm.Part{Text: note})
+	}
+	if message.Content != "" {
+		userTurn.Parts = append(userTurn.Parts, llm.Part{Text: message.Content})
+		historyTurn.Parts = append(historyTurn.Parts, llm.Part{Text: message.Content})
+	}
+	conversationID := message.MetadataString("conversation_id")
+
+	contents := []llm.Content{userTurn}
+	if len(message.History) > 0 {
+		contents = memory.Trim(append(message.History[:len(message.History):len(message.History)], userTurn), s.HistoryTokenBudget)
+	} else if conversationID != "" && s.Memory != nil {
+		turns := s.conversationTurns(ctx, conversationID, owner(ctx, message))
+		contents = memory.Trim(append(turns, userTurn), s.HistoryTokenBudget)
+	}
+
+	req := llm.Request{
+		Model:    model,
+		Contents: contents,
+		Config:   s.generationConfig(provider.Name(), model),
+	}
+	var metadata map[string]any
+	if spec != nil {
+		instruction, template, rejection := s.systemInstruction(spec, message)
+		if rejection != nil {
+			return nil, conn.WriteJSON(errorMessage(message.MessageID, rejection))
+		}
+		req.SystemInstruction = instruction
+		req.Config = spec.Generation.Apply(req.Config)
+		if s.Tools != nil && provider.Capabilities().Tools {
+			req.Tools = s.Tools.Declarations(spec.Tools)
+		}
+		metadata = map[string]any{"assistant": spec.ID, "routing": routing}
+
+		promptRef := "inline"
+		if template != nil {
+			promptRef = template.Ref()
+			metadata["template"] = template.ID
+			metadata["template_version"] = template.Version
+		}
+		log.Printf("Generating %s with assistant %s (%s), prompt %s, provider %s",
+			message.MessageID, spec.ID, routing, promptRef, provider.Name())
+	}
+	if message.Instructions != "" {
+		req.SystemInstruction = strings.TrimSpace(req.SystemInstruction + "\n\n" + message.Instructions)
+	}
+	if message.Generation != nil {
+		req.Config = message.Generation.Apply(req.Config)
+	}
+
+	opts := StreamOptions{Metadata: metadata, Tools: s.Tools, MaxToolRounds: s.MaxToolRounds}
+	if videoID := message.MetadataString("video_id"); videoID != "" {
+		grounding, rejection := s.lectureContext(ctx, message)
+		if rejection != nil {
+			return nil, conn.WriteJSON(errorMessage(message.MessageID, rejection))
+		}
+		req.SystemInstruction = strings.TrimSpace(req.SystemInstruction + "\n\n" + grounding.Prompt())
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]any)
+		}
+		opts.Metadata["video_id"] = videoID
+		opts.Annotate = func(text string) map[string]any {
+			return map[string]any{"citations": grounding.Citations(text)}
+		}
+	}
+	reply, err := s.generate(ctx, conn, provider, req, message, spec, opts)
+	if conversationID != "" && s.Memory != nil && reply.Complete {
+		modelTurn := llm.Content{Role: llm.RoleModel, Parts: []llm.Part{{Text: reply.Text}}}
+		if appendErr := s.Memory.Append(ctx, conversationKey(owner(ctx, message), conversationID), historyTurn, modelTurn); appendErr != nil {
+			log.Printf("Failed to save conversation %s: %v", conversationID, appendErr)
+		}
+	}
+	if conversationID != "" && s.History != nil && reply.Complete {
+		metadata := opts.completeMetadata(map[string]any{"provider": provider.Name()}, reply.Text)
+		if model != "" {
+			metadata["model"] = model
+		}
+		if saveErr := s.persist(ctx, owner(ctx, message), conversationID, message.MessageID, historyTurn, reply.Text, metadata); saveErr != nil {
+			// The answer already streamed, so the client is told it was not kept
+			conn.WriteJSON(errorMessage(message.MessageID, newError(CodeInternal, "The answer was not saved to conversation history")))
+			err = errors.Join(err, saveErr)
+		}
+	}
+	return reply, err
+}
+
+// conversationTurns returns the earlier turns of a conversation from
+// Memory, or restores them from History when Memory has forgotten them.
+func (s *Service) conversationTurns(ctx context.Context, conversationID, owner string) []llm.Content {
+	key := conversationKey(owner, conversationID)
+	turns, err := s.Memory.History(ctx, key)
+	if err != nil {
+		log.Printf("Failed to load conversation %s: %v", conversationID, err)
+	}
+	if len(turns) > 0 || s.History == nil {
+		return turns
+	}
+
+	conversation, err := s.History.GetConversation(ctx, owner, conversationID)
+	if errors.Is(err, history.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to restore conversation %s: %v", conversationID, err)
+		return nil
+	}
+	for _, m := range conversation.Messages {
+		role := llm.RoleUser
+		if m.Role == history.RoleAssistant {
+			role = llm.RoleModel
+		}
+		turns = append(turns, llm.Content{Role: role, Parts: []llm.Part{{Text: m.Content}}})
+	}
+	// Later turns are appended to Memory, so it needs the earlier ones too
+	if len(turns) > 0 {
+		if err := s.Memory.Append(ctx, key, turns...); err != nil {
+			log.Printf("Failed to restore conversation %s: %v", conversationID, err)
+		}
+	}
+	return turns
+}
+
+// persist saves a completed exchange to History.
+func (s *Service) persist(ctx context.Context, owner, conversationID, messageID string, userTurn llm.Content, answer string, metadata map[string]any) error {
+	var question []string
+	for _, part := range userTurn.Parts {
+		question = append(question, part.Text)
+	}
+	err := s.History.Append(ctx, owner, conversationID,
+		history.Message{Role: history.RoleUser, Content: strings.Join(question, "\n"), MessageID: messageID},
+		history.Message{Role: history.RoleAssistant, Content: answer, MessageID: messageID, Metadata: metadata},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to persist conversation %s: %w", conversationID, err)
+	}
+	return nil
+}
+
+// generate answers req from the response cache when it can and from the
+// provider otherwise, caching complete answers. Only single-turn chats are
+// cached, since an answer that depends on earlier turns or attachments
+// cannot be reused, and answers that called tools are not, since tool
+// results such as the date go stale.
+func (s *Service) generate(ctx context.Context, conn MessageWriter, provider llm.Provider, req llm.Request, message Message, spec *assistant.Assistant, opts StreamOptions) (*Reply, error) {
+	if s.Cache == nil || len(req.Contents) != 1 || len(message.Attachments) > 0 || (spec != nil && spec.NoCache) {
+		return StreamResponse(ctx, conn, provider, req, message.MessageID, opts)
+	}
+
+	key := cache.Request{
+		Prompt:            message.Content,
+		SystemInstruction: req.SystemInstruction,
+		Provider:          provider.Name(),
+		Model:             req.Model,
+		Config:            req.Config,
+	}
+	if spec != nil {
+		key.Assistant = spec.ID
+	}
+	lookup, err := s.Cache.Lookup(ctx, key)
+	switch {
+	case err != nil:
+		log.Printf("Response cache for message %s: %v", message.MessageID, err)
+		metrics.CacheLookups.WithLabelValues("error").Inc()
+	case lookup.Entry == nil:
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+	default:
+		metrics.CacheLookups.WithLabelValues(lookup.Match).Inc()
+		cached := map[string]any{"cache": lookup.Match}
+		if lookup.Match == cache.MatchSemantic {
+			cached["similarity"] = math.Round(lookup.Similarity*1000) / 1000
+		}
+		for k, v := range opts.Metadata {
+			cached[k] = v
+		}
+		replay := opts
+		replay.Metadata = cached
+		return ReplayResponse(ctx, conn, lookup.Entry, message.MessageID, replay)
+	}
+
+	reply, err := StreamResponse(ctx, conn, provider, req, message.MessageID, opts)
+	// Answers cut short by the token limit or blocked are not worth reusing
+	if reply.Complete && reply.ToolCalls == 0 && strings.EqualFold(reply.FinishReason, "stop") {
+		entry := &cache.Entry{
+			Text:         reply.Text,
+			FinishReason: reply.FinishReason,
+			Provider:     provider.Name(),
+			Usage: llm.Usage{
+				PromptTokens: reply.PromptTokens,
+				OutputTokens: reply.OutputTokens,
+				TotalTokens:  reply.PromptTokens + reply.OutputTokens,
+			},
+		}
+		if storeErr := lookup.Store(ctx, entry); storeErr != nil {
+			log.Printf("Response cache for message %s: %v", message.MessageID, storeErr)
+		}
+	}
+	return reply, err
+}
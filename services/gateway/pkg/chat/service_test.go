@@ -0,0 +1,301 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/attachment"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/cache"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/history"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/lecture"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/memory"
+)
+
+func TestHandleChatReplaysCachedAnswer(t *testing.T) {
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewEchoProvider())
+	service := &Service{
+		Providers: providers,
+		Cache:     &cache.Cache{Backend: cache.NewMemoryBackend(10), TTL: time.Minute},
+	}
+
+	first := &recordingWriter{}
+	if _, err := service.HandleChat(context.Background(), first, Message{Type: TypeChat, MessageID: "a", Content: "What is 2+2?"}); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	for _, msg := range first.messages {
+		if msg.Cached {
+			t.Fatalf("first answer marked cached: %+v", msg)
+		}
+	}
+
+	second := &recordingWriter{}
+	reply, err := service.HandleChat(context.Background(), second, Message{Type: TypeChat, MessageID: "b", Content: "  what is 2+2 "})
+	if err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if reply.Text != "Echo: What is 2+2?" || reply.PromptTokens != 0 || reply.OutputTokens != 0 {
+		t.Errorf("reply = %+v, want the first answer at no token cost", reply)
+	}
+	for i, msg := range second.messages {
+		if !msg.Cached || msg.MessageID != "b" || msg.Seq != int64(i+1) {
+			t.Errorf("replayed frame %d = %+v", i, msg)
+		}
+	}
+	complete := second.messages[len(second.messages)-1]
+	if complete.Type != TypeComplete || complete.MetadataString("cache") != cache.MatchExact {
+		t.Errorf("complete = %+v", complete)
+	}
+}
+
+type stubRetriever struct {
+	context *lecture.Context
+	err     error
+	queries []lecture.Query
+}
+
+func (r *stubRetriever) Retrieve(ctx context.Context, query lecture.Query) (*lecture.Context, error) {
+	r.queries = append(r.queries, query)
+	return r.context, r.err
+}
+
+// instructionRecorder remembers the system instruction and turns it was
+// sent.
+type instructionRecorder struct {
+	*llm.ScriptedProvider
+	instruction string
+	contents    []llm.Content
+}
+
+func (p *instructionRecorder) StreamGenerate(ctx context.Context, req llm.Request, onChunk func(llm.Chunk) error) (*llm.Result, error) {
+	p.instruction = req.SystemInstruction
+	p.contents = req.Contents
+	return p.ScriptedProvider.StreamGenerate(ctx, req, onChunk)
+}
+
+func TestHandleChatGroundsLectureQuestions(t *testing.T) {
+	at, later := 65.0, 130.0
+	retriever := &stubRetriever{context: &lecture.Context{
+		VideoID: "vid_1",
+		Title:   "Thermodynamics 3",
+		Frames: []lecture.Frame{
+			{ID: "f1", Timestamp: &at, Text: "dS >= dQ/T"},
+			{ID: "f2", Timestamp: &later, Text: "Entropy never decreases in an isolated system."},
+		},
+	}}
+	provider := &instructionRecorder{ScriptedProvider: llm.NewScriptedProvider(llm.Script{
+		Default: "See the inequality at [1:05] and the remark at [2:10], not [9:99].",
+	})}
+	providers := llm.NewRegistry()
+	providers.Register(provider)
+	service := &Service{Providers: providers, Lectures: retriever}
+
+	writer := &recordingWriter{}
+	message := Message{Type: TypeChat, MessageID: "m", Content: "Why does entropy increase?", Metadata: map[string]any{
+		"video_id":   "vid_1",
+		"time_range": map[string]any{"start": 60.0, "end": 180.0},
+	}}
+	if _, err := service.HandleChat(context.Background(), writer, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+
+	if got := retriever.queries; len(got) != 1 || got[0].VideoID != "vid_1" || got[0].Start != 60 || got[0].End != 180 {
+		t.Errorf("queries = %+v", got)
+	}
+	for _, want := range []string{"Thermodynamics 3", "[1:05] dS >= dQ/T", "[2:10] Entropy never decreases"} {
+		if !strings.Contains(provider.instruction, want) {
+			t.Errorf("system instruction lacks %q:\n%s", want, provider.instruction)
+		}
+	}
+
+	complete := writer.messages[len(writer.messages)-1]
+	citations, _ := complete.Metadata["citations"].([]lecture.Citation)
+	if complete.Type != TypeComplete || len(citations) != 2 {
+		t.Fatalf("complete = %+v", complete)
+	}
+	if citations[0].FrameID != "f1" || citations[0].Seconds != 65 || citations[1].FrameID != "f2" || citations[1].Seconds != 130 {
+		t.Errorf("citations = %+v", citations)
+	}
+
+	retriever.err = lecture.ErrVideoNotReady
+	writer = &recordingWriter{}
+	if _, err := service.HandleChat(context.Background(), writer, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if got := writer.messages; len(got) != 1 || got[0].Error == nil || got[0].Error.Code != CodeVideoNotReady {
+		t.Errorf("messages = %+v, want a video_not_ready error", got)
+	}
+}
+
+// blindProvider is a provider without vision.
+type blindProvider struct{ *llm.ScriptedProvider }
+
+func (blindProvider) Name() string { return "blind" }
+
+func (blindProvider) Capabilities() llm.Capabilities { return llm.Capabilities{Streaming: true} }
+
+func TestHandleChatSendsAttachmentsToVisionProviders(t *testing.T) {
+	providers := llm.NewRegistry()
+	provider := &instructionRecorder{ScriptedProvider: llm.NewEchoProvider()}
+	providers.Register(provider)
+	providers.Register(blindProvider{llm.NewEchoProvider()})
+	store := memory.NewInMemoryStore(time.Hour, 10)
+	service := &Service{Providers: providers, Memory: store, AttachmentLimits: attachment.Limits{MaxBytes: 1024}}
+
+	message := Message{Type: TypeChat, MessageID: "m", Content: "What is question 2?", Attachments: []Attachment{
+		{Data: []byte("%PDF-1.7\n"), Name: "worksheet.pdf"},
+	}, Metadata: map[string]any{"conversation_id": "c1"}}
+	writer := &recordingWriter{}
+	if _, err := service.HandleChat(context.Background(), writer, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if complete := writer.messages[len(writer.messages)-1]; complete.Type != TypeComplete {
+		t.Fatalf("last frame = %+v", complete)
+	}
+	history, _ := store.History(context.Background(), conversationKey("", "c1"))
+	if len(history) != 2 || history[0].Parts[0].Text != "[Attached application/pdf: worksheet.pdf]" || history[0].Parts[0].InlineData != nil {
+		t.Errorf("history = %+v, want a note in place of the file", history)
+	}
+
+	message.Metadata = map[string]any{"provider": "blind"}
+	writer = &recordingWriter{}
+	if _, err := service.HandleChat(context.Background(), writer, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if got := writer.messages; len(got) != 1 || got[0].Error == nil || got[0].Error.Code != CodeAttachmentsUnsupported {
+		t.Errorf("messages = %+v, want attachments_unsupported", got)
+	}
+
+	message.Attachments = []Attachment{{Data: make([]byte, 2048)}}
+	writer = &recordingWriter{}
+	service.HandleChat(context.Background(), writer, message)
+	if got := writer.messages; len(got) != 1 || got[0].Error == nil || got[0].Error.Fields[0].Field != "attachments[0]" {
+		t.Errorf("messages = %+v, want the oversized attachment rejected", got)
+	}
+}
+
+// stubHistory keeps conversations in memory by owner and id.
+type stubHistory struct {
+	messages map[string][]history.Message
+}
+
+func (h *stubHistory) Append(ctx context.Context, owner, conversationID string, messages ...history.Message) error {
+	h.messages[owner+"/"+conversationID] = append(h.messages[owner+"/"+conversationID], messages...)
+	return nil
+}
+
+func (h *stubHistory) ListConversations(ctx context.Context, owner string, opts history.ListOptions) (*history.Page, error) {
+	return &history.Page{}, nil
+}
+
+func (h *stubHistory) GetConversation(ctx context.Context, owner, conversationID string) (*history.Conversation, error) {
+	messages, ok := h.messages[owner+"/"+conversationID]
+	if !ok {
+		return nil, history.ErrNotFound
+	}
+	return &history.Conversation{ID: conversationID, Messages: messages}, nil
+}
+
+func (h *stubHistory) Rename(ctx context.Context, owner, conversationID, title string) error {
+	return nil
+}
+
+func (h *stubHistory) Delete(ctx context.Context, owner, conversationID string) error { return nil }
+
+func TestHandleChatPersistsAndRestoresHistory(t *testing.T) {
+	providers := llm.NewRegistry()
+	provider := &instructionRecorder{ScriptedProvider: llm.NewEchoProvider()}
+	providers.Register(provider)
+	saved := &stubHistory{messages: map[string][]history.Message{}}
+	service := &Service{Providers: providers, Memory: memory.NewInMemoryStore(time.Hour, 10), History: saved}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: "alice"})
+
+	message := Message{Type: TypeChat, MessageID: "m1", Content: "What is entropy?", Metadata: map[string]any{"conversation_id": "c1"}}
+	if _, err := service.HandleChat(ctx, &recordingWriter{}, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	got := saved.messages["alice/c1"]
+	if len(got) != 2 || got[0].Role != history.RoleUser || got[0].Content != "What is entropy?" ||
+		got[1].Role != history.RoleAssistant || got[1].Content != "Echo: What is entropy?" || got[1].Metadata["provider"] != "echo" {
+		t.Fatalf("saved %+v", got)
+	}
+
+	// A restarted gateway has forgotten the conversation but can restore it
+	service.Memory = memory.NewInMemoryStore(time.Hour, 10)
+	message.MessageID, message.Content = "m2", "And enthalpy?"
+	if _, err := service.HandleChat(ctx, &recordingWriter{}, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if len(provider.contents) != 3 || provider.contents[1].Role != llm.RoleModel || provider.contents[1].Parts[0].Text != "Echo: What is entropy?" {
+		t.Errorf("provider was sent %+v, want the restored turns first", provider.contents)
+	}
+	if len(saved.messages["alice/c1"]) != 4 {
+		t.Errorf("saved %d messages, want 4", len(saved.messages["alice/c1"]))
+	}
+
+	// Another user's chat with the same id neither sees nor extends it, and
+	// starts a conversation of their own
+	mallory := auth.WithIdentity(context.Background(), &auth.Identity{UserID: "mallory"})
+	service.Memory = memory.NewInMemoryStore(time.Hour, 10)
+	if _, err := service.HandleChat(mallory, &recordingWriter{}, message); err != nil {
+		t.Fatalf("HandleChat: %v", err)
+	}
+	if len(provider.contents) != 1 || len(saved.messages["alice/c1"]) != 4 || len(saved.messages["mallory/c1"]) != 2 {
+		t.Errorf("another user's chat saw %d turns and left %d saved", len(provider.contents), len(saved.messages["alice/c1"]))
+	}
+}
+
+func TestHandleChatKeepsConversationsPerUser(t *testing.T) {
+	providers := llm.NewRegistry()
+	provider := &instructionRecorder{ScriptedProvider: llm.NewEchoProvider()}
+	providers.Register(provider)
+	service := &Service{Providers: providers, Memory: memory.NewInMemoryStore(time.Hour, 10)}
+	alice := auth.WithIdentity(context.Background(), &auth.Identity{UserID: "alice"})
+	bob := auth.WithIdentity(context.Background(), &auth.Identity{UserID: "bob"})
+
+	chat := func(ctx context.Context, content string) {
+		t.Helper()
+		message := Message{Type: TypeChat, MessageID: "m", Content: content, Metadata: map[string]any{"conversation_id": "shared"}}
+		if _, err := service.HandleChat(ctx, &recordingWriter{}, message); err != nil {
+			t.Fatalf("HandleChat: %v", err)
+		}
+	}
+	chat(alice, "My password hint is tea")
+	chat(bob, "What did I say before?")
+	if len(provider.contents) != 1 {
+		t.Errorf("bob's chat was sent %+v, want none of alice's turns", provider.contents)
+	}
+	chat(alice, "And now?")
+	if len(provider.contents) != 3 || provider.contents[0].Parts[0].Text != "My password hint is tea" {
+		t.Errorf("alice's chat was sent %+v, want only her own turns", provider.contents)
+	}
+}
+
+// brokenHistory fails every write, as a database outage would.
+type brokenHistory struct{ stubHistory }
+
+func (h *brokenHistory) Append(ctx context.Context, owner, conversationID string, messages ...history.Message) error {
+	return errors.New("database is down")
+}
+
+func TestHandleChatReportsUnsavedHistory(t *testing.T) {
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewEchoProvider())
+	service := &Service{Providers: providers, History: &brokenHistory{}}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: "alice"})
+
+	writer := &recordingWriter{}
+	message := Message{Type: TypeChat, MessageID: "m1", Content: "Hi", Metadata: map[string]any{"conversation_id": "c1"}}
+	if _, err := service.HandleChat(ctx, writer, message); err == nil {
+		t.Error("HandleChat succeeded without saving the conversation")
+	}
+	last := writer.messages[len(writer.messages)-1]
+	if last.Type != TypeError || last.Error.Code != CodeInternal || last.Seq != 0 {
+		t.Errorf("last frame = %+v, want an error telling the client", last)
+	}
+}
@@ -0,0 +1,382 @@
+// pkg/chat/session.go
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/ratelimit"
+)
+
+var (
+	// ErrSessionClosed is the cancellation cause once the client connection
+	// is gone. Nothing more is written to the client after that.
+	ErrSessionClosed = errors.New("session closed")
+	// ErrCancelledByClient is the cancellation cause for a cancel message.
+	ErrCancelledByClient = errors.New("generation cancelled by client")
+)
+
+// ServiceRole marks tokens of trusted backends that send chats on behalf of
+// many users.
+const ServiceRole = "service"
+
+// DefaultMaxConcurrentGenerations is used when Service.MaxConcurrentGenerations
+// is not set.
+const DefaultMaxConcurrentGenerations = 4
+
+// Session multiplexes the generations running on a single client
+// connection. Each runs in its own goroutine, tagged by message_id, and all
+// frames go through one writer goroutine. Generations can be cancelled
+// individually or all at once when the socket closes.
+type Session struct {
+	service *Service
+	writer  *frameWriter
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	// user keys per-user limits: the authenticated user id, or the client
+	// IP when authentication is disabled.
+	user     string
+	clientIP string
+	// actsForUsers is set for trusted service connections, such as the
+	// Phoenix backend, which name the end user in metadata.user_id.
+	actsForUsers bool
+
+	mu     sync.Mutex
+	active map[string]context.CancelCauseFunc
+	// following are the resumed streams being sent, by message_id.
+	following map[string]context.CancelCauseFunc
+	wg        sync.WaitGroup
+	// resumable are the active generations whose chat asked to keep
+	// running if the connection drops, by message_id.
+	resumable map[string]bool
+	// detached is set once the client went away with generations left to
+	// finish into the replay buffer.
+	detached bool
+	// idle is non-nil once the session is draining and is closed when the
+	// last active generation finishes.
+	idle chan struct{}
+	// onConversation is told of the conversations chatted in.
+	onConversation func(user, conversationID string)
+}
+
+// NewSession starts a session for a connection from clientIP. The identity
+// attached to ctx, if any, is used for per-user limits.
+func (s *Service) NewSession(ctx context.Context, writer MessageWriter, clientIP string) *Session {
+	user := "ip:" + clientIP
+	actsForUsers := false
+	if identity, ok := auth.FromContext(ctx); ok {
+		user = identity.UserID
+		actsForUsers = identity.HasRole(ServiceRole)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Session{
+		service:  s,
+		writer:   newFrameWriter(writer, s.SendQueue),
+		ctx:      ctx,
+		cancel:   cancel,
+		user:     user,
+		clientIP: clientIP,
+		active:   make(map[string]context.CancelCauseFunc),
+
+		actsForUsers: actsForUsers,
+	}
+}
+
+// userFor returns the user a message is charged to.
+func (s *Session) userFor(message Message) string {
+	if s.actsForUsers {
+		if user := message.MetadataString("user_id"); user != "" {
+			return user
+		}
+	}
+	return s.user
+}
+
+// HandleFrame decodes and validates a raw frame from the client and
+// handles it. Invalid frames are answered with an error frame. The returned
+// error is only non-nil if writing to the client failed.
+func (s *Session) HandleFrame(raw []byte) error {
+	message, invalid := DecodeMessage(raw)
+	if invalid != nil {
+		metrics.Messages.WithLabelValues("in", "invalid").Inc()
+		log.Printf("Rejected message: %v", invalid)
+		return s.writer.WriteJSON(errorMessage(message.MessageID, invalid))
+	}
+	metrics.Messages.WithLabelValues("in", message.Type).Inc()
+	return s.HandleMessage(message)
+}
+
+// HandleMessage dispatches a validated message. It never blocks on a
+// generation; chat messages are answered in the background.
+func (s *Session) HandleMessage(message Message) error {
+	switch message.Type {
+	case TypeChat:
+		return s.startChat(message)
+	case TypeCancel:
+		return s.cancelGeneration(message)
+	case TypeResume:
+		return s.resume(message)
+	default:
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeUnsupportedType, "unsupported message type %q", message.Type)))
+	}
+}
+
+func (s *Session) startChat(message Message) error {
+	if message.MessageID == "" {
+		message.MessageID = newMessageID()
+	}
+
+	if s.draining() {
+		return s.writer.WriteJSON(shutdownRejection(message.MessageID))
+	}
+
+	user := s.userFor(message)
+	ip := s.clientIP
+	if s.actsForUsers {
+		// Every chat from a service connection shares its IP
+		ip = ""
+	}
+
+	release := func() {}
+	if limiter := s.service.Limiter; limiter != nil {
+		rejection := limiter.CheckMessage(s.ctx, user, ip)
+		if rejection == nil {
+			rejection = limiter.CheckQuota(s.ctx, user)
+		}
+		if rejection == nil {
+			release, rejection = limiter.AcquireGeneration(s.ctx, user)
+		}
+		if rejection != nil {
+			metrics.RateLimitRejections.WithLabelValues(rejection.Limit).Inc()
+			return s.writer.WriteJSON(rateLimitedMessage(message.MessageID, rejection))
+		}
+	}
+
+	s.mu.Lock()
+	if s.idle != nil {
+		s.mu.Unlock()
+		release()
+		return s.writer.WriteJSON(shutdownRejection(message.MessageID))
+	}
+	if _, exists := s.active[message.MessageID]; exists {
+		s.mu.Unlock()
+		release()
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeDuplicateMessageID, "A generation with this message_id is already running")))
+	}
+	if limit := s.service.maxConcurrentGenerations(); len(s.active) >= limit {
+		s.mu.Unlock()
+		release()
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeTooManyGenerations, "Too many concurrent generations on this connection (limit %d)", limit)))
+	}
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	key := generationKey(user, message.MessageID)
+	if !s.service.track(key, cancel) {
+		s.mu.Unlock()
+		cancel(nil)
+		release()
+		return s.writer.WriteJSON(errorMessage(message.MessageID,
+			newError(CodeDuplicateMessageID, "A generation with this message_id is already running")))
+	}
+	s.active[message.MessageID] = cancel
+	if resumable, _ := message.Metadata["resumable"].(bool); resumable && s.service.Replay != nil {
+		if s.resumable == nil {
+			s.resumable = make(map[string]bool)
+		}
+		s.resumable[message.MessageID] = true
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer s.finish(message.MessageID)
+		defer release()
+		if id := message.MetadataString("conversation_id"); id != "" && s.onConversation != nil {
+			s.onConversation(user, id)
+		}
+
+		writer := s.writer.bind(ctx)
+		if s.service.Replay != nil {
+			recorder := &recorder{buffer: s.service.Replay, key: key, messageID: message.MessageID, conn: writer}
+			defer s.service.untrack(key)
+			defer recorder.close()
+			writer = recorder
+		}
+		reply, err := s.service.HandleChat(ctx, writer, message)
+		if err != nil && !errors.Is(context.Cause(ctx), ErrSessionClosed) {
+			log.Printf("Failed to stream message %s: %v", message.MessageID, err)
+		}
+		if reply != nil && s.service.Limiter != nil {
+			// Tokens are paid for even if the client cancelled
+			s.service.Limiter.RecordTokens(context.Background(), user, reply.PromptTokens+reply.OutputTokens)
+		}
+	}()
+	return nil
+}
+
+// OnConversation calls f with the user and conversation_id of each chat in
+// a conversation, before it is answered. It must be set before the first
+// message is handled.
+func (s *Session) OnConversation(f func(user, conversationID string)) {
+	s.onConversation = f
+}
+
+// Push writes a frame that did not come from a generation, such as a
+// notice a backend sent the user.
+func (s *Session) Push(frame json.RawMessage) error {
+	return s.writer.WriteContext(s.ctx, frame)
+}
+
+func (s *Session) draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idle != nil
+}
+
+// shutdownRejection answers a chat received while draining. The client
+// should resend it after reconnecting.
+func shutdownRejection(messageID string) Message {
+	return Message{
+		Type:      TypeServerShutdown,
+		MessageID: messageID,
+		Error:     newError(CodeServerShuttingDown, "Server is shutting down, reconnect to send this message"),
+	}
+}
+
+func rateLimitedMessage(messageID string, rejection *ratelimit.Rejection) Message {
+	retryAfter := rejection.RetryAfter.Round(time.Millisecond)
+	err := newError(CodeRateLimited, "Rate limit exceeded, retry in %v", retryAfter)
+	err.RetryAfterMs = retryAfter.Milliseconds()
+	return Message{
+		Type:      TypeRateLimited,
+		MessageID: messageID,
+		Error:     err,
+		Metadata:  map[string]any{"limit": rejection.Limit},
+	}
+}
+
+func (s *Session) finish(messageID string) {
+	s.mu.Lock()
+	cancel := s.active[messageID]
+	delete(s.active, messageID)
+	delete(s.resumable, messageID)
+	if s.idle != nil && len(s.active) == 0 {
+		close(s.idle)
+	}
+	last := s.detached && len(s.active) == 0
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel(nil)
+	}
+	if last {
+		s.cancel(ErrSessionClosed)
+	}
+}
+
+// cancelGeneration cancels a generation of this connection or, for resumed
+// streams, of an earlier one.
+func (s *Session) cancelGeneration(message Message) error {
+	s.mu.Lock()
+	cancel, ok := s.active[message.MessageID]
+	s.mu.Unlock()
+
+	if ok {
+		cancel(ErrCancelledByClient)
+		return nil
+	}
+	// Resumed clients see the cancellation in the stream they follow
+	if s.service.cancelRunning(generationKey(s.userFor(message), message.MessageID), ErrCancelledByClient) {
+		return nil
+	}
+	return s.writer.WriteJSON(errorMessage(message.MessageID,
+		newError(CodeUnknownMessageID, "No active generation with this message_id")))
+}
+
+// Drain stops the session from starting new generations and tells the
+// client the server is going away and when to reconnect. The returned
+// channel is closed once the generations already running have finished.
+func (s *Session) Drain(reconnectAfter time.Duration) <-chan struct{} {
+	s.mu.Lock()
+	if s.idle != nil {
+		s.mu.Unlock()
+		return s.idle
+	}
+	s.idle = make(chan struct{})
+	running := len(s.active)
+	if running == 0 {
+		close(s.idle)
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	notice := newError(CodeServerShuttingDown, "Server is restarting, please reconnect")
+	notice.RetryAfterMs = reconnectAfter.Milliseconds()
+	if err := s.writer.WriteJSON(Message{
+		Type:     TypeServerShutdown,
+		Error:    notice,
+		Metadata: map[string]any{"active_generations": running},
+	}); err != nil {
+		log.Printf("Failed to send shutdown notice: %v", err)
+	}
+	return idle
+}
+
+// Wait blocks until the generations running on the session have finished.
+func (s *Session) Wait() {
+	s.wg.Wait()
+}
+
+// Close cancels every generation still running on the connection, waits
+// for them to stop and then stops the writer.
+func (s *Session) Close() {
+	s.cancel(ErrSessionClosed)
+	s.wg.Wait()
+	s.writer.Close()
+}
+
+// Detach is Close for a client that went away unexpectedly. Generations
+// whose chat set metadata.resumable carry on into the replay buffer, for the
+// client to resume after reconnecting, and the session ends once they
+// finish. The others are cancelled, since nobody is expected to read them.
+func (s *Session) Detach() {
+	if s.service.Replay == nil {
+		s.Close()
+		return
+	}
+	s.mu.Lock()
+	for _, cancel := range s.following {
+		cancel(ErrSessionClosed)
+	}
+	for messageID, cancel := range s.active {
+		if !s.resumable[messageID] {
+			cancel(ErrSessionClosed)
+		}
+	}
+	s.detached = true
+	if len(s.active) == 0 {
+		s.cancel(ErrSessionClosed)
+	}
+	s.mu.Unlock()
+	s.writer.Close()
+}
+
+func newMessageID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "msg_" + hex.EncodeToString(b)
+}
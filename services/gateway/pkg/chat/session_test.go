@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// blockingProvider streams a first token and then holds every generation
+// until release is closed.
+type blockingProvider struct {
+	*llm.ScriptedProvider
+	release chan struct{}
+}
+
+func (p blockingProvider) StreamGenerate(ctx context.Context, req llm.Request, onChunk func(llm.Chunk) error) (*llm.Result, error) {
+	if err := onChunk(llm.Chunk{Text: "first "}); err != nil {
+		return nil, err
+	}
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := onChunk(llm.Chunk{Text: "second"}); err != nil {
+		return nil, err
+	}
+	return &llm.Result{FinishReason: "STOP"}, nil
+}
+
+func newBlockingService(limit int) (*Service, chan struct{}) {
+	release := make(chan struct{})
+	providers := llm.NewRegistry()
+	providers.Register(blockingProvider{ScriptedProvider: llm.NewScriptedProvider(llm.Script{}), release: release})
+	return &Service{Providers: providers, MaxConcurrentGenerations: limit}, release
+}
+
+func TestSessionRunsGenerationsConcurrently(t *testing.T) {
+	service, release := newBlockingService(3)
+	client := make(channelWriter, 100)
+	session := service.NewSession(context.Background(), client, "10.0.0.1")
+	defer session.Close()
+
+	for _, id := range []string{"m1", "m2", "m3"} {
+		session.HandleMessage(Message{Type: TypeChat, MessageID: id, Content: "go on"})
+	}
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m4", Content: "one too many"})
+
+	rejected := false
+	checkRejected := func(frame Message) {
+		if frame.Error == nil || frame.Error.Code != CodeTooManyGenerations {
+			t.Fatalf("chat over the limit got %+v, want too_many_generations", frame)
+		}
+		rejected = true
+	}
+
+	// Every generation within the limit starts before any of them finishes
+	started := make(map[string]int)
+	for len(started) < 3 || started["m1"]+started["m2"]+started["m3"] < 6 {
+		frame := client.next(t)
+		if frame.MessageID == "m4" {
+			checkRejected(frame)
+			continue
+		}
+		if frame.Type != TypeStart && frame.Type != TypeToken {
+			t.Fatalf("%s sent %s while blocked", frame.MessageID, frame.Type)
+		}
+		started[frame.MessageID]++
+	}
+
+	close(release)
+	lastSeq := map[string]int64{"m1": 2, "m2": 2, "m3": 2}
+	for completed := 0; completed < 3; {
+		frame := client.next(t)
+		if frame.MessageID == "m4" {
+			checkRejected(frame)
+			continue
+		}
+		if frame.Seq != lastSeq[frame.MessageID]+1 {
+			t.Fatalf("%s sent seq %d after %d", frame.MessageID, frame.Seq, lastSeq[frame.MessageID])
+		}
+		lastSeq[frame.MessageID] = frame.Seq
+		if frame.Type == TypeComplete {
+			completed++
+		}
+	}
+
+	if !rejected {
+		t.Fatal("the chat over the limit was not rejected")
+	}
+
+	// A finished generation frees its place
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m5", Content: "again"})
+	if frame := client.next(t); frame.MessageID != "m5" || frame.Type != TypeStart {
+		t.Errorf("chat after the others finished got %+v", frame)
+	}
+	session.Wait()
+}
+
+func TestSessionDrain(t *testing.T) {
+	service, release := newBlockingService(0)
+	client := make(channelWriter, 100)
+	session := service.NewSession(context.Background(), client, "10.0.0.1")
+	defer session.Close()
+
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on"})
+	client.next(t)
+	client.next(t)
+
+	idle := session.Drain(5 * time.Second)
+	notice := client.next(t)
+	if notice.Type != TypeServerShutdown || notice.Error == nil || notice.Error.Code != CodeServerShuttingDown {
+		t.Fatalf("notice = %+v, want server_shutdown", notice)
+	}
+	if notice.Error.RetryAfterMs != 5000 || notice.Metadata["active_generations"] != 1 {
+		t.Errorf("notice = %+v, want retry after 5000ms with 1 active generation", notice)
+	}
+
+	// New chats are turned away while the running one finishes
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m2", Content: "too late"})
+	if frame := client.next(t); frame.Type != TypeServerShutdown || frame.MessageID != "m2" || frame.Error.Code != CodeServerShuttingDown {
+		t.Errorf("chat while draining got %+v", frame)
+	}
+	select {
+	case <-idle:
+		t.Fatal("idle before the running generation finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	for frame := client.next(t); frame.Type != TypeComplete; frame = client.next(t) {
+		if frame.MessageID != "m1" {
+			t.Fatalf("unexpected frame %+v", frame)
+		}
+	}
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not idle after the last generation finished")
+	}
+	if again := session.Drain(time.Second); again != idle {
+		t.Error("draining again returned another channel")
+	}
+}
+
+func TestSessionDrainWhenIdle(t *testing.T) {
+	service, _ := newBlockingService(0)
+	client := make(channelWriter, 10)
+	session := service.NewSession(context.Background(), client, "10.0.0.1")
+	defer session.Close()
+
+	select {
+	case <-session.Drain(time.Second):
+	default:
+		t.Error("a session with nothing running was not idle at once")
+	}
+	if notice := client.next(t); notice.Type != TypeServerShutdown || notice.Metadata["active_generations"] != 0 {
+		t.Errorf("notice = %+v", notice)
+	}
+}
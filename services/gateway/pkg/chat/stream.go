@@ -0,0 +1,313 @@
+// pkg/chat/stream.go
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/cache"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/memory"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/tools"
+)
+
+// MessageWriter is the subset of a WebSocket connection the streamer needs.
+type MessageWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+// Reply is what the client was sent for a single generation.
+type Reply struct {
+	Text         string
+	FinishReason string
+	// Complete is false if the generation failed or was cut short.
+	Complete  bool
+	Cancelled bool
+	// Tokens sent to and received from the provider, as reported by it
+	// when the generation completed and estimated otherwise. Every tool
+	// round resends the conversation, so each adds its prompt tokens.
+	PromptTokens int
+	OutputTokens int
+	// ToolCalls is the number of tool calls the model made.
+	ToolCalls int
+}
+
+// DefaultMaxToolRounds bounds the tool rounds of a generation when
+// StreamOptions does not.
+const DefaultMaxToolRounds = 5
+
+// StreamOptions are the optional parts of a generation.
+type StreamOptions struct {
+	// Metadata, such as the assistant that answered, is added to the start
+	// and complete messages.
+	Metadata map[string]any
+	// Tools runs the function calls the model makes. The model can only
+	// make calls if the request declares tools.
+	Tools *tools.Registry
+	// MaxToolRounds bounds the call, execute, respond rounds. The request
+	// after the last round declares no tools, so the model has to answer.
+	// Zero means DefaultMaxToolRounds.
+	MaxToolRounds int
+	// Annotate returns metadata derived from the finished answer, such as
+	// the lecture timestamps it cites, to add to the complete message.
+	Annotate func(text string) map[string]any
+}
+
+// completeMetadata merges the metadata of the complete message for an
+// answer.
+func (o StreamOptions) completeMetadata(base map[string]any, text string) map[string]any {
+	for key, value := range o.Metadata {
+		base[key] = value
+	}
+	if o.Annotate != nil {
+		for key, value := range o.Annotate(text) {
+			base[key] = value
+		}
+	}
+	return base
+}
+
+// StreamResponse streams the provider's answer over conn, framed by a start
+// message and a complete message. Each chunk is forwarded as a token message
+// as soon as the provider yields it. The returned error is only non-nil if
+// writing to conn failed; generation errors are reported to the client.
+//
+// When the model calls tools instead of answering, each call is announced
+// with a tool_call message, run, and reported with a tool_result message,
+// and the results are sent back to the model for its next turn.
+//
+// Cancelling ctx aborts the upstream request and stops token emission. The
+// client is sent a cancelled message unless the session itself was closed.
+func StreamResponse(ctx context.Context, conn MessageWriter, provider llm.Provider, req llm.Request, messageID string, opts StreamOptions) (*Reply, error) {
+	reply := &Reply{}
+	var seq int64
+	send := func(msg Message) error {
+		seq++
+		msg.MessageID = messageID
+		msg.Seq = seq
+		return conn.WriteJSON(msg)
+	}
+
+	if err := send(Message{Type: TypeStart, Metadata: opts.Metadata}); err != nil {
+		return reply, fmt.Errorf("failed to send start message: %w", err)
+	}
+
+	name := provider.Name()
+	started := time.Now()
+	outcome := "error"
+	defer func() {
+		metrics.GenerationDuration.WithLabelValues(name, outcome).Observe(time.Since(started).Seconds())
+		metrics.Tokens.WithLabelValues(name, "prompt").Add(float64(reply.PromptTokens))
+		metrics.Tokens.WithLabelValues(name, "output").Add(float64(reply.OutputTokens))
+	}()
+
+	maxRounds := opts.MaxToolRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+	if opts.Tools == nil {
+		req.Tools = nil
+	}
+
+	var text strings.Builder
+	var writeErr error
+	onChunk := func(chunk llm.Chunk) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if text.Len() == 0 {
+			metrics.TimeToFirstToken.WithLabelValues(name).Observe(time.Since(started).Seconds())
+		}
+		text.WriteString(chunk.Text)
+		writeErr = send(Message{Type: TypeToken, Content: chunk.Text})
+		return writeErr
+	}
+
+	// Provider usage summed over the rounds, if every round reported it
+	var result *llm.Result
+	var err error
+	var usage llm.Usage
+	usageReported := true
+	for round := 0; ; round++ {
+		if round == maxRounds {
+			req.Tools = nil
+		}
+		reply.PromptTokens += memory.ContentTokens(req.Contents...) + memory.EstimateTokens(req.SystemInstruction)
+		metrics.UpstreamRequests.WithLabelValues(name).Inc()
+
+		roundStart := text.Len()
+		result, err = provider.StreamGenerate(ctx, req, onChunk)
+		if writeErr != nil || ctx.Err() != nil || err != nil {
+			break
+		}
+		if result.Usage == nil {
+			usageReported = false
+		} else {
+			usage.PromptTokens += result.Usage.PromptTokens
+			usage.OutputTokens += result.Usage.OutputTokens
+			usage.TotalTokens += result.Usage.TotalTokens
+		}
+		if len(result.FunctionCalls) == 0 || len(req.Tools) == 0 {
+			break
+		}
+
+		modelTurn := llm.Content{Role: llm.RoleModel}
+		if roundText := text.String()[roundStart:]; roundText != "" {
+			modelTurn.Parts = append(modelTurn.Parts, llm.Part{Text: roundText})
+		}
+		responses := llm.Content{Role: llm.RoleUser}
+		for _, call := range result.FunctionCalls {
+			call := call
+			reply.ToolCalls++
+			event := &ToolEvent{CallID: fmt.Sprintf("%s_tool%d", messageID, reply.ToolCalls), Name: call.Name, Args: call.Args}
+			if err := send(Message{Type: TypeToolCall, Tool: event}); err != nil {
+				return reply, fmt.Errorf("failed to send tool call: %w", err)
+			}
+
+			callStarted := time.Now()
+			value, callErr := opts.Tools.Call(ctx, call)
+			response := map[string]any{"result": value}
+			event = &ToolEvent{CallID: event.CallID, Name: call.Name, Result: value, DurationMs: time.Since(callStarted).Milliseconds()}
+			if callErr != nil {
+				log.Printf("Tool %s for message %s failed: %v", call.Name, messageID, callErr)
+				response = map[string]any{"error": callErr.Error()}
+				event.Result, event.Error = nil, callErr.Error()
+			}
+			if err := send(Message{Type: TypeToolResult, Tool: event}); err != nil {
+				return reply, fmt.Errorf("failed to send tool result: %w", err)
+			}
+
+			modelTurn.Parts = append(modelTurn.Parts, llm.Part{FunctionCall: &call})
+			responses.Parts = append(responses.Parts, llm.Part{FunctionResponse: &llm.FunctionResponse{
+				ID:       call.ID,
+				Name:     call.Name,
+				Response: response,
+			}})
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		// Never append into the caller's slice
+		req.Contents = append(req.Contents[:len(req.Contents):len(req.Contents)], modelTurn, responses)
+	}
+	reply.Text = text.String()
+	reply.OutputTokens = memory.EstimateTokens(reply.Text)
+	if writeErr != nil {
+		return reply, fmt.Errorf("failed to send token: %w", writeErr)
+	}
+
+	if ctx.Err() != nil {
+		reply.Cancelled = true
+		outcome = "cancelled"
+		if errors.Is(context.Cause(ctx), ErrSessionClosed) {
+			metrics.Cancellations.WithLabelValues("disconnect").Inc()
+			return reply, nil
+		}
+		metrics.Cancellations.WithLabelValues("client").Inc()
+		return reply, send(Message{Type: TypeCancelled})
+	}
+
+	if err != nil {
+		log.Printf("%s stream for message %s failed: %v", name, messageID, err)
+		metrics.UpstreamErrors.WithLabelValues(name, metrics.UpstreamStatus(err)).Inc()
+		return reply, send(errorMessage(messageID, providerError(err)))
+	}
+	outcome = "complete"
+
+	reported := &Usage{Usage: llm.Usage{
+		PromptTokens: reply.PromptTokens,
+		OutputTokens: reply.OutputTokens,
+		TotalTokens:  reply.PromptTokens + reply.OutputTokens,
+	}, Estimated: true}
+	if usageReported {
+		reported = &Usage{Usage: usage}
+		reply.PromptTokens = usage.PromptTokens
+		reply.OutputTokens = usage.OutputTokens
+	}
+
+	if result.BlockReason != "" {
+		blocked := newError(CodePromptBlocked, "The message was blocked by the provider's safety filters (%s)", result.BlockReason)
+		msg := errorMessage(messageID, blocked)
+		msg.SafetyRatings = result.SafetyRatings
+		return reply, send(msg)
+	}
+
+	reply.FinishReason = result.FinishReason
+	reply.Complete = true
+	completeMetadata := map[string]any{"provider": provider.Name()}
+	if reply.ToolCalls > 0 {
+		completeMetadata["tool_calls"] = reply.ToolCalls
+	}
+	return reply, send(Message{
+		Type:          TypeComplete,
+		FinishReason:  result.FinishReason,
+		Usage:         reported,
+		SafetyRatings: result.SafetyRatings,
+		Metadata:      opts.completeMetadata(completeMetadata, reply.Text),
+	})
+}
+
+// ReplayResponse sends a cached answer with the same frames StreamResponse
+// would, each marked cached. No provider is called, so the reply carries no
+// tokens to charge; the complete message reports the original usage. Tools
+// in opts are ignored, as cached answers never called any.
+func ReplayResponse(ctx context.Context, conn MessageWriter, entry *cache.Entry, messageID string, opts StreamOptions) (*Reply, error) {
+	reply := &Reply{}
+	var seq int64
+	send := func(msg Message) error {
+		seq++
+		msg.MessageID = messageID
+		msg.Seq = seq
+		msg.Cached = true
+		return conn.WriteJSON(msg)
+	}
+
+	if err := send(Message{Type: TypeStart, Metadata: opts.Metadata}); err != nil {
+		return reply, fmt.Errorf("failed to send start message: %w", err)
+	}
+
+	var text strings.Builder
+	for _, token := range llm.SplitIntoTokens(entry.Text) {
+		if ctx.Err() != nil {
+			reply.Text = text.String()
+			reply.Cancelled = true
+			if errors.Is(context.Cause(ctx), ErrSessionClosed) {
+				return reply, nil
+			}
+			return reply, send(Message{Type: TypeCancelled})
+		}
+		text.WriteString(token)
+		if err := send(Message{Type: TypeToken, Content: token}); err != nil {
+			return reply, fmt.Errorf("failed to send token: %w", err)
+		}
+	}
+
+	reply.Text = text.String()
+	reply.FinishReason = entry.FinishReason
+	reply.Complete = true
+	return reply, send(Message{
+		Type:         TypeComplete,
+		FinishReason: entry.FinishReason,
+		Usage:        &Usage{Usage: entry.Usage},
+		Metadata:     opts.completeMetadata(map[string]any{"provider": entry.Provider}, reply.Text),
+	})
+}
+
+// providerError maps a failed generation to the error sent to the client.
+func providerError(err error) *Error {
+	var status *llm.StatusError
+	switch {
+	case errors.Is(err, llm.ErrStreamTruncated):
+		return newError(CodeStreamInterrupted, "Response was interrupted before it finished")
+	case errors.As(err, &status) && status.StatusCode == http.StatusTooManyRequests:
+		return newError(CodeProviderRateLimit, "The AI provider is overloaded, try again shortly")
+	default:
+		return newError(CodeProviderError, "Error generating response")
+	}
+}
@@ -0,0 +1,142 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/tools"
+)
+
+type recordingWriter struct {
+	messages []Message
+}
+
+func (w *recordingWriter) WriteJSON(v interface{}) error {
+	w.messages = append(w.messages, v.(Message))
+	return nil
+}
+
+// truncatingProvider yields its chunks and then reports a dropped stream.
+type truncatingProvider struct {
+	*llm.ScriptedProvider
+	chunks []string
+}
+
+func (p truncatingProvider) StreamGenerate(ctx context.Context, req llm.Request, onChunk func(llm.Chunk) error) (*llm.Result, error) {
+	for _, text := range p.chunks {
+		if err := onChunk(llm.Chunk{Text: text}); err != nil {
+			return nil, err
+		}
+	}
+	return &llm.Result{}, llm.ErrStreamTruncated
+}
+
+func TestStreamResponseFramesTokens(t *testing.T) {
+	writer := &recordingWriter{}
+	req := llm.Request{Contents: llm.UserText("hello there")}
+	reply, err := StreamResponse(context.Background(), writer, llm.NewEchoProvider(), req, "msg_1", StreamOptions{})
+	if err != nil {
+		t.Fatalf("StreamResponse: %v", err)
+	}
+	if !reply.Complete || reply.Text != "Echo: hello there" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	var types []string
+	var text strings.Builder
+	for i, msg := range writer.messages {
+		types = append(types, msg.Type)
+		if msg.MessageID != "msg_1" {
+			t.Errorf("message %q has id %q", msg.Type, msg.MessageID)
+		}
+		if msg.Seq != int64(i+1) {
+			t.Errorf("message %d has seq %d", i, msg.Seq)
+		}
+		if msg.Type == "token" {
+			text.WriteString(msg.Content)
+		}
+	}
+
+	if got, want := strings.Join(types, ","), "start,token,token,token,complete"; got != want {
+		t.Fatalf("message types = %s, want %s", got, want)
+	}
+	if got := text.String(); got != "Echo: hello there" {
+		t.Errorf("streamed text = %q", got)
+	}
+	complete := writer.messages[len(writer.messages)-1]
+	if complete.FinishReason != "STOP" {
+		t.Errorf("finish_reason = %q, want STOP", complete.FinishReason)
+	}
+	if complete.Usage == nil || !complete.Usage.Estimated || complete.Usage.OutputTokens == 0 {
+		t.Errorf("usage = %+v, want an estimate", complete.Usage)
+	}
+}
+
+func TestStreamResponseReportsTruncatedStream(t *testing.T) {
+	writer := &recordingWriter{}
+	provider := truncatingProvider{ScriptedProvider: llm.NewEchoProvider(), chunks: []string{"This answer "}}
+	reply, err := StreamResponse(context.Background(), writer, provider, llm.Request{}, "msg_2", StreamOptions{})
+	if err != nil {
+		t.Fatalf("StreamResponse: %v", err)
+	}
+	if reply.Complete {
+		t.Errorf("truncated reply reported as complete")
+	}
+
+	if writer.messages[1].Type != "token" || writer.messages[1].Content != "This answer " {
+		t.Errorf("expected the chunk received before the drop to be forwarded, got %+v", writer.messages[1])
+	}
+	last := writer.messages[len(writer.messages)-1]
+	if last.Type != TypeError || last.Error == nil || last.Error.Code != CodeStreamInterrupted {
+		t.Fatalf("last message = %+v, want a stream_interrupted error", last)
+	}
+}
+
+func TestStreamResponseRunsToolCalls(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.Script{Rules: []llm.ScriptRule{{
+		Match: "6 times 7",
+		Tool:  "calculator",
+		Args:  json.RawMessage(`{"expression": "6 * 7"}`),
+		Reply: "It is {result}.",
+	}}})
+	registry := tools.NewRegistry(time.Second)
+	registry.Register(tools.Calculator{}, 0)
+
+	writer := &recordingWriter{}
+	req := llm.Request{
+		Contents: llm.UserText("What is 6 times 7?"),
+		Tools:    registry.Declarations([]string{"calculator"}),
+	}
+	reply, err := StreamResponse(context.Background(), writer, provider, req, "msg_3", StreamOptions{Tools: registry})
+	if err != nil {
+		t.Fatalf("StreamResponse: %v", err)
+	}
+	if !reply.Complete || reply.Text != "It is 42." || reply.ToolCalls != 1 {
+		t.Errorf("reply = %+v", reply)
+	}
+	if len(req.Contents) != 1 {
+		t.Errorf("caller's contents grew to %d turns", len(req.Contents))
+	}
+
+	var types []string
+	for _, msg := range writer.messages {
+		types = append(types, msg.Type)
+	}
+	if got, want := strings.Join(types, ","), "start,tool_call,tool_result,token,token,token,complete"; got != want {
+		t.Fatalf("message types = %s, want %s", got, want)
+	}
+	call, result := writer.messages[1].Tool, writer.messages[2].Tool
+	if call.Name != "calculator" || string(call.Args) != `{"expression": "6 * 7"}` {
+		t.Errorf("tool_call = %+v", call)
+	}
+	if result.CallID != call.CallID || result.Error != "" || result.Result.(tools.CalculatorResult).Result != 42 {
+		t.Errorf("tool_result = %+v", result)
+	}
+	if complete := writer.messages[len(writer.messages)-1]; complete.Metadata["tool_calls"] != 1 {
+		t.Errorf("complete metadata = %v", complete.Metadata)
+	}
+}
@@ -0,0 +1,242 @@
+// pkg/chat/writer.go
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+)
+
+var (
+	// ErrWriterClosed is returned for frames queued after the writer stopped.
+	ErrWriterClosed = errors.New("connection writer closed")
+	// ErrSlowConsumer is returned once a client that fell too far behind was
+	// dropped.
+	ErrSlowConsumer = errors.New("client is reading too slowly")
+)
+
+// CloseSlowConsumer is the WebSocket close code for clients dropped by
+// PolicyDrop. Like the authentication close codes it mirrors the HTTP
+// status, 408 Request Timeout.
+const CloseSlowConsumer = 4408
+
+// What a connection does when its send queue is full.
+const (
+	// PolicyCoalesce merges a token into the token of the same generation
+	// waiting at the back of the queue, so a slow client gets fewer, larger
+	// tokens. Other frames wait for room as with PolicyPause.
+	PolicyCoalesce = "coalesce"
+	// PolicyDrop closes the connection with CloseSlowConsumer. With a replay
+	// buffer the client can resume its answers after reconnecting.
+	PolicyDrop = "drop"
+	// PolicyPause blocks the generation until the client catches up, which
+	// stops reading the provider's stream in the meantime.
+	PolicyPause = "pause"
+)
+
+// DefaultSendQueueSize is used when SendQueue does not set a size.
+const DefaultSendQueueSize = 256
+
+// SendQueue bounds the frames waiting to be written to each connection.
+type SendQueue struct {
+	// Size is the number of frames queued. Zero means DefaultSendQueueSize.
+	Size int
+	// Policy is PolicyCoalesce, PolicyDrop or PolicyPause. Empty means
+	// PolicyCoalesce.
+	Policy string
+}
+
+// connCloser is implemented by connections PolicyDrop can close, such as
+// WebSocket connections. Others just stop being written to.
+type connCloser interface {
+	Close(code int, reason string)
+}
+
+// frameWriter owns the write side of a connection. Generations running
+// concurrently queue frames and a single goroutine writes them in order,
+// since a WebSocket connection supports only one writer at a time. The
+// queue is bounded, so a slow client costs at most its queue in memory.
+type frameWriter struct {
+	conn   MessageWriter
+	size   int
+	policy string
+	done   chan struct{}
+
+	mu sync.Mutex
+	// changed is signalled whenever frames are queued or taken, and when
+	// the writer stops.
+	changed *sync.Cond
+	frames  []interface{}
+	closing bool
+	stopped bool
+	err     error
+}
+
+func newFrameWriter(conn MessageWriter, queue SendQueue) *frameWriter {
+	w := &frameWriter{
+		conn:   conn,
+		size:   queue.Size,
+		policy: queue.Policy,
+		done:   make(chan struct{}),
+	}
+	if w.size <= 0 {
+		w.size = DefaultSendQueueSize
+	}
+	if w.policy == "" {
+		w.policy = PolicyCoalesce
+	}
+	w.changed = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+func (w *frameWriter) run() {
+	defer close(w.done)
+	for {
+		w.mu.Lock()
+		for len(w.frames) == 0 && !w.closing && !w.stopped {
+			w.changed.Wait()
+		}
+		if w.stopped || len(w.frames) == 0 {
+			w.stop(nil)
+			w.mu.Unlock()
+			return
+		}
+		frame := w.frames[0]
+		w.frames[0] = nil
+		w.frames = w.frames[1:]
+		w.changed.Broadcast()
+		w.mu.Unlock()
+		metrics.SendQueueFrames.Dec()
+
+		if err := w.conn.WriteJSON(frame); err != nil {
+			w.mu.Lock()
+			w.stop(err)
+			w.mu.Unlock()
+			return
+		}
+		if message, ok := frame.(Message); ok {
+			metrics.Messages.WithLabelValues("out", message.Type).Inc()
+		}
+	}
+}
+
+// stop discards the queue and fails later writes with err. w.mu must be
+// held.
+func (w *frameWriter) stop(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+	w.stopped = true
+	metrics.SendQueueFrames.Sub(float64(len(w.frames)))
+	w.frames = nil
+	w.changed.Broadcast()
+}
+
+// WriteJSON queues v for the writer goroutine. If the queue is full the
+// connection's policy decides whether v is merged into a queued frame,
+// waits for room or drops the client. It fails with the write error if the
+// connection already failed.
+func (w *frameWriter) WriteJSON(v interface{}) error {
+	return w.WriteContext(context.Background(), v)
+}
+
+// WriteContext is WriteJSON for the frames of a generation running with
+// ctx. Once ctx is done it stops waiting for room and queues v past the
+// limit, so a cancelled generation stops promptly and the client still
+// learns how it ended.
+func (w *frameWriter) WriteContext(ctx context.Context, v interface{}) error {
+	w.mu.Lock()
+	var paused time.Time
+	wake := func() bool { return false }
+	defer func() { wake() }()
+	for !w.stopped && !w.closing && len(w.frames) >= w.size && ctx.Err() == nil {
+		if w.policy == PolicyCoalesce && w.coalesce(v) {
+			w.mu.Unlock()
+			metrics.SlowConsumers.WithLabelValues("coalesced").Inc()
+			return nil
+		}
+		if w.policy == PolicyDrop {
+			w.stop(ErrSlowConsumer)
+			w.mu.Unlock()
+			metrics.SlowConsumers.WithLabelValues("dropped").Inc()
+			if closer, ok := w.conn.(connCloser); ok {
+				closer.Close(CloseSlowConsumer, fmt.Sprintf("client fell %d frames behind", w.size))
+			}
+			return ErrSlowConsumer
+		}
+		if paused.IsZero() {
+			paused = time.Now()
+			metrics.SlowConsumers.WithLabelValues("paused").Inc()
+			wake = context.AfterFunc(ctx, func() {
+				w.mu.Lock()
+				w.changed.Broadcast()
+				w.mu.Unlock()
+			})
+		}
+		w.changed.Wait()
+	}
+	if !paused.IsZero() {
+		metrics.SendQueuePause.Observe(time.Since(paused).Seconds())
+	}
+	if w.stopped || w.closing {
+		err := w.err
+		w.mu.Unlock()
+		if err == nil {
+			err = ErrWriterClosed
+		}
+		return err
+	}
+	w.frames = append(w.frames, v)
+	w.changed.Broadcast()
+	w.mu.Unlock()
+	metrics.SendQueueFrames.Inc()
+	return nil
+}
+
+// coalesce merges a token frame into the frame at the back of the queue if
+// that is a token of the same generation. The merged frame carries the
+// later seq, so a client resuming from it misses nothing. w.mu must be
+// held.
+func (w *frameWriter) coalesce(v interface{}) bool {
+	token, ok := v.(Message)
+	if !ok || token.Type != TypeToken {
+		return false
+	}
+	last, ok := w.frames[len(w.frames)-1].(Message)
+	if !ok || last.Type != TypeToken || last.MessageID != token.MessageID {
+		return false
+	}
+	last.Content += token.Content
+	last.Seq = token.Seq
+	w.frames[len(w.frames)-1] = last
+	return true
+}
+
+// bind returns a writer queueing frames with WriteContext under ctx.
+func (w *frameWriter) bind(ctx context.Context) MessageWriter {
+	return boundWriter{writer: w, ctx: ctx}
+}
+
+type boundWriter struct {
+	writer *frameWriter
+	ctx    context.Context
+}
+
+func (b boundWriter) WriteJSON(v interface{}) error {
+	return b.writer.WriteContext(b.ctx, v)
+}
+
+// Close writes the frames already queued and stops the writer goroutine.
+// Frames queued later are refused.
+func (w *frameWriter) Close() {
+	w.mu.Lock()
+	w.closing = true
+	w.changed.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+}
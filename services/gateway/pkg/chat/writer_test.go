@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// slowReader is a client that takes delay to read each frame.
+type slowReader struct {
+	delay time.Duration
+
+	mu        sync.Mutex
+	frames    []Message
+	closeCode int
+}
+
+func (r *slowReader) WriteJSON(v interface{}) error {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, v.(Message))
+	return nil
+}
+
+func (r *slowReader) Close(code int, reason string) {
+	r.mu.Lock()
+	r.closeCode = code
+	r.mu.Unlock()
+}
+
+// chatWithSlowReader streams an answer of words tokens, generated without
+// delay, to a client reading a frame per millisecond.
+func chatWithSlowReader(t *testing.T, policy string, words int) (*slowReader, time.Duration) {
+	t.Helper()
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewScriptedProvider(llm.Script{Default: strings.Repeat("word ", words)}))
+	service := &Service{Providers: providers, SendQueue: SendQueue{Size: 4, Policy: policy}}
+
+	client := &slowReader{delay: time.Millisecond}
+	session := service.NewSession(context.Background(), client, "10.0.0.1")
+	started := time.Now()
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on"})
+	session.Wait()
+	generated := time.Since(started)
+	session.Close()
+	return client, generated
+}
+
+func TestSlowReaderCoalescesTokens(t *testing.T) {
+	client, _ := chatWithSlowReader(t, PolicyCoalesce, 200)
+
+	var text strings.Builder
+	var lastSeq int64
+	for _, frame := range client.frames {
+		if frame.Seq <= lastSeq {
+			t.Fatalf("seq %d after %d", frame.Seq, lastSeq)
+		}
+		lastSeq = frame.Seq
+		text.WriteString(frame.Content)
+	}
+	if len(client.frames) >= 202 {
+		t.Errorf("sent %d frames, want tokens coalesced", len(client.frames))
+	}
+	if got, want := strings.TrimSpace(text.String()), strings.TrimSpace(strings.Repeat("word ", 200)); got != want {
+		t.Errorf("coalesced answer = %q", got)
+	}
+	if last := client.frames[len(client.frames)-1]; last.Type != TypeComplete || last.Seq != 202 {
+		t.Errorf("last frame = %+v, want complete with seq 202", last)
+	}
+}
+
+func TestSlowReaderDropped(t *testing.T) {
+	client, _ := chatWithSlowReader(t, PolicyDrop, 200)
+
+	if client.closeCode != CloseSlowConsumer {
+		t.Errorf("close code = %d, want %d", client.closeCode, CloseSlowConsumer)
+	}
+	for _, frame := range client.frames {
+		if frame.Type == TypeComplete {
+			t.Fatal("a dropped client received the whole answer")
+		}
+	}
+}
+
+func TestSlowReaderPausesGeneration(t *testing.T) {
+	client, generated := chatWithSlowReader(t, PolicyPause, 100)
+
+	if len(client.frames) != 102 {
+		t.Fatalf("sent %d frames, want 102", len(client.frames))
+	}
+	for i, frame := range client.frames {
+		if frame.Seq != int64(i+1) {
+			t.Fatalf("frame %d has seq %d", i, frame.Seq)
+		}
+	}
+	// The generation can only run ahead of the client by the queue
+	if generated < 90*time.Millisecond {
+		t.Errorf("generation finished in %v, ahead of the client", generated)
+	}
+}
+
+// stalledReader is a client that reads nothing until released.
+type stalledReader struct {
+	slowReader
+	release chan struct{}
+}
+
+func (r *stalledReader) WriteJSON(v interface{}) error {
+	<-r.release
+	return r.slowReader.WriteJSON(v)
+}
+
+func TestPausedGenerationCanBeCancelled(t *testing.T) {
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewScriptedProvider(llm.Script{Default: strings.Repeat("word ", 100)}))
+	service := &Service{Providers: providers, SendQueue: SendQueue{Size: 4, Policy: PolicyPause}}
+
+	client := &stalledReader{release: make(chan struct{})}
+	session := service.NewSession(context.Background(), client, "10.0.0.1")
+	session.HandleMessage(Message{Type: TypeChat, MessageID: "m1", Content: "go on"})
+	// Let the generation fill the queue and pause
+	time.Sleep(50 * time.Millisecond)
+	session.HandleMessage(Message{Type: TypeCancel, MessageID: "m1"})
+
+	finished := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a paused generation ignored its cancellation")
+	}
+
+	close(client.release)
+	session.Close()
+	if last := client.frames[len(client.frames)-1]; last.Type != TypeCancelled {
+		t.Errorf("last frame = %+v, want cancelled", last)
+	}
+}
@@ -0,0 +1,378 @@
+// pkg/cluster/cluster.go
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+)
+
+// Kinds of Address.
+const (
+	KindConnection   = "connection"
+	KindUser         = "user"
+	KindConversation = "conversation"
+	KindRoom         = "room"
+)
+
+// Address names the connections a message is for: a single connection,
+// every connection of a user, those that chatted in a conversation or
+// those that joined a room.
+type Address struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
+func (a Address) String() string {
+	return a.Kind + ":" + a.ID
+}
+
+// Valid reports whether a is of a known kind and has an id.
+func (a Address) Valid() bool {
+	switch a.Kind {
+	case KindConnection, KindUser, KindConversation, KindRoom:
+		return a.ID != ""
+	}
+	return false
+}
+
+// User addresses every connection of a user.
+func User(id string) Address {
+	return Address{Kind: KindUser, ID: id}
+}
+
+// Conversation addresses a conversation of owner. Conversation ids are
+// chosen by clients, so they are only unique per user.
+func Conversation(owner, id string) Address {
+	return Address{Kind: KindConversation, ID: owner + "/" + id}
+}
+
+// Room addresses a room of tenant, so tenants cannot reach each other's
+// rooms.
+func Room(tenant, name string) Address {
+	return Address{Kind: KindRoom, ID: tenant + "/" + name}
+}
+
+// Envelope is a message for every connection at an address, on whichever
+// node holds it.
+type Envelope struct {
+	To Address `json:"to"`
+	// Frame is written to each connection as is.
+	Frame json.RawMessage `json:"frame,omitempty"`
+	// Close, if set instead of Frame, closes each connection.
+	Close *Close `json:"close,omitempty"`
+}
+
+// Close is the WebSocket close frame sent to disconnected clients.
+type Close struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Transport shares which nodes hold connections at each address and
+// carries envelopes between nodes.
+type Transport interface {
+	// Register records that node holds connections at addr, until
+	// Unregister.
+	Register(ctx context.Context, node string, addr Address) error
+	Unregister(ctx context.Context, node string, addr Address) error
+	// Nodes returns the live nodes holding connections at addr.
+	Nodes(ctx context.Context, addr Address) ([]string, error)
+	Publish(ctx context.Context, node string, envelope Envelope) error
+	// Subscribe passes the envelopes published to node to deliver until ctx
+	// is done, and keeps the node known as live meanwhile.
+	Subscribe(ctx context.Context, node string, deliver func(Envelope)) error
+}
+
+// Node routes envelopes to the connections held by this gateway and, through
+// its transport, to those held by other replicas.
+type Node struct {
+	id        string
+	transport Transport
+
+	mu      sync.Mutex
+	members map[Address]map[*Member]struct{}
+	// locks serialize the changes to each address held, so the transport
+	// sees them in order without one slow address holding up the rest.
+	locks map[Address]*addressLock
+}
+
+type addressLock struct {
+	sync.Mutex
+	// waiters counts those holding or waiting for the lock.
+	waiters int
+}
+
+// NewNode creates the node id. Run must be called to receive envelopes
+// from other nodes.
+func NewNode(id string, transport Transport) *Node {
+	return &Node{
+		id:        id,
+		transport: transport,
+		members:   make(map[Address]map[*Member]struct{}),
+		locks:     make(map[Address]*addressLock),
+	}
+}
+
+// lock locks changes to addr and returns the func unlocking it.
+func (n *Node) lock(addr Address) func() {
+	n.mu.Lock()
+	lock, ok := n.locks[addr]
+	if !ok {
+		lock = &addressLock{}
+		n.locks[addr] = lock
+	}
+	lock.waiters++
+	n.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		n.mu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(n.locks, addr)
+		}
+		n.mu.Unlock()
+	}
+}
+
+// NewNodeID returns an id unique to this process, prefixed with the host
+// name so logs can tell replicas apart.
+func NewNodeID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gateway"
+	}
+	return host + "-" + randomID()
+}
+
+func randomID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Run receives the envelopes other nodes route here until ctx is done.
+func (n *Node) Run(ctx context.Context) error {
+	return n.transport.Subscribe(ctx, n.id, func(envelope Envelope) {
+		metrics.ClusterEnvelopes.WithLabelValues("received").Inc()
+		n.deliver(envelope)
+	})
+}
+
+// memberQueueSize bounds the envelopes waiting for a connection. Once a
+// connection falls that far behind, further envelopes for it are dropped.
+const memberQueueSize = 256
+
+// Member is a connection held by a node.
+type Member struct {
+	id      string
+	node    *Node
+	deliver func(Envelope)
+	// queued is signalled when envelopes are added to queue.
+	queued chan struct{}
+	done   chan struct{}
+
+	mu        sync.Mutex
+	queue     []Envelope
+	addresses []Address
+	left      bool
+}
+
+// Join adds a connection reachable at addresses and at its own connection
+// address. deliver is called with the envelopes for it one at a time, in
+// the order they arrived, until Leave.
+func (n *Node) Join(ctx context.Context, deliver func(Envelope), addresses ...Address) (*Member, error) {
+	member := &Member{
+		id:      randomID(),
+		node:    n,
+		deliver: deliver,
+		queued:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go member.run()
+	for _, addr := range append([]Address{{Kind: KindConnection, ID: member.id}}, addresses...) {
+		if err := member.Add(ctx, addr); err != nil {
+			member.Leave(ctx)
+			return nil, err
+		}
+	}
+	return member, nil
+}
+
+// ID is the id of the member's connection address.
+func (m *Member) ID() string {
+	return m.id
+}
+
+// Add makes the connection reachable at addr too, unless it already left.
+func (m *Member) Add(ctx context.Context, addr Address) error {
+	n := m.node
+	unlock := n.lock(addr)
+	defer unlock()
+
+	m.mu.Lock()
+	left := m.left
+	m.mu.Unlock()
+	n.mu.Lock()
+	members, held := n.members[addr]
+	_, added := members[m]
+	n.mu.Unlock()
+	if left || added {
+		return nil
+	}
+	// The first connection at an address registers the node for it
+	if !held {
+		if err := n.transport.Register(ctx, n.id, addr); err != nil {
+			return fmt.Errorf("failed to register %s: %w", addr, err)
+		}
+	}
+
+	m.mu.Lock()
+	if m.left {
+		m.mu.Unlock()
+		// Leave missed addr, so nothing else holds it
+		if !held {
+			n.unregister(ctx, addr)
+		}
+		return nil
+	}
+	n.mu.Lock()
+	if members == nil {
+		members = make(map[*Member]struct{})
+		n.members[addr] = members
+	}
+	members[m] = struct{}{}
+	n.mu.Unlock()
+	m.addresses = append(m.addresses, addr)
+	m.mu.Unlock()
+	return nil
+}
+
+// Leave removes the connection from every address it was reachable at.
+func (m *Member) Leave(ctx context.Context) {
+	m.mu.Lock()
+	if m.left {
+		m.mu.Unlock()
+		return
+	}
+	addresses := m.addresses
+	m.addresses = nil
+	m.left = true
+	m.queue = nil
+	close(m.done)
+	m.mu.Unlock()
+
+	n := m.node
+	for _, addr := range addresses {
+		unlock := n.lock(addr)
+		n.mu.Lock()
+		delete(n.members[addr], m)
+		last := len(n.members[addr]) == 0
+		if last {
+			delete(n.members, addr)
+		}
+		n.mu.Unlock()
+		if last {
+			n.unregister(ctx, addr)
+		}
+		unlock()
+	}
+}
+
+func (n *Node) unregister(ctx context.Context, addr Address) {
+	if err := n.transport.Unregister(ctx, n.id, addr); err != nil {
+		log.Printf("Failed to unregister %s: %v", addr, err)
+	}
+}
+
+// enqueue queues envelope for the connection.
+func (m *Member) enqueue(envelope Envelope) {
+	m.mu.Lock()
+	if m.left {
+		m.mu.Unlock()
+		return
+	}
+	if len(m.queue) >= memberQueueSize {
+		m.mu.Unlock()
+		metrics.ClusterEnvelopes.WithLabelValues("dropped").Inc()
+		log.Printf("Dropped an envelope for %s, whose connection is %d behind", envelope.To, memberQueueSize)
+		return
+	}
+	m.queue = append(m.queue, envelope)
+	m.mu.Unlock()
+
+	select {
+	case m.queued <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the queued envelopes in order until the member leaves.
+func (m *Member) run() {
+	for {
+		select {
+		case <-m.queued:
+		case <-m.done:
+			return
+		}
+		m.mu.Lock()
+		queue := m.queue
+		m.queue = nil
+		m.mu.Unlock()
+		for _, envelope := range queue {
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			m.deliver(envelope)
+		}
+	}
+}
+
+// Send routes envelope to every node holding connections at its address,
+// reporting how many there were.
+func (n *Node) Send(ctx context.Context, envelope Envelope) (int, error) {
+	nodes, err := n.transport.Nodes(ctx, envelope.To)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up %s: %w", envelope.To, err)
+	}
+	for _, node := range nodes {
+		if node == n.id {
+			metrics.ClusterEnvelopes.WithLabelValues("local").Inc()
+			n.deliver(envelope)
+			continue
+		}
+		if err := n.transport.Publish(ctx, node, envelope); err != nil {
+			return 0, fmt.Errorf("failed to route %s to node %s: %w", envelope.To, node, err)
+		}
+		metrics.ClusterEnvelopes.WithLabelValues("published").Inc()
+	}
+	return len(nodes), nil
+}
+
+// deliver passes envelope to the connections at its address on this node.
+func (n *Node) deliver(envelope Envelope) {
+	n.mu.Lock()
+	members := make([]*Member, 0, len(n.members[envelope.To]))
+	for member := range n.members[envelope.To] {
+		members = append(members, member)
+	}
+	n.mu.Unlock()
+	for _, member := range members {
+		member.enqueue(envelope)
+	}
+}
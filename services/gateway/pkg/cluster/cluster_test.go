@@ -0,0 +1,231 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// inbox collects the envelopes delivered to a connection.
+type inbox chan Envelope
+
+func (i inbox) deliver(envelope Envelope) {
+	i <- envelope
+}
+
+func (i inbox) next(t *testing.T) Envelope {
+	t.Helper()
+	select {
+	case envelope := <-i:
+		return envelope
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing delivered within 5s")
+		return Envelope{}
+	}
+}
+
+func (i inbox) empty(t *testing.T) {
+	t.Helper()
+	select {
+	case envelope := <-i:
+		t.Errorf("unexpected delivery %+v", envelope)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// testRouting runs two nodes, as two replicas would, and routes between
+// them.
+func testRouting(t *testing.T, transport func() Transport) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := NewNode("a", transport()), NewNode("b", transport())
+	for _, node := range []*Node{a, b} {
+		go node.Run(ctx)
+	}
+	// Let the nodes subscribe
+	time.Sleep(50 * time.Millisecond)
+
+	onA, onB, otherOnB := make(inbox, 10), make(inbox, 10), make(inbox, 10)
+	if _, err := a.Join(ctx, onA.deliver, User("u1")); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	member, err := b.Join(ctx, onB.deliver, User("u1"), Room("t1", "class"))
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if _, err := b.Join(ctx, otherOnB.deliver, User("u2")); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	frame := json.RawMessage(`{"type":"notice","content":"hi"}`)
+	if nodes, err := a.Send(ctx, Envelope{To: User("u1"), Frame: frame}); err != nil || nodes != 2 {
+		t.Fatalf("Send to user = %d nodes, %v", nodes, err)
+	}
+	for _, connection := range []inbox{onA, onB} {
+		if got := connection.next(t); string(got.Frame) != string(frame) {
+			t.Errorf("delivered %s", got.Frame)
+		}
+	}
+	otherOnB.empty(t)
+
+	// A single connection is reachable from any node
+	a.Send(ctx, Envelope{To: Address{Kind: KindConnection, ID: member.ID()}, Close: &Close{Code: 4000}})
+	if got := onB.next(t); got.Close == nil || got.Close.Code != 4000 {
+		t.Errorf("delivered %+v, want close", got)
+	}
+
+	member.Add(ctx, Conversation("u1", "c1"))
+	if nodes, _ := a.Send(ctx, Envelope{To: Conversation("u1", "c1"), Frame: frame}); nodes != 1 {
+		t.Errorf("conversation held on %d nodes", nodes)
+	}
+	onB.next(t)
+
+	member.Leave(ctx)
+	if nodes, err := a.Send(ctx, Envelope{To: Room("t1", "class"), Frame: frame}); err != nil || nodes != 0 {
+		t.Errorf("Send to an empty room = %d nodes, %v", nodes, err)
+	}
+	onB.empty(t)
+}
+
+func TestMemoryRouting(t *testing.T) {
+	transport := NewMemoryTransport()
+	testRouting(t, func() Transport { return transport })
+}
+
+func TestRedisRouting(t *testing.T) {
+	server := miniredis.RunT(t)
+	testRouting(t, func() Transport {
+		return NewRedisTransport(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Second)
+	})
+}
+
+func TestRedisPrunesDeadNodes(t *testing.T) {
+	server := miniredis.RunT(t)
+	transport := NewRedisTransport(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Second)
+	ctx := context.Background()
+	transport.Register(ctx, "dead", User("u1"))
+
+	server.FastForward(5 * time.Second)
+	if nodes, err := transport.Nodes(ctx, User("u1")); err != nil || len(nodes) != 0 {
+		t.Errorf("Nodes = %v, %v, want the dead node skipped", nodes, err)
+	}
+	if server.Exists(addressKey(User("u1"))) {
+		t.Error("the dead node was not pruned")
+	}
+}
+
+func TestDeliversInOrder(t *testing.T) {
+	ctx := context.Background()
+	node := NewNode("a", NewMemoryTransport())
+	connection := make(inbox, 100)
+	member, err := node.Join(ctx, func(envelope Envelope) {
+		// A slow connection holds up later envelopes rather than letting
+		// them overtake
+		time.Sleep(time.Millisecond)
+		connection.deliver(envelope)
+	}, User("u1"))
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	defer member.Leave(ctx)
+
+	for i := 0; i < 50; i++ {
+		node.Send(ctx, Envelope{To: User("u1"), Frame: json.RawMessage(fmt.Sprintf(`{"type":"notice","n":%d}`, i))})
+	}
+	node.Send(ctx, Envelope{To: User("u1"), Close: &Close{Code: 4000}})
+	for i := 0; i < 50; i++ {
+		if got, want := string(connection.next(t).Frame), fmt.Sprintf(`{"type":"notice","n":%d}`, i); got != want {
+			t.Fatalf("delivered %s, want %s", got, want)
+		}
+	}
+	if got := connection.next(t); got.Close == nil {
+		t.Errorf("delivered %+v last, want the close", got)
+	}
+}
+
+// stuckTransport blocks registering one address until released.
+type stuckTransport struct {
+	Transport
+	stuck   Address
+	release chan struct{}
+}
+
+func (s *stuckTransport) Register(ctx context.Context, node string, addr Address) error {
+	if addr == s.stuck {
+		<-s.release
+	}
+	return s.Transport.Register(ctx, node, addr)
+}
+
+func TestSlowRegistrationHoldsUpOnlyItsAddress(t *testing.T) {
+	ctx := context.Background()
+	transport := &stuckTransport{Transport: NewMemoryTransport(), stuck: Room("t1", "slow"), release: make(chan struct{})}
+	node := NewNode("a", transport)
+
+	joined := make(chan error, 1)
+	go func() {
+		_, err := node.Join(ctx, inbox(make(chan Envelope, 1)).deliver, Room("t1", "slow"))
+		joined <- err
+	}()
+	done := make(chan error, 1)
+	go func() {
+		member, err := node.Join(ctx, inbox(make(chan Envelope, 1)).deliver, User("u1"))
+		if err == nil {
+			member.Leave(ctx)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Join: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow registration held up other addresses")
+	}
+
+	close(transport.release)
+	if err := <-joined; err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if nodes, _ := node.Send(ctx, Envelope{To: Room("t1", "slow"), Frame: json.RawMessage(`{"type":"notice"}`)}); nodes != 1 {
+		t.Errorf("slow room held on %d nodes", nodes)
+	}
+}
+
+func TestServeSend(t *testing.T) {
+	node := NewNode("a", NewMemoryTransport())
+	connection := make(inbox, 1)
+	node.Join(context.Background(), connection.deliver, User("u1"))
+	handler := &Handler{Node: node}
+
+	for body, want := range map[string]int{
+		`{"to":{"kind":"user","id":"u1"},"frame":{"type":"notice"}}`:            http.StatusAccepted,
+		`{"to":{"kind":"user","id":"u1"},"close":{}}`:                           http.StatusAccepted,
+		`{"to":{"kind":"user","id":"u1"},"close":{"code":1000}}`:                http.StatusBadRequest,
+		`{"to":{"kind":"team","id":"t"},"frame":{"type":"notice"}}`:             http.StatusBadRequest,
+		`{"to":{"kind":"user","id":"u1"},"frame":{"content":"no type"}}`:        http.StatusBadRequest,
+		`{"to":{"kind":"user","id":"u1"},"frame":{"type":"notice"},"close":{}}`: http.StatusBadRequest,
+		`{"to":{"kind":"user","id":"u1"}}`:                                      http.StatusBadRequest,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeSend(recorder, httptest.NewRequest(http.MethodPost, "/v1/cluster/send", strings.NewReader(body)))
+		if recorder.Code != want {
+			t.Errorf("%s: status %d, want %d", body, recorder.Code, want)
+		}
+		if recorder.Code == http.StatusAccepted {
+			if got := connection.next(t); got.Close != nil && got.Close.Code != 1008 {
+				t.Errorf("default close code = %d", got.Close.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// pkg/cluster/http.go
+package cluster
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// maxEnvelopeBytes bounds the envelopes backends send.
+const maxEnvelopeBytes = 64 << 10
+
+// Handler lets backends reach connections on whichever replica holds them.
+type Handler struct {
+	Node *Node
+}
+
+type sendResponse struct {
+	// Nodes is the number of replicas holding connections at the address.
+	Nodes int `json:"nodes"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeSend answers POST with an envelope by routing it: its frame, a JSON
+// object with a type, is written to every connection at its address, or
+// with close instead they are disconnected. A close code of zero is sent
+// as 1008 (policy violation); others must be in the 4000-4999 range.
+func (h *Handler) ServeSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use POST"})
+		return
+	}
+	var envelope Envelope
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnvelopeBytes)).Decode(&envelope); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid envelope: " + err.Error()})
+		return
+	}
+	if problem := validate(&envelope); problem != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: problem})
+		return
+	}
+
+	nodes, err := h.Node.Send(r.Context(), envelope)
+	if err != nil {
+		log.Printf("Failed to send to %s: %v", envelope.To, err)
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "failed to route the envelope"})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, sendResponse{Nodes: nodes})
+}
+
+func validate(envelope *Envelope) string {
+	if !envelope.To.Valid() {
+		return "to needs a kind of connection, user, conversation or room and an id"
+	}
+	if (envelope.Frame == nil) == (envelope.Close == nil) {
+		return "set exactly one of frame and close"
+	}
+	if envelope.Close != nil {
+		if envelope.Close.Code == 0 {
+			envelope.Close.Code = 1008
+		}
+		if envelope.Close.Code != 1008 && (envelope.Close.Code < 4000 || envelope.Close.Code > 4999) {
+			return "close.code must be in the 4000-4999 range"
+		}
+		return ""
+	}
+	var frame struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(envelope.Frame, &frame); err != nil || frame.Type == "" {
+		return "frame must be a JSON object with a type"
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write cluster response: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// pkg/cluster/memory.go
+package cluster
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryTransport connects the nodes of a single process, which is all a
+// gateway without Redis needs: its one node routes to itself.
+type MemoryTransport struct {
+	mu        sync.Mutex
+	addresses map[Address]map[string]struct{}
+	inboxes   map[string]func(Envelope)
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		addresses: make(map[Address]map[string]struct{}),
+		inboxes:   make(map[string]func(Envelope)),
+	}
+}
+
+func (m *MemoryTransport) Register(ctx context.Context, node string, addr Address) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes, ok := m.addresses[addr]
+	if !ok {
+		nodes = make(map[string]struct{})
+		m.addresses[addr] = nodes
+	}
+	nodes[node] = struct{}{}
+	return nil
+}
+
+func (m *MemoryTransport) Unregister(ctx context.Context, node string, addr Address) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.addresses[addr], node)
+	if len(m.addresses[addr]) == 0 {
+		delete(m.addresses, addr)
+	}
+	return nil
+}
+
+func (m *MemoryTransport) Nodes(ctx context.Context, addr Address) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := make([]string, 0, len(m.addresses[addr]))
+	for node := range m.addresses[addr] {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// Publish delivers envelope before returning. Envelopes for a node that is
+// not running are dropped, as they are by Redis.
+func (m *MemoryTransport) Publish(ctx context.Context, node string, envelope Envelope) error {
+	m.mu.Lock()
+	deliver := m.inboxes[node]
+	m.mu.Unlock()
+	if deliver != nil {
+		deliver(envelope)
+	}
+	return nil
+}
+
+func (m *MemoryTransport) Subscribe(ctx context.Context, node string, deliver func(Envelope)) error {
+	m.mu.Lock()
+	m.inboxes[node] = deliver
+	m.mu.Unlock()
+	<-ctx.Done()
+	m.mu.Lock()
+	delete(m.inboxes, node)
+	m.mu.Unlock()
+	return nil
+}
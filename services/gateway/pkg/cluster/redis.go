@@ -0,0 +1,131 @@
+// pkg/cluster/redis.go
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "zephyr:cluster:"
+
+// RedisTransport keeps the nodes at each address in a set and sends each
+// node its envelopes on a pub/sub channel of its own. A node is live while
+// its heartbeat key exists; nodes that died without unregistering are
+// skipped and pruned from the sets they were left in.
+type RedisTransport struct {
+	client    *redis.Client
+	heartbeat time.Duration
+}
+
+// NewRedisTransport refreshes the heartbeat of a running node every
+// heartbeat. A node is taken for dead after missing three.
+func NewRedisTransport(client *redis.Client, heartbeat time.Duration) *RedisTransport {
+	return &RedisTransport{client: client, heartbeat: heartbeat}
+}
+
+func addressKey(addr Address) string {
+	return redisKeyPrefix + "addr:" + addr.Kind + ":" + addr.ID
+}
+
+func nodeKey(node string) string {
+	return redisKeyPrefix + "node:" + node
+}
+
+func inboxChannel(node string) string {
+	return redisKeyPrefix + "inbox:" + node
+}
+
+func (r *RedisTransport) Register(ctx context.Context, node string, addr Address) error {
+	// Refreshing the heartbeat too keeps a node that registers before its
+	// first one from being pruned
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, addressKey(addr), node)
+		pipe.Set(ctx, nodeKey(node), 1, 3*r.heartbeat)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisTransport) Unregister(ctx context.Context, node string, addr Address) error {
+	return r.client.SRem(ctx, addressKey(addr), node).Err()
+}
+
+func (r *RedisTransport) Nodes(ctx context.Context, addr Address) ([]string, error) {
+	key := addressKey(addr)
+	nodes, err := r.client.SMembers(ctx, key).Result()
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+
+	live := make([]*redis.IntCmd, len(nodes))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, node := range nodes {
+			live[i] = pipe.Exists(ctx, nodeKey(node))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	alive := nodes[:0]
+	for i, node := range nodes {
+		if live[i].Val() == 0 {
+			log.Printf("Pruning dead gateway node %s from %s", node, addr)
+			r.client.SRem(ctx, key, node)
+			continue
+		}
+		alive = append(alive, node)
+	}
+	return alive, nil
+}
+
+func (r *RedisTransport) Publish(ctx context.Context, node string, envelope Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+	return r.client.Publish(ctx, inboxChannel(node), data).Err()
+}
+
+func (r *RedisTransport) Subscribe(ctx context.Context, node string, deliver func(Envelope)) error {
+	sub := r.client.Subscribe(ctx, inboxChannel(node))
+	defer sub.Close()
+	// Receiving the confirmation makes sure envelopes published from now on
+	// arrive
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", inboxChannel(node), err)
+	}
+	if err := r.client.Set(ctx, nodeKey(node), 1, 3*r.heartbeat).Err(); err != nil {
+		log.Printf("Failed to refresh heartbeat of node %s: %v", node, err)
+	}
+	defer r.client.Del(context.Background(), nodeKey(node))
+
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.client.Set(ctx, nodeKey(node), 1, 3*r.heartbeat).Err(); err != nil {
+				log.Printf("Failed to refresh heartbeat of node %s: %v", node, err)
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var envelope Envelope
+			if err := json.Unmarshal([]byte(message.Payload), &envelope); err != nil {
+				log.Printf("Dropping malformed envelope for node %s: %v", node, err)
+				continue
+			}
+			deliver(envelope)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+// pkg/config/config.go
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// Config is the complete gateway configuration. Every leaf field can be set
+// from the config file by its yaml key path, from the environment as
+// ZEPHYR_<PATH> (e.g. ZEPHYR_SERVER_ADDR) and from a flag named after the
+// path (e.g. -server.addr). Fields tagged with env also accept that
+// variable, for compatibility with existing deployments.
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Providers   ProvidersConfig   `yaml:"providers"`
+	Generation  GenerationConfig  `yaml:"generation"`
+	Memory      MemoryConfig      `yaml:"memory"`
+	Redis       RedisConfig       `yaml:"redis"`
+	Auth        AuthConfig        `yaml:"auth"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Health      HealthConfig      `yaml:"health"`
+	Assistants  AssistantsConfig  `yaml:"assistants"`
+	Prompts     PromptsConfig     `yaml:"prompts"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Tools       ToolsConfig       `yaml:"tools"`
+	Lectures    LecturesConfig    `yaml:"lectures"`
+	Attachments AttachmentsConfig `yaml:"attachments"`
+	History     HistoryConfig     `yaml:"history"`
+	Resume      ResumeConfig      `yaml:"resume"`
+	Cluster     ClusterConfig     `yaml:"cluster"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr" usage:"WebSocket server address"`
+	// AllowedOrigins lists the browser origins allowed to open /chat. An
+	// empty list allows only the gateway's own origin, "*" allows any.
+	AllowedOrigins           []string `yaml:"allowed_origins" usage:"Comma-separated list of allowed browser origins (empty allows the same origin only, * allows any)"`
+	TrustForwardedFor        bool     `yaml:"trust_forwarded_for" usage:"Use the last X-Forwarded-For entry for the client IP (only behind a proxy that appends it)"`
+	MaxConcurrentGenerations int      `yaml:"max_concurrent_generations" usage:"Maximum concurrent generations per connection"`
+	// ShutdownTimeout is how long in-flight generations may keep streaming
+	// after SIGTERM before their connections are closed.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" usage:"How long to let in-flight generations finish on shutdown"`
+	// ReconnectDelay is the upper bound of the random reconnect hint sent to
+	// clients on shutdown, spreading their reconnects over that window.
+	ReconnectDelay time.Duration `yaml:"reconnect_delay" usage:"Maximum reconnect delay suggested to clients on shutdown"`
+	// The server pings every client each PingInterval and reaps connections
+	// that send nothing, not even a pong, for IdleTimeout.
+	PingInterval time.Duration `yaml:"ping_interval" usage:"How often to ping clients"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" usage:"Close connections silent for this long"`
+	WriteTimeout time.Duration `yaml:"write_timeout" usage:"Deadline for writing each frame to a client"`
+	// Each connection queues up to SendQueueSize frames for its client.
+	// SlowConsumerPolicy says what happens once a client lets it fill.
+	SendQueueSize      int    `yaml:"send_queue_size" usage:"Frames queued per connection for a slow client"`
+	SlowConsumerPolicy string `yaml:"slow_consumer_policy" usage:"What to do when a client's send queue fills (coalesce, drop, pause)"`
+}
+
+type ProvidersConfig struct {
+	Default    string       `yaml:"default" usage:"Default LLM provider (gemini, openai, echo, scripted)"`
+	Gemini     GeminiConfig `yaml:"gemini"`
+	OpenAI     OpenAIConfig `yaml:"openai"`
+	ScriptFile string       `yaml:"script_file" usage:"JSON script for the scripted provider"`
+}
+
+type GeminiConfig struct {
+	APIKey     string `yaml:"api_key" env:"GEMINI_API_KEY" secret:"true" usage:"Gemini API key"`
+	APIKeyFile string `yaml:"api_key_file" usage:"File containing the Gemini API key"`
+	BaseURL    string `yaml:"base_url" usage:"Gemini API base URL"`
+	Model      string `yaml:"model" usage:"Default Gemini model"`
+	// EmbeddingModel is used by the semantic response cache.
+	EmbeddingModel string `yaml:"embedding_model" usage:"Gemini embedding model"`
+}
+
+type OpenAIConfig struct {
+	BaseURL    string `yaml:"base_url" usage:"Base URL of an OpenAI-compatible API, e.g. http://localhost:11434/v1"`
+	APIKey     string `yaml:"api_key" env:"OPENAI_API_KEY" secret:"true" usage:"API key for the OpenAI-compatible provider"`
+	APIKeyFile string `yaml:"api_key_file" usage:"File containing the OpenAI-compatible API key"`
+	Model      string `yaml:"model" usage:"Default model for the OpenAI-compatible provider"`
+	// EmbeddingModel is used by the semantic response cache.
+	EmbeddingModel string `yaml:"embedding_model" usage:"Embedding model for the OpenAI-compatible provider"`
+}
+
+// GenerationConfig holds the sampling parameters sent with each request.
+// Models overrides Defaults per model name; zero fields of an override
+// inherit the default.
+type GenerationConfig struct {
+	Defaults GenerationParams            `yaml:"defaults"`
+	Models   map[string]GenerationParams `yaml:"models"`
+}
+
+type GenerationParams struct {
+	Temperature     float64 `yaml:"temperature" usage:"Sampling temperature"`
+	TopK            int     `yaml:"top_k" usage:"Top-k sampling"`
+	TopP            float64 `yaml:"top_p" usage:"Nucleus sampling probability"`
+	MaxOutputTokens int     `yaml:"max_output_tokens" usage:"Maximum tokens generated per reply"`
+}
+
+type MemoryConfig struct {
+	Backend     string        `yaml:"backend" usage:"Conversation memory backend (memory, redis, none)"`
+	TokenBudget int           `yaml:"token_budget" usage:"Maximum estimated tokens of conversation history sent to the provider"`
+	TTL         time.Duration `yaml:"ttl" usage:"How long an idle conversation is remembered"`
+	MaxTurns    int           `yaml:"max_turns" usage:"Maximum turns kept per conversation"`
+}
+
+type RedisConfig struct {
+	URL     string `yaml:"url" env:"REDIS_URL" secret:"true" usage:"Redis URL for shared gateway state"`
+	URLFile string `yaml:"url_file" usage:"File containing the Redis URL"`
+}
+
+type AuthConfig struct {
+	Required        bool   `yaml:"required" usage:"Require a valid JWT to open /chat"`
+	HS256Secret     string `yaml:"hs256_secret" env:"JWT_HS256_SECRET" secret:"true" usage:"HS256 signing secret"`
+	HS256SecretFile string `yaml:"hs256_secret_file" usage:"File containing the HS256 signing secret"`
+	RS256PublicKey  string `yaml:"rs256_public_key" usage:"PEM file with the RS256 public key"`
+	JWKSFile        string `yaml:"jwks_file" usage:"JWKS file with RS256/HS256 keys, reloaded when it changes"`
+	Issuer          string `yaml:"issuer" usage:"Required iss claim"`
+	Audience        string `yaml:"audience" usage:"Required aud claim"`
+	TenantClaim     string `yaml:"tenant_claim" usage:"Claim holding the tenant id"`
+}
+
+type RateLimitConfig struct {
+	Backend               string `yaml:"backend" usage:"Rate limiter backend (memory, redis, none)"`
+	UserMessagesPerMinute int    `yaml:"user_messages_per_minute" usage:"Chat messages per minute per user (0 disables)"`
+	UserMessagesBurst     int    `yaml:"user_messages_burst" usage:"Chat messages a user may send in a burst"`
+	IPMessagesPerMinute   int    `yaml:"ip_messages_per_minute" usage:"Chat messages per minute per client IP (0 disables)"`
+	MaxConcurrentPerUser  int    `yaml:"max_concurrent_per_user" usage:"Concurrent generations per user across connections (0 disables)"`
+	DailyTokenQuota       int64  `yaml:"daily_token_quota" usage:"Prompt plus output tokens per user per UTC day (0 disables)"`
+}
+
+// AssistantsConfig points at the subject-specialized assistant definitions.
+type AssistantsConfig struct {
+	Dir       string `yaml:"dir" usage:"Directory of assistant definitions, one YAML file each; empty disables assistants"`
+	Default   string `yaml:"default" usage:"Assistant for chats that do not name one"`
+	AutoRoute bool   `yaml:"auto_route" usage:"Pick an assistant by keywords when a chat does not name one"`
+}
+
+// PromptsConfig points at the prompt template library.
+type PromptsConfig struct {
+	Dir           string        `yaml:"dir" usage:"Directory of prompt templates, one YAML file per version; empty disables templates"`
+	WatchInterval time.Duration `yaml:"watch_interval" usage:"How often to check the template directory for changes; 0 reloads only on SIGHUP"`
+}
+
+// CacheConfig controls the response cache for repeated single-turn
+// questions.
+type CacheConfig struct {
+	Backend    string              `yaml:"backend" usage:"Response cache backend (memory, redis, none)"`
+	TTL        time.Duration       `yaml:"ttl" usage:"How long cached answers are reused"`
+	MaxEntries int                 `yaml:"max_entries" usage:"Answers kept by the memory backend"`
+	Semantic   SemanticCacheConfig `yaml:"semantic"`
+}
+
+// SemanticCacheConfig enables reusing answers to questions that are worded
+// differently but mean the same, compared by embedding similarity.
+type SemanticCacheConfig struct {
+	Enabled       bool    `yaml:"enabled" usage:"Also reuse answers to similar questions"`
+	Provider      string  `yaml:"provider" usage:"Provider whose embedding model compares questions (gemini, openai)"`
+	Threshold     float64 `yaml:"threshold" usage:"Minimum cosine similarity to reuse an answer"`
+	MaxCandidates int     `yaml:"max_candidates" usage:"Questions compared per assistant and configuration"`
+}
+
+// ToolsConfig controls the tools models can call during chats. Each
+// assistant lists the tools it may use.
+type ToolsConfig struct {
+	Enabled   bool          `yaml:"enabled" usage:"Let models call the tools their assistant lists"`
+	MaxRounds int           `yaml:"max_rounds" usage:"Tool call rounds per generation before the model must answer"`
+	Timeout   time.Duration `yaml:"timeout" usage:"Default timeout of a tool call"`
+	// Timeouts overrides Timeout per tool name.
+	Timeouts      map[string]time.Duration `yaml:"timeouts"`
+	LectureSearch LectureSearchConfig      `yaml:"lecture_search"`
+}
+
+// LectureSearchConfig connects the lecture_search tool to the processing
+// service. Frames are indexed by image embedding, so the embedding provider
+// must encode text into the same vector space.
+type LectureSearchConfig struct {
+	URL               string  `yaml:"url" usage:"Processing API base URL for lecture_search; empty disables the tool"`
+	EmbeddingProvider string  `yaml:"embedding_provider" usage:"Provider whose embedding model encodes lecture search queries (gemini, openai)"`
+	Threshold         float64 `yaml:"threshold" usage:"Minimum similarity of a matching frame (0 uses the processing service default)"`
+}
+
+// LecturesConfig connects chats that name a video_id to the processing
+// pipeline's database, to answer from the text on that lecture's frames.
+type LecturesConfig struct {
+	DSN       string `yaml:"dsn" secret:"true" usage:"Processing database DSN, e.g. user:pass@tcp(singlestore:3306)/video_analysis; empty disables lecture chats"`
+	DSNFile   string `yaml:"dsn_file" usage:"File containing the processing database DSN"`
+	MaxFrames int    `yaml:"max_frames" usage:"Frames of a video added to a prompt"`
+}
+
+// AttachmentsConfig limits the files chats can carry, inline or uploaded
+// ahead through /v1/uploads.
+type AttachmentsConfig struct {
+	MaxBytes          int           `yaml:"max_bytes" usage:"Largest attachment accepted, in bytes, before downscaling"`
+	MaxImageDimension int           `yaml:"max_image_dimension" usage:"Longest side images are downscaled to, in pixels (0 keeps the original size)"`
+	UploadBackend     string        `yaml:"upload_backend" usage:"Upload store backend (memory, redis, none)"`
+	UploadTTL         time.Duration `yaml:"upload_ttl" usage:"How long uploads can be attached"`
+	MaxUploadMemory   int           `yaml:"max_upload_memory" usage:"Total bytes of uploads the memory backend keeps"`
+}
+
+// HistoryConfig persists conversations for users to list, rename, delete
+// and export through /v1/conversations.
+type HistoryConfig struct {
+	Backend string `yaml:"backend" usage:"Conversation history backend (sqlite, postgres, none)"`
+	DSN     string `yaml:"dsn" env:"DATABASE_URL" secret:"true" usage:"History database: a file path for sqlite, a postgres:// URL for postgres"`
+	DSNFile string `yaml:"dsn_file" usage:"File containing the history database DSN"`
+}
+
+// ResumeConfig controls the replay buffer that lets clients resume a
+// generation after losing their connection.
+type ResumeConfig struct {
+	Backend   string        `yaml:"backend" usage:"Replay buffer backend for resuming streams (memory, redis, none)"`
+	Retention time.Duration `yaml:"retention" usage:"How long a stream can be resumed after its last frame"`
+	MaxFrames int           `yaml:"max_frames" usage:"Frames buffered per generation; older ones cannot be resumed (0 keeps all)"`
+}
+
+// ClusterConfig controls how replicas find the one holding a client's
+// connection, to route messages for users, conversations and rooms to it.
+type ClusterConfig struct {
+	Backend string `yaml:"backend" usage:"Cluster routing backend (memory for a single replica, redis)"`
+	// NodeID names this replica. Empty picks the host name with a random
+	// suffix.
+	NodeID    string        `yaml:"node_id" usage:"Name of this replica in the cluster (empty generates one)"`
+	Heartbeat time.Duration `yaml:"heartbeat" usage:"How often a replica tells the others it is alive"`
+}
+
+// HealthConfig controls the dependency checks behind /readyz.
+type HealthConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval" usage:"How often to check providers and Redis for /readyz"`
+	CheckTimeout  time.Duration `yaml:"check_timeout" usage:"Timeout for each readiness check"`
+}
+
+// Default returns the configuration used for anything not set explicitly.
+// It deliberately contains no credentials.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:                     ":8000",
+			MaxConcurrentGenerations: 4,
+			ShutdownTimeout:          30 * time.Second,
+			ReconnectDelay:           5 * time.Second,
+			PingInterval:             25 * time.Second,
+			IdleTimeout:              60 * time.Second,
+			WriteTimeout:             10 * time.Second,
+			SendQueueSize:            256,
+			SlowConsumerPolicy:       "coalesce",
+		},
+		Providers: ProvidersConfig{
+			Default: "gemini",
+			Gemini: GeminiConfig{
+				BaseURL:        llm.DefaultGeminiBaseURL,
+				Model:          llm.DefaultGeminiModel,
+				EmbeddingModel: llm.DefaultGeminiEmbeddingModel,
+			},
+		},
+		Generation: GenerationConfig{
+			Defaults: GenerationParams{
+				Temperature:     0.7,
+				TopK:            40,
+				TopP:            0.95,
+				MaxOutputTokens: 2048,
+			},
+		},
+		Memory: MemoryConfig{
+			Backend:     "memory",
+			TokenBudget: 4000,
+			TTL:         24 * time.Hour,
+			MaxTurns:    100,
+		},
+		Auth: AuthConfig{
+			Required:    true,
+			TenantClaim: "tenant_id",
+		},
+		RateLimit: RateLimitConfig{
+			Backend:               "memory",
+			UserMessagesPerMinute: 20,
+			UserMessagesBurst:     5,
+			IPMessagesPerMinute:   60,
+			MaxConcurrentPerUser:  6,
+			DailyTokenQuota:       200000,
+		},
+		Health: HealthConfig{
+			CheckInterval: 30 * time.Second,
+			CheckTimeout:  5 * time.Second,
+		},
+		Assistants: AssistantsConfig{
+			Default: "general",
+		},
+		Prompts: PromptsConfig{
+			WatchInterval: 10 * time.Second,
+		},
+		Cache: CacheConfig{
+			Backend:    "none",
+			TTL:        24 * time.Hour,
+			MaxEntries: 10000,
+			Semantic: SemanticCacheConfig{
+				Provider:      "gemini",
+				Threshold:     0.95,
+				MaxCandidates: 1000,
+			},
+		},
+		Tools: ToolsConfig{
+			Enabled:   true,
+			MaxRounds: 5,
+			Timeout:   10 * time.Second,
+			LectureSearch: LectureSearchConfig{
+				EmbeddingProvider: "gemini",
+			},
+		},
+		Lectures: LecturesConfig{
+			MaxFrames: 8,
+		},
+		Attachments: AttachmentsConfig{
+			MaxBytes:          8 << 20,
+			MaxImageDimension: 2048,
+			UploadBackend:     "memory",
+			UploadTTL:         time.Hour,
+			MaxUploadMemory:   256 << 20,
+		},
+		History: HistoryConfig{
+			Backend: "none",
+		},
+		Resume: ResumeConfig{
+			Backend:   "memory",
+			Retention: 2 * time.Minute,
+			MaxFrames: 4096,
+		},
+		Cluster: ClusterConfig{
+			Backend:   "memory",
+			Heartbeat: 10 * time.Second,
+		},
+	}
+}
+
+// revokedKeys holds SHA-256 digests of API keys that were once compiled into
+// the gateway. They are public and must never be used again.
+var revokedKeys = map[string]bool{
+	"859a68d7be6af6501ddd2fa0b4da34cd1250543ec66b4ae8fabd1d27fd3ba931": true,
+}
+
+// ErrRevokedKey is returned by Validate when a configured API key is one
+// that has been published.
+var ErrRevokedKey = errors.New("API key is a published default key; issue a new key")
+
+func isRevokedKey(key string) bool {
+	sum := sha256.Sum256([]byte(key))
+	return revokedKeys[hex.EncodeToString(sum[:])]
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+	var problems []error
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.Addr == "" {
+		fail("server.addr is required")
+	}
+	if c.Server.MaxConcurrentGenerations < 1 {
+		fail("server.max_concurrent_generations must be at least 1")
+	}
+	if c.Server.ShutdownTimeout <= 0 || c.Server.ReconnectDelay < 0 {
+		fail("server.shutdown_timeout must be positive and server.reconnect_delay not negative")
+	}
+	if c.Server.PingInterval <= 0 || c.Server.WriteTimeout <= 0 {
+		fail("server.ping_interval and server.write_timeout must be positive")
+	}
+	if c.Server.IdleTimeout <= c.Server.PingInterval {
+		fail("server.idle_timeout must be longer than server.ping_interval")
+	}
+	if c.Server.SendQueueSize < 1 {
+		fail("server.send_queue_size must be at least 1")
+	}
+	if !oneOf(c.Server.SlowConsumerPolicy, "coalesce", "drop", "pause") {
+		fail("unknown server.slow_consumer_policy %q", c.Server.SlowConsumerPolicy)
+	}
+
+	switch c.Providers.Default {
+	case "echo":
+	case "gemini":
+		if c.Providers.Gemini.APIKey == "" {
+			fail("providers.default is gemini but no Gemini API key is configured (set GEMINI_API_KEY or providers.gemini.api_key_file)")
+		}
+	case "openai":
+		if c.Providers.OpenAI.BaseURL == "" {
+			fail("providers.default is openai but providers.openai.base_url is empty")
+		}
+	case "scripted":
+		if c.Providers.ScriptFile == "" {
+			fail("providers.default is scripted but providers.script_file is empty")
+		}
+	default:
+		fail("unknown providers.default %q", c.Providers.Default)
+	}
+	for name, key := range map[string]string{"gemini": c.Providers.Gemini.APIKey, "openai": c.Providers.OpenAI.APIKey} {
+		if key != "" && isRevokedKey(key) {
+			problems = append(problems, fmt.Errorf("providers.%s.api_key: %w", name, ErrRevokedKey))
+		}
+	}
+
+	problems = append(problems, c.Generation.Defaults.validate("generation.defaults")...)
+	for model, params := range c.Generation.Models {
+		problems = append(problems, params.validate(fmt.Sprintf("generation.models[%s]", model))...)
+	}
+
+	if !oneOf(c.Memory.Backend, "memory", "redis", "none") {
+		fail("unknown memory.backend %q", c.Memory.Backend)
+	}
+	if !oneOf(c.RateLimit.Backend, "memory", "redis", "none") {
+		fail("unknown rate_limit.backend %q", c.RateLimit.Backend)
+	}
+	if !oneOf(c.Cache.Backend, "memory", "redis", "none") {
+		fail("unknown cache.backend %q", c.Cache.Backend)
+	}
+	if !oneOf(c.Attachments.UploadBackend, "memory", "redis", "none") {
+		fail("unknown attachments.upload_backend %q", c.Attachments.UploadBackend)
+	}
+	if !oneOf(c.History.Backend, "sqlite", "postgres", "none") {
+		fail("unknown history.backend %q", c.History.Backend)
+	}
+	if !oneOf(c.Resume.Backend, "memory", "redis", "none") {
+		fail("unknown resume.backend %q", c.Resume.Backend)
+	}
+	if !oneOf(c.Cluster.Backend, "memory", "redis") {
+		fail("unknown cluster.backend %q", c.Cluster.Backend)
+	}
+	if c.History.Backend != "none" && c.History.DSN == "" {
+		fail("history.backend %s requires history.dsn", c.History.Backend)
+	}
+	if (c.Memory.Backend == "redis" || c.RateLimit.Backend == "redis" || c.Cache.Backend == "redis" || c.Attachments.UploadBackend == "redis" || c.Resume.Backend == "redis" || c.Cluster.Backend == "redis") && c.Redis.URL == "" {
+		fail("a redis backend requires redis.url")
+	}
+	if c.Memory.TTL < 0 || c.Memory.MaxTurns < 0 {
+		fail("memory.ttl and memory.max_turns must not be negative")
+	}
+	if c.Resume.Backend != "none" && (c.Resume.Retention <= 0 || c.Resume.MaxFrames < 0) {
+		fail("resume.retention must be positive and resume.max_frames not negative")
+	}
+	if c.Cluster.Heartbeat <= 0 {
+		fail("cluster.heartbeat must be positive")
+	}
+
+	if c.Health.CheckInterval <= 0 || c.Health.CheckTimeout <= 0 {
+		fail("health.check_interval and health.check_timeout must be positive")
+	}
+	if c.Assistants.Dir != "" && c.Assistants.Default == "" {
+		fail("assistants.default is required when assistants.dir is set")
+	}
+	if c.Cache.Backend != "none" {
+		if c.Cache.TTL <= 0 {
+			fail("cache.ttl must be positive")
+		}
+		if semantic := c.Cache.Semantic; semantic.Enabled {
+			if !oneOf(semantic.Provider, "gemini", "openai") {
+				fail("cache.semantic.provider must be gemini or openai")
+			}
+			if semantic.Threshold <= 0 || semantic.Threshold > 1 {
+				fail("cache.semantic.threshold must be in (0, 1]")
+			}
+		}
+	}
+	if c.Prompts.WatchInterval < 0 {
+		fail("prompts.watch_interval must not be negative")
+	}
+	if c.Tools.Enabled {
+		if c.Tools.MaxRounds <= 0 || c.Tools.Timeout <= 0 {
+			fail("tools.max_rounds and tools.timeout must be positive")
+		}
+		for name, timeout := range c.Tools.Timeouts {
+			if timeout <= 0 {
+				fail("tools.timeouts.%s must be positive", name)
+			}
+		}
+		if search := c.Tools.LectureSearch; search.URL != "" {
+			if !oneOf(search.EmbeddingProvider, "gemini", "openai") {
+				fail("tools.lecture_search.embedding_provider must be gemini or openai")
+			}
+			if search.Threshold < 0 || search.Threshold > 1 {
+				fail("tools.lecture_search.threshold must be between 0 and 1")
+			}
+		}
+	}
+	if c.Attachments.MaxBytes <= 0 || c.Attachments.MaxImageDimension < 0 {
+		fail("attachments.max_bytes must be positive and attachments.max_image_dimension must not be negative")
+	}
+	if c.Attachments.UploadBackend != "none" && c.Attachments.UploadTTL <= 0 {
+		fail("attachments.upload_ttl must be positive")
+	}
+	if c.Lectures.DSN != "" && c.Lectures.MaxFrames <= 0 {
+		fail("lectures.max_frames must be positive")
+	}
+
+	if c.Auth.Required && c.Auth.HS256Secret == "" && c.Auth.HS256SecretFile == "" && c.Auth.RS256PublicKey == "" && c.Auth.JWKSFile == "" {
+		fail("no JWT keys configured; set auth.required=false to run without authentication")
+	}
+
+	return errors.Join(problems...)
+}
+
+// validate checks explicitly set parameters; zero values are allowed so
+// per-model overrides can leave fields unset.
+func (p GenerationParams) validate(path string) []error {
+	var problems []error
+	if p.Temperature < 0 || p.Temperature > 2 {
+		problems = append(problems, fmt.Errorf("%s.temperature must be between 0 and 2", path))
+	}
+	if p.TopP < 0 || p.TopP > 1 {
+		problems = append(problems, fmt.Errorf("%s.top_p must be between 0 and 1", path))
+	}
+	if p.TopK < 0 {
+		problems = append(problems, fmt.Errorf("%s.top_k must not be negative", path))
+	}
+	if p.MaxOutputTokens < 0 {
+		problems = append(problems, fmt.Errorf("%s.max_output_tokens must not be negative", path))
+	}
+	return problems
+}
+
+// GenerationFor returns the sampling parameters for model, falling back to
+// the provider's configured default model when model is empty.
+func (c *Config) GenerationFor(provider, model string) llm.GenerationConfig {
+	if model == "" {
+		switch provider {
+		case "gemini":
+			model = c.Providers.Gemini.Model
+		case "openai":
+			model = c.Providers.OpenAI.Model
+		}
+	}
+
+	params := c.Generation.Defaults
+	if override, ok := c.Generation.Models[model]; ok {
+		if override.Temperature != 0 {
+			params.Temperature = override.Temperature
+		}
+		if override.TopK != 0 {
+			params.TopK = override.TopK
+		}
+		if override.TopP != 0 {
+			params.TopP = override.TopP
+		}
+		if override.MaxOutputTokens != 0 {
+			params.MaxOutputTokens = override.MaxOutputTokens
+		}
+	}
+
+	return llm.GenerationConfig{
+		Temperature:     params.Temperature,
+		TopK:            params.TopK,
+		TopP:            params.TopP,
+		MaxOutputTokens: params.MaxOutputTokens,
+	}
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+// pkg/config/load.go
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to the upper-cased key path of every setting to
+// form its environment variable.
+const EnvPrefix = "ZEPHYR_"
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, the config file named by -config or ZEPHYR_CONFIG, the
+// environment and args. Secret files are read and the result validated.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv(EnvPrefix+"CONFIG"), "YAML or TOML config file")
+
+	cfg := Default()
+	overrides := map[string]string{}
+	walk(cfg, func(f field) {
+		flags.Func(f.path, f.usage(), func(value string) error {
+			overrides[f.path] = value
+			return f.set(value)
+		})
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Flags were applied to the defaults while parsing; start over now that
+	// the config file is known so they end up on top.
+	cfg = Default()
+	if *configPath != "" {
+		if err := loadFile(*configPath, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	walk(cfg, func(f field) {
+		value, ok := overrides[f.path]
+		source := "flag -" + f.path
+		if !ok {
+			value, source, ok = f.lookupEnv()
+		}
+		if !ok {
+			return
+		}
+		if err := f.set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", source, err))
+		}
+	})
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by extension, over cfg. TOML
+// is converted to YAML first so both formats share the yaml struct tags and
+// duration parsing.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to convert config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readSecretFiles replaces secrets with the contents of their *_file
+// setting, so they can be mounted as Docker or Kubernetes secrets instead
+// of being passed through the environment. The JWT secret file is left to
+// the auth package, which re-reads it when it is rotated.
+func (c *Config) readSecretFiles() error {
+	secrets := []struct {
+		path   string
+		target *string
+	}{
+		{c.Providers.Gemini.APIKeyFile, &c.Providers.Gemini.APIKey},
+		{c.Providers.OpenAI.APIKeyFile, &c.Providers.OpenAI.APIKey},
+		{c.Redis.URLFile, &c.Redis.URL},
+		{c.Lectures.DSNFile, &c.Lectures.DSN},
+		{c.History.DSNFile, &c.History.DSN},
+	}
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("failed to read secret file: %w", err)
+		}
+		*secret.target = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with secrets masked, safe to log.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	walk(&redacted, func(f field) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("[redacted]")
+		}
+	})
+	return redacted
+}
+
+// field is a settable leaf of Config.
+type field struct {
+	path   string
+	env    string
+	secret bool
+	tag    reflect.StructField
+	value  reflect.Value
+}
+
+func (f field) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.path, ".", "_"))
+}
+
+func (f field) usage() string {
+	return fmt.Sprintf("%s (env %s)", f.tag.Tag.Get("usage"), f.envName())
+}
+
+func (f field) lookupEnv() (value, source string, ok bool) {
+	name := f.envName()
+	if value, ok := os.LookupEnv(name); ok {
+		return value, "env " + name, true
+	}
+	if f.env != "" {
+		if value, ok := os.LookupEnv(f.env); ok {
+			return value, "env " + f.env, true
+		}
+	}
+	return "", "", false
+}
+
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
+
+// walk calls fn for every leaf setting of cfg. Maps such as per-model
+// generation overrides can only be set from the config file.
+func walk(cfg *Config, fn func(field)) {
+	walkStruct(reflect.ValueOf(cfg).Elem(), "", fn)
+}
+
+func walkStruct(v reflect.Value, prefix string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		fv := v.Field(i)
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			walkStruct(fv, path+".", fn)
+		case fv.Kind() == reflect.Map:
+			continue
+		default:
+			fn(field{
+				path:   path,
+				env:    sf.Tag.Get("env"),
+				secret: sf.Tag.Get("secret") == "true",
+				tag:    sf,
+				value:  fv,
+			})
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "gateway.yaml", `
+server:
+  addr: ":9000"
+  allowed_origins: ["https://file.example"]
+providers:
+  default: echo
+memory:
+  token_budget: 1000
+  ttl: 2h
+auth:
+  required: false
+`)
+	t.Setenv("ZEPHYR_CONFIG", path)
+	t.Setenv("ZEPHYR_MEMORY_TOKEN_BUDGET", "2000")
+	t.Setenv("ZEPHYR_SERVER_ADDR", ":9100")
+
+	cfg, err := Load([]string{"-server.addr", ":9200"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Addr != ":9200" {
+		t.Errorf("addr = %q, want the flag value", cfg.Server.Addr)
+	}
+	if cfg.Memory.TokenBudget != 2000 {
+		t.Errorf("token budget = %d, want the env value", cfg.Memory.TokenBudget)
+	}
+	if cfg.Memory.TTL.Hours() != 2 || len(cfg.Server.AllowedOrigins) != 1 {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.Memory.MaxTurns != 100 {
+		t.Errorf("max turns = %d, want the default", cfg.Memory.MaxTurns)
+	}
+}
+
+func TestLoadTOMLWithSecretFileAndModelDefaults(t *testing.T) {
+	keyFile := writeFile(t, "gemini-key", "test-key\n")
+	path := writeFile(t, "gateway.toml", `
+[providers.gemini]
+api_key_file = "`+keyFile+`"
+
+[auth]
+required = false
+
+[generation.models."gemini-1.5-pro"]
+temperature = 0.2
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Providers.Gemini.APIKey != "test-key" {
+		t.Errorf("api key = %q, want the secret file contents", cfg.Providers.Gemini.APIKey)
+	}
+
+	pro := cfg.GenerationFor("gemini", "gemini-1.5-pro")
+	if pro.Temperature != 0.2 || pro.MaxOutputTokens != 2048 {
+		t.Errorf("gemini-1.5-pro config = %+v, want overridden temperature and default max tokens", pro)
+	}
+	if flash := cfg.GenerationFor("gemini", ""); flash.Temperature != 0.7 {
+		t.Errorf("default model config = %+v, want the defaults", flash)
+	}
+}
+
+func TestLoadRejectsRevokedKey(t *testing.T) {
+	// A stand-in for a published key, revoked for this test only
+	const key = "test-revoked-key"
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+	revokedKeys[digest] = true
+	t.Cleanup(func() { delete(revokedKeys, digest) })
+
+	t.Setenv("GEMINI_API_KEY", key)
+	_, err := Load([]string{"-auth.required=false"})
+	if !errors.Is(err, ErrRevokedKey) {
+		t.Fatalf("err = %v, want ErrRevokedKey", err)
+	}
+}
+
+func TestLoadRequiresGeminiKey(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	if _, err := Load([]string{"-auth.required=false"}); err == nil {
+		t.Fatal("expected an error without a Gemini API key")
+	}
+}
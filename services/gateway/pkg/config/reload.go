@@ -0,0 +1,82 @@
+// pkg/config/reload.go
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Manager holds the live configuration and reloads it on SIGHUP. A reload
+// that fails to load or validate is logged and the previous configuration
+// stays in effect.
+type Manager struct {
+	args    []string
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(old, updated *Config)
+}
+
+// NewManager loads the initial configuration from args.
+func NewManager(args []string) (*Manager, error) {
+	cfg, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{args: args}
+	m.current.Store(cfg)
+	return m, nil
+}
+
+// Current returns the configuration in effect. Callers must not modify it.
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// OnReload registers fn to be called after every successful reload.
+func (m *Manager) OnReload(fn func(old, updated *Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Reload re-reads the config file and environment with the original flags.
+func (m *Manager) Reload() error {
+	cfg, err := Load(m.args)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.current.Swap(cfg)
+	for _, fn := range m.listeners {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// WatchSignals reloads the configuration on every SIGHUP until ctx is done.
+func (m *Manager) WatchSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := m.Reload(); err != nil {
+				log.Printf("Config reload failed, keeping previous configuration: %v", err)
+				continue
+			}
+			log.Printf("Configuration reloaded")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// pkg/health/health.go
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Overall readiness states reported by /readyz.
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+	StatusNotReady = "not_ready"
+	StatusDraining = "draining"
+)
+
+// Check is a dependency probe. A failing critical check makes the gateway
+// not ready; a failing non-critical one only marks it degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+// Result is the last outcome of a check.
+type Result struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	// Error says how a failing check failed, without the probe's own error,
+	// which can hold upstream URLs and credentials; that is only logged.
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Report is the body of /readyz.
+type Report struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+// Checker runs its checks in the background and serves the cached results,
+// so probes are cheap and upstream providers see one request per interval
+// per replica however often Kubernetes asks.
+type Checker struct {
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+	// Draining reports whether the gateway is shutting down.
+	Draining func() bool
+
+	started time.Time
+	mu      sync.RWMutex
+	results map[string]Result
+}
+
+func NewChecker(interval, timeout time.Duration, checks ...Check) *Checker {
+	results := make(map[string]Result, len(checks))
+	for _, check := range checks {
+		results[check.Name] = Result{Status: "pending", Critical: check.Critical}
+	}
+	return &Checker{
+		checks:   checks,
+		interval: interval,
+		timeout:  timeout,
+		started:  time.Now(),
+		results:  results,
+	}
+}
+
+// Run checks every dependency now and then every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.runChecks(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) runChecks(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result, err := c.run(ctx, check)
+
+			c.mu.Lock()
+			previous := c.results[check.Name]
+			c.results[check.Name] = result
+			c.mu.Unlock()
+
+			if result.Status != previous.Status {
+				if err != nil {
+					log.Printf("Health check %s is %s: %v", check.Name, result.Status, err)
+				} else {
+					log.Printf("Health check %s is %s", check.Name, result.Status)
+				}
+			}
+		}(check)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) run(ctx context.Context, check Check) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+	result := Result{
+		Status:    "ok",
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		result.Status = "failing"
+		result.Error = "probe failed"
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "timed out"
+		}
+	}
+	return result, err
+}
+
+// Report returns the cached readiness of the gateway.
+func (c *Checker) Report() Report {
+	report := Report{Status: StatusReady, Checks: make(map[string]Result)}
+
+	c.mu.RLock()
+	for name, result := range c.results {
+		report.Checks[name] = result
+		if result.Status == "ok" {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusNotReady
+		} else if report.Status == StatusReady {
+			report.Status = StatusDegraded
+		}
+	}
+	c.mu.RUnlock()
+
+	if c.Draining != nil && c.Draining() {
+		report.Draining = true
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+// ServeReady answers /readyz: 200 when ready or degraded, 503 otherwise.
+func (c *Checker) ServeReady(w http.ResponseWriter, r *http.Request) {
+	report := c.Report()
+	status := http.StatusOK
+	if report.Status == StatusNotReady || report.Status == StatusDraining {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// ServeLive answers /healthz. It only shows the process is serving HTTP;
+// dependencies belong in /readyz so an upstream outage does not get every
+// replica restarted.
+func (c *Checker) ServeLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(c.started).Seconds()),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write health response: %v", err)
+	}
+}
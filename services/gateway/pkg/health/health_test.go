@@ -0,0 +1,40 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyHidesProbeErrors(t *testing.T) {
+	checker := NewChecker(time.Minute, 50*time.Millisecond,
+		Check{Name: "gemini", Critical: true, Probe: func(ctx context.Context) error {
+			return errors.New(`Get "https://example.com/models?key=secret": connection refused`)
+		}},
+		Check{Name: "redis", Probe: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+	checker.runChecks(context.Background())
+
+	recorder := httptest.NewRecorder()
+	checker.ServeReady(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", recorder.Code)
+	}
+	if body := recorder.Body.String(); strings.Contains(body, "secret") {
+		t.Errorf("/readyz leaked the probe error: %s", body)
+	}
+	report := checker.Report()
+	if got := report.Checks["gemini"].Error; got != "probe failed" {
+		t.Errorf("gemini error = %q", got)
+	}
+	if got := report.Checks["redis"].Error; got != "timed out" {
+		t.Errorf("redis error = %q", got)
+	}
+}
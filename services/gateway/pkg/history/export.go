@@ -0,0 +1,44 @@
+// pkg/history/export.go
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExportJSON writes c with its messages as indented JSON.
+func ExportJSON(w io.Writer, c *Conversation) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// ExportMarkdown writes c as a Markdown document with a section per
+// message. Message content is already Markdown and is written as is.
+func ExportMarkdown(w io.Writer, c *Conversation) error {
+	var b strings.Builder
+	title := c.Title
+	if title == "" {
+		title = "Untitled conversation"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "_%d messages, started %s_\n", len(c.Messages), c.CreatedAt.Format(time.RFC1123))
+
+	for _, m := range c.Messages {
+		speaker := "You"
+		if m.Role == RoleAssistant {
+			speaker = "Assistant"
+			if name, ok := m.Metadata["assistant"].(string); ok && name != "" {
+				speaker += " (" + name + ")"
+			}
+		}
+		fmt.Fprintf(&b, "\n## %s · %s\n\n", speaker, m.CreatedAt.Format("2006-01-02 15:04 MST"))
+		b.WriteString(strings.TrimSpace(m.Content))
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
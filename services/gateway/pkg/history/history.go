@@ -0,0 +1,103 @@
+// pkg/history/history.go
+package history
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Message roles. Model turns are stored as assistant, the name clients and
+// exports use.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Page sizes for ListConversations.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// maxTitleLength bounds titles, whether derived from the first message or
+// set by a rename.
+const maxTitleLength = 120
+
+var (
+	// ErrNotFound is returned for conversations that do not exist or belong
+	// to another user, which callers cannot tell apart.
+	ErrNotFound      = errors.New("conversation not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Conversation is a persisted chat owned by one user. Messages is only
+// filled by GetConversation.
+type Conversation struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	MessageCount int       `json:"message_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Messages     []Message `json:"messages,omitempty"`
+}
+
+// Message is one turn of a conversation. Attachments are not stored; user
+// messages hold a note naming each one instead.
+type Message struct {
+	Seq       int            `json:"seq"`
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	MessageID string         `json:"message_id,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ListOptions selects a page of conversations. Cursor is the NextCursor of
+// the previous page, empty for the first.
+type ListOptions struct {
+	Limit  int
+	Cursor string
+}
+
+// Page is a page of conversations, most recently updated first. NextCursor
+// is empty on the last page.
+type Page struct {
+	Conversations []Conversation `json:"conversations"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// Repository persists conversations beyond the lifetime of a connection.
+// Every method is scoped to an owner, the authenticated user id.
+type Repository interface {
+	// Append adds messages to a conversation, creating it for owner on
+	// first use with a title taken from its first user message.
+	Append(ctx context.Context, owner, conversationID string, messages ...Message) error
+	ListConversations(ctx context.Context, owner string, opts ListOptions) (*Page, error)
+	// GetConversation returns a conversation with its messages, oldest
+	// first.
+	GetConversation(ctx context.Context, owner, conversationID string) (*Conversation, error)
+	Rename(ctx context.Context, owner, conversationID, title string) error
+	Delete(ctx context.Context, owner, conversationID string) error
+}
+
+// Title derives a conversation title from its first user message: the
+// first line, shortened to a whole word.
+func Title(content string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	return truncate(strings.TrimSpace(line), 60)
+}
+
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)[:limit]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut) + "…"
+}
@@ -0,0 +1,172 @@
+//go:build cgo
+
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+)
+
+func openTestRepository(t *testing.T) *SQLRepository {
+	t.Helper()
+	repo, err := Open(context.Background(), "sqlite", filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func exchange(question, answer string) []Message {
+	return []Message{
+		{Role: RoleUser, Content: question},
+		{Role: RoleAssistant, Content: answer, Metadata: map[string]any{"assistant": "physics"}},
+	}
+}
+
+func TestSQLRepositoryScopesConversationsToOwner(t *testing.T) {
+	ctx := context.Background()
+	repo := openTestRepository(t)
+
+	if err := repo.Append(ctx, "alice", "c1", exchange("What is entropy?\nIn short.", "A measure of disorder.")...); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := repo.Append(ctx, "alice", "c1", exchange("And enthalpy?", "Heat content.")...); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// Another user choosing the same id gets a conversation of their own
+	if err := repo.Append(ctx, "mallory", "c1", exchange("Mine now", "No.")...); err != nil {
+		t.Fatalf("Append with another user's id: %v", err)
+	}
+
+	c, err := repo.GetConversation(ctx, "alice", "c1")
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	if c.Title != "What is entropy?" || c.MessageCount != 4 || len(c.Messages) != 4 {
+		t.Fatalf("conversation = %+v", c)
+	}
+	if last := c.Messages[3]; last.Seq != 4 || last.Role != RoleAssistant || last.Metadata["assistant"] != "physics" {
+		t.Errorf("last message = %+v", last)
+	}
+
+	if c, err := repo.GetConversation(ctx, "mallory", "c1"); err != nil || len(c.Messages) != 2 || c.Messages[0].Content != "Mine now" {
+		t.Errorf("another user's conversation with the same id = %+v, %v", c, err)
+	}
+	if _, err := repo.GetConversation(ctx, "mallory", "c2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown conversation: %v", err)
+	}
+	if err := repo.Rename(ctx, "mallory", "c2", "Stolen"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("renamed an unknown conversation: %v", err)
+	}
+	if err := repo.Delete(ctx, "mallory", "c1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if c, err := repo.GetConversation(ctx, "alice", "c1"); err != nil || len(c.Messages) != 4 || c.Title != "What is entropy?" {
+		t.Errorf("another user's delete changed the conversation: %+v, %v", c, err)
+	}
+
+	if err := repo.Delete(ctx, "alice", "c1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.GetConversation(ctx, "alice", "c1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted conversation: %v", err)
+	}
+}
+
+func TestSQLRepositoryPaginatesByLastUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := openTestRepository(t)
+	for i := 0; i < 5; i++ {
+		repo.Append(ctx, "alice", fmt.Sprintf("c%d", i), exchange(fmt.Sprintf("question %d", i), "answer")...)
+	}
+	// Answering c0 again moves it to the top
+	repo.Append(ctx, "alice", "c0", exchange("follow-up", "answer")...)
+	repo.Append(ctx, "bob", "b0", exchange("not alice's", "answer")...)
+
+	var ids []string
+	opts := ListOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("listing did not end")
+		}
+		page, err := repo.ListConversations(ctx, "alice", opts)
+		if err != nil {
+			t.Fatalf("ListConversations: %v", err)
+		}
+		for _, c := range page.Conversations {
+			ids = append(ids, c.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if got := strings.Join(ids, ","); got != "c0,c4,c3,c2,c1" {
+		t.Errorf("listed %s, want c0,c4,c3,c2,c1", got)
+	}
+
+	if _, err := repo.ListConversations(ctx, "alice", ListOptions{Cursor: "bogus"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("bogus cursor error = %v", err)
+	}
+}
+
+func TestHandlerRenamesAndExports(t *testing.T) {
+	ctx := context.Background()
+	repo := openTestRepository(t)
+	repo.Append(ctx, "alice", "c1", exchange("What is entropy?", "A measure of **disorder**.")...)
+	handler := &Handler{Repo: repo}
+
+	serve := func(method, target, body string, user string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r = r.WithContext(auth.WithIdentity(r.Context(), &auth.Identity{UserID: user}))
+		w := httptest.NewRecorder()
+		if target == "/v1/conversations" || strings.HasPrefix(target, "/v1/conversations?") {
+			handler.ServeList(w, r)
+		} else {
+			handler.ServeConversation(w, r)
+		}
+		return w
+	}
+
+	if w := serve(http.MethodPatch, "/v1/conversations/c1", `{"title":"Thermodynamics"}`, "alice"); w.Code != http.StatusOK {
+		t.Fatalf("rename = %d %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodGet, "/v1/conversations/c1", "", "mallory"); w.Code != http.StatusNotFound {
+		t.Errorf("another user got %d", w.Code)
+	}
+
+	w := serve(http.MethodGet, "/v1/conversations/c1/export", "", "alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export = %d %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="thermodynamics.md"` {
+		t.Errorf("Content-Disposition = %s", got)
+	}
+	markdown := w.Body.String()
+	for _, want := range []string{"# Thermodynamics\n", "## You · ", "What is entropy?", "## Assistant (physics) · ", "A measure of **disorder**."} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown export lacks %q:\n%s", want, markdown)
+		}
+	}
+
+	w = serve(http.MethodGet, "/v1/conversations/c1/export?format=json", "", "alice")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"role": "assistant"`) {
+		t.Errorf("json export = %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(http.MethodDelete, "/v1/conversations/c1", "", "alice"); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/v1/conversations", "", "alice"); !strings.Contains(w.Body.String(), `"conversations":[]`) {
+		t.Errorf("list after delete = %s", w.Body)
+	}
+}
@@ -0,0 +1,192 @@
+// pkg/history/http.go
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+)
+
+// maxRenameRequest bounds the body of a rename.
+const maxRenameRequest = 4 << 10
+
+// Handler serves the conversation API. Every request is scoped to the
+// authenticated caller; with authentication disabled all callers share
+// the conversations of the empty user.
+type Handler struct {
+	Repo Repository
+}
+
+type RenameRequest struct {
+	Title string `json:"title"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeList answers GET /v1/conversations with a page of the caller's
+// conversations, most recently updated first. The limit and cursor query
+// parameters page through them.
+func (h *Handler) ServeList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use GET"})
+		return
+	}
+
+	opts := ListOptions{Cursor: r.URL.Query().Get("cursor")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive number"})
+			return
+		}
+		opts.Limit = n
+	}
+
+	page, err := h.Repo.ListConversations(r.Context(), owner(r), opts)
+	switch {
+	case errors.Is(err, ErrInvalidCursor):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case err != nil:
+		log.Printf("Failed to list conversations: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list conversations"})
+	default:
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// ServeConversation answers requests under /v1/conversations/{id}: GET
+// returns the conversation with its messages, PATCH renames it with a
+// RenameRequest and DELETE removes it. GET {id}/export downloads it as
+// Markdown, or as JSON with format=json.
+func (h *Handler) ServeConversation(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/conversations/"), "/")
+	if id == "" || (action != "" && action != "export") {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+
+	switch {
+	case action == "export" && r.Method == http.MethodGet:
+		h.export(w, r, id)
+	case action == "export":
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use GET"})
+	case r.Method == http.MethodGet:
+		conversation, err := h.Repo.GetConversation(r.Context(), owner(r), id)
+		if err != nil {
+			writeError(w, id, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, conversation)
+	case r.Method == http.MethodPatch:
+		h.rename(w, r, id)
+	case r.Method == http.MethodDelete:
+		if err := h.Repo.Delete(r.Context(), owner(r), id); err != nil {
+			writeError(w, id, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use GET, PATCH or DELETE"})
+	}
+}
+
+func (h *Handler) rename(w http.ResponseWriter, r *http.Request, id string) {
+	var req RenameRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRenameRequest))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "title is required"})
+		return
+	}
+	if err := h.Repo.Rename(r.Context(), owner(r), id, req.Title); err != nil {
+		writeError(w, id, err)
+		return
+	}
+	conversation, err := h.Repo.GetConversation(r.Context(), owner(r), id)
+	if err != nil {
+		writeError(w, id, err)
+		return
+	}
+	conversation.Messages = nil
+	writeJSON(w, http.StatusOK, conversation)
+}
+
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, id string) {
+	format := r.URL.Query().Get("format")
+	export, contentType, extension := ExportMarkdown, "text/markdown; charset=utf-8", "md"
+	switch format {
+	case "", "markdown", "md":
+	case "json":
+		export, contentType, extension = ExportJSON, "application/json", "json"
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "format must be markdown or json"})
+		return
+	}
+
+	conversation, err := h.Repo.GetConversation(r.Context(), owner(r), id)
+	if err != nil {
+		writeError(w, id, err)
+		return
+	}
+	var body bytes.Buffer
+	if err := export(&body, conversation); err != nil {
+		log.Printf("Failed to export conversation %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to export conversation"})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportName(conversation)+"."+extension))
+	w.Write(body.Bytes())
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// exportName turns a conversation title into a file name.
+func exportName(c *Conversation) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(strings.ToLower(c.Title), "-"), "-")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "-")
+	}
+	if name == "" {
+		return "conversation"
+	}
+	return name
+}
+
+func owner(r *http.Request) string {
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		return identity.UserID
+	}
+	return ""
+}
+
+func writeError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("Conversation %s: %v", id, err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "conversation history is unavailable"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write conversation response: %v", err)
+	}
+}
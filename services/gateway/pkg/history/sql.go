@@ -0,0 +1,341 @@
+// pkg/history/sql.go
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// schema creates the tables on first use. Times are stored as Unix
+// microseconds so both databases order and compare them the same way.
+// Conversation ids are chosen by clients, so they are keyed by owner too.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS conversations (
+		owner TEXT NOT NULL,
+		id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		message_count INTEGER NOT NULL DEFAULT 0,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		PRIMARY KEY (owner, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS conversations_owner_updated
+		ON conversations (owner, updated_at, id)`,
+	`CREATE TABLE IF NOT EXISTS conversation_messages (
+		owner TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL,
+		message_id TEXT NOT NULL DEFAULT '',
+		metadata TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (owner, conversation_id, seq)
+	)`,
+}
+
+// SQLRepository stores conversations in SQLite, for local development, or
+// Postgres. SQLite needs a cgo build, as the gateway image is.
+type SQLRepository struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// Open connects to the history database and creates its tables. backend is
+// "sqlite", with a file path as dsn, or "postgres", with a
+// postgres:// URL.
+func Open(ctx context.Context, backend, dsn string) (*SQLRepository, error) {
+	var driver string
+	switch backend {
+	case "sqlite":
+		driver = "sqlite3"
+	case "postgres":
+		driver = "pgx"
+	default:
+		return nil, fmt.Errorf("unknown history backend %q", backend)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history database DSN: %w", err)
+	}
+	if backend == "sqlite" {
+		// SQLite allows one writer; a single connection queues them rather
+		// than failing with "database is locked"
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(10)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+	}
+
+	r := &SQLRepository{db: db, postgres: backend == "postgres"}
+	for _, statement := range schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create history tables: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (r *SQLRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SQLRepository) Close() error {
+	return r.db.Close()
+}
+
+// rebind turns the ? placeholders of query into Postgres' $1, $2...
+func (r *SQLRepository) rebind(query string) string {
+	if !r.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (r *SQLRepository) Append(ctx context.Context, owner, conversationID string, messages ...Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	title := ""
+	for _, m := range messages {
+		if m.Role == RoleUser {
+			title = Title(m.Content)
+			break
+		}
+	}
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO conversations (id, owner, title, message_count, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?) ON CONFLICT (owner, id) DO NOTHING`),
+		conversationID, owner, title, now.UnixMicro(), now.UnixMicro())
+	if err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+	// The update locks the conversation, so concurrent appends number
+	// their messages one after the other
+	var count int
+	err = tx.QueryRowContext(ctx, r.rebind(`UPDATE conversations SET message_count = message_count + ?, updated_at = ?
+		WHERE id = ? AND owner = ? RETURNING message_count`),
+		len(messages), now.UnixMicro(), conversationID, owner).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	seq := count - len(messages)
+	for _, m := range messages {
+		seq++
+		metadata := ""
+		if len(m.Metadata) > 0 {
+			data, err := json.Marshal(m.Metadata)
+			if err != nil {
+				return fmt.Errorf("failed to encode message metadata: %w", err)
+			}
+			metadata = string(data)
+		}
+		createdAt := m.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err = tx.ExecContext(ctx, r.rebind(`INSERT INTO conversation_messages
+			(owner, conversation_id, seq, role, content, message_id, metadata, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			owner, conversationID, seq, m.Role, m.Content, m.MessageID, metadata, createdAt.UnixMicro())
+		if err != nil {
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLRepository) ListConversations(ctx context.Context, owner string, opts ListOptions) (*Page, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	query := `SELECT id, title, message_count, created_at, updated_at FROM conversations WHERE owner = ?`
+	args := []any{owner}
+	if opts.Cursor != "" {
+		updatedAt, id, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND (updated_at < ? OR (updated_at = ? AND id < ?))`
+		args = append(args, updatedAt, updatedAt, id)
+	}
+	// One extra row tells whether there is another page
+	query += ` ORDER BY updated_at DESC, id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := r.db.QueryContext(ctx, r.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	page := &Page{Conversations: []Conversation{}}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Conversations = append(page.Conversations, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	if len(page.Conversations) > limit {
+		page.Conversations = page.Conversations[:limit]
+		last := page.Conversations[limit-1]
+		page.NextCursor = encodeCursor(last.UpdatedAt.UnixMicro(), last.ID)
+	}
+	return page, nil
+}
+
+func (r *SQLRepository) GetConversation(ctx context.Context, owner, conversationID string) (*Conversation, error) {
+	row := r.db.QueryRowContext(ctx, r.rebind(`SELECT id, title, message_count, created_at, updated_at
+		FROM conversations WHERE id = ? AND owner = ?`), conversationID, owner)
+	c, err := scanConversation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT seq, role, content, message_id, metadata, created_at
+		FROM conversation_messages WHERE owner = ? AND conversation_id = ? ORDER BY seq`), owner, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+	c.Messages = []Message{}
+	for rows.Next() {
+		var m Message
+		var metadata string
+		var createdAt int64
+		if err := rows.Scan(&m.Seq, &m.Role, &m.Content, &m.MessageID, &metadata, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		if metadata != "" {
+			if err := json.Unmarshal([]byte(metadata), &m.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to decode message metadata: %w", err)
+			}
+		}
+		m.CreatedAt = time.UnixMicro(createdAt).UTC()
+		c.Messages = append(c.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	return c, nil
+}
+
+func (r *SQLRepository) Rename(ctx context.Context, owner, conversationID, title string) error {
+	result, err := r.db.ExecContext(ctx, r.rebind(`UPDATE conversations SET title = ? WHERE id = ? AND owner = ?`),
+		truncate(strings.TrimSpace(title), maxTitleLength), conversationID, owner)
+	if err != nil {
+		return fmt.Errorf("failed to rename conversation: %w", err)
+	}
+	return requireRow(result)
+}
+
+func (r *SQLRepository) Delete(ctx context.Context, owner, conversationID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, r.rebind(`DELETE FROM conversations WHERE id = ? AND owner = ?`), conversationID, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, r.rebind(`DELETE FROM conversation_messages WHERE owner = ? AND conversation_id = ?`), owner, conversationID); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return tx.Commit()
+}
+
+// requireRow reports ErrNotFound when an update matched no conversation.
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanConversation(row interface{ Scan(...any) error }) (*Conversation, error) {
+	var c Conversation
+	var createdAt, updatedAt int64
+	if err := row.Scan(&c.ID, &c.Title, &c.MessageCount, &createdAt, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+	c.CreatedAt = time.UnixMicro(createdAt).UTC()
+	c.UpdatedAt = time.UnixMicro(updatedAt).UTC()
+	return &c, nil
+}
+
+// Cursors are opaque to clients: the position of the last conversation of
+// a page in the listing order.
+func encodeCursor(updatedAt int64, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(updatedAt, 10) + ":" + id))
+}
+
+func decodeCursor(cursor string) (int64, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	updatedAt, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return 0, "", ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(updatedAt, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return micros, id, nil
+}
@@ -0,0 +1,134 @@
+// pkg/lecture/client.go
+package lecture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// DefaultSearchLimit is the number of frames returned when a query does not
+// set a limit.
+const DefaultSearchLimit = 5
+
+// maxTimestamp is the largest offset the frames table can hold, used as the
+// end of open time ranges.
+const maxTimestamp = 9999999.999
+
+// Client searches frames through the processing API's vector search. The
+// query text is embedded with Embedder, which must produce vectors in the
+// same space the frames were indexed in.
+type Client struct {
+	// BaseURL is the root of the processing API, e.g.
+	// "http://processing:8080/api".
+	BaseURL  string
+	Embedder llm.Embedder
+	// Threshold is the minimum similarity of a match. Zero uses the
+	// processing API's default.
+	Threshold  float64
+	HTTPClient *http.Client
+}
+
+type timeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type searchFilter struct {
+	VideoID   string     `json:"video_id,omitempty"`
+	TimeRange *timeRange `json:"time_range,omitempty"`
+}
+
+type searchRequest struct {
+	Vector    []float32     `json:"vector"`
+	Limit     int           `json:"limit"`
+	Threshold float64       `json:"threshold,omitempty"`
+	Filter    *searchFilter `json:"filter,omitempty"`
+}
+
+type searchResult struct {
+	FrameID    string         `json:"frame_id"`
+	Similarity float64        `json:"similarity"`
+	Metadata   map[string]any `json:"metadata"`
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) SearchFrames(ctx context.Context, query Query) ([]Frame, error) {
+	vector, err := c.Embedder.Embed(ctx, query.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	body := searchRequest{Vector: vector, Limit: query.Limit, Threshold: c.Threshold}
+	if body.Limit <= 0 {
+		body.Limit = DefaultSearchLimit
+	}
+	if query.VideoID != "" || query.Start > 0 || query.End > 0 {
+		body.Filter = &searchFilter{VideoID: query.VideoID}
+		if query.Start > 0 || query.End > 0 {
+			end := query.End
+			if end <= 0 {
+				end = maxTimestamp
+			}
+			body.Filter.TimeRange = &timeRange{Start: query.Start, End: end}
+		}
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	endpoint := strings.TrimRight(c.BaseURL, "/") + "/vectors/search"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to processing service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("processing service returned status %d: %s", resp.StatusCode, bytes.TrimSpace(text))
+	}
+
+	var results []searchResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+
+	frames := make([]Frame, 0, len(results))
+	for _, result := range results {
+		frames = append(frames, frameFromMetadata(result.FrameID, result.Similarity, result.Metadata))
+	}
+	return frames, nil
+}
+
+// frameFromMetadata reads the fields the processing pipeline stores in
+// frame metadata, tolerating any that are missing.
+func frameFromMetadata(id string, similarity float64, metadata map[string]any) Frame {
+	frame := Frame{ID: id, Similarity: similarity}
+	frame.VideoID, _ = metadata["video_id"].(string)
+	frame.Scene, _ = metadata["scene"].(string)
+	frame.Text, _ = metadata["ocr_text"].(string)
+	if timestamp, ok := metadata["timestamp"].(float64); ok {
+		frame.Timestamp = &timestamp
+	}
+	return frame
+}
@@ -0,0 +1,57 @@
+// pkg/lecture/lecture.go
+package lecture
+
+import (
+	"context"
+	"errors"
+)
+
+// Frame is a lecture video frame matched by a search.
+type Frame struct {
+	ID      string `json:"frame_id"`
+	VideoID string `json:"video_id,omitempty"`
+	// Timestamp is the offset of the frame into its video in seconds, nil
+	// if the store did not report it.
+	Timestamp  *float64 `json:"timestamp,omitempty"`
+	Similarity float64  `json:"similarity"`
+	Scene      string   `json:"scene,omitempty"`
+	// Text is the text read off the frame, such as slide contents.
+	Text string `json:"text,omitempty"`
+}
+
+// Context is the material retrieved from one video to answer a question,
+// in video order.
+type Context struct {
+	VideoID string
+	Title   string
+	Frames  []Frame
+}
+
+// Errors returned by a Retriever for videos it cannot answer about.
+var (
+	ErrVideoNotFound = errors.New("video not found")
+	ErrVideoNotReady = errors.New("video has not finished processing")
+)
+
+// Retriever gathers the parts of a processed video relevant to a question:
+// frames with the text shown on them.
+type Retriever interface {
+	Retrieve(ctx context.Context, query Query) (*Context, error)
+}
+
+// Query describes the video material to look for.
+type Query struct {
+	Text string
+	// VideoID restricts the search to one video.
+	VideoID string
+	// Start and End restrict the search to frames between these offsets in
+	// seconds. A zero End means the end of the video.
+	Start, End float64
+	Limit      int
+}
+
+// Searcher finds the frames of processed lecture videos that best match a
+// description, most similar first.
+type Searcher interface {
+	SearchFrames(ctx context.Context, query Query) ([]Frame, error)
+}
@@ -0,0 +1,47 @@
+package lecture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPickPrefersMatchingTexts(t *testing.T) {
+	texts := []string{
+		"Welcome to thermodynamics",
+		"The first law: energy is conserved",
+		"Entropy of an ideal gas",
+		"Homework is due Friday",
+		"Entropy and the second law",
+	}
+	if got := pick(texts, "What is the entropy of an ideal gas?", 2); !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Errorf("pick = %v, want [2 4]", got)
+	}
+	if got := pick(texts, "summarize this", 2); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("pick without matches = %v, want evenly spaced [0 2]", got)
+	}
+}
+
+func TestDistinctFramesKeepsFirstOfEachSlide(t *testing.T) {
+	frames := []Frame{
+		{ID: "1", Text: "Slide A"},
+		{ID: "2", Text: " Slide  A"},
+		{ID: "3"},
+		{ID: "4", Text: "Slide B"},
+		{ID: "5", Scene: "whiteboard"},
+	}
+	var ids []string
+	for _, frame := range distinctFrames(frames) {
+		ids = append(ids, frame.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "4", "5"}) {
+		t.Errorf("distinct frames = %v", ids)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	for seconds, want := range map[float64]string{0: "0:00", 65.9: "1:05", 3600: "1:00:00", 3725: "1:02:05"} {
+		if got := FormatTimestamp(seconds); got != want {
+			t.Errorf("FormatTimestamp(%v) = %s, want %s", seconds, got, want)
+		}
+	}
+}
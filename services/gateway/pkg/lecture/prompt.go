@@ -0,0 +1,100 @@
+// pkg/lecture/prompt.go
+package lecture
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Citation is a timestamp the answer cited, resolved to the moment of the
+// video it refers to.
+type Citation struct {
+	Label   string  `json:"label"`
+	Seconds float64 `json:"seconds"`
+	VideoID string  `json:"video_id"`
+	// FrameID is the frame shown at that moment, if the citation points at
+	// a frame excerpt.
+	FrameID string `json:"frame_id,omitempty"`
+}
+
+var citationPattern = regexp.MustCompile(`\[(\d{1,2}(?::\d{2}){1,2})\]`)
+
+// FormatTimestamp formats an offset in seconds as m:ss, or h:mm:ss from an
+// hour in, the form answers cite.
+func FormatTimestamp(seconds float64) string {
+	total := int(math.Max(seconds, 0))
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// Prompt renders the context as instructions for the system prompt: the
+// excerpts to answer from, each labelled with the timestamp to cite.
+func (c *Context) Prompt() string {
+	var b strings.Builder
+	title := c.Title
+	if title == "" {
+		title = c.VideoID
+	}
+	fmt.Fprintf(&b, "The student is asking about the lecture video %q. ", title)
+	b.WriteString("Answer from the excerpts below, which were extracted from the video. ")
+	b.WriteString("Cite the moment each point comes from by its timestamp in square brackets, exactly as given, e.g. [12:34]. ")
+	b.WriteString("If the excerpts do not cover the question, say so rather than guessing what the lecture said.\n")
+
+	if len(c.Frames) > 0 {
+		b.WriteString("\nOn screen:\n")
+		for _, frame := range c.Frames {
+			fmt.Fprintf(&b, "[%s]", FormatTimestamp(frameSeconds(frame)))
+			if frame.Scene != "" {
+				fmt.Fprintf(&b, " (%s)", frame.Scene)
+			}
+			if frame.Text != "" {
+				fmt.Fprintf(&b, " %s", strings.Join(strings.Fields(frame.Text), " "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(c.Frames) == 0 {
+		b.WriteString("\nNothing was extracted from this part of the video.\n")
+	}
+	return b.String()
+}
+
+// Citations returns the timestamps cited in answer that refer to the
+// context, in the order they first appear. Timestamps that match no excerpt
+// are left out, so a client can link every citation it is given.
+func (c *Context) Citations(answer string) []Citation {
+	var citations []Citation
+	seen := make(map[string]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		label := match[1]
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		if citation, ok := c.resolve(label); ok {
+			citations = append(citations, citation)
+		}
+	}
+	return citations
+}
+
+func (c *Context) resolve(label string) (Citation, bool) {
+	for _, frame := range c.Frames {
+		if FormatTimestamp(frameSeconds(frame)) == label {
+			return Citation{Label: label, Seconds: frameSeconds(frame), VideoID: c.VideoID, FrameID: frame.ID}, true
+		}
+	}
+	return Citation{}, false
+}
+
+func frameSeconds(frame Frame) float64 {
+	if frame.Timestamp == nil {
+		return 0
+	}
+	return *frame.Timestamp
+}
@@ -0,0 +1,113 @@
+// pkg/lecture/rank.go
+package lecture
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"can": true, "do": true, "does": true, "for": true, "from": true, "how": true, "in": true,
+	"is": true, "it": true, "me": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "with": true, "you": true, "explain": true, "lecture": true, "video": true,
+}
+
+// terms returns the distinct lower-case words of text worth matching on.
+func terms(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		if len(word) > 1 && !stopWords[word] {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+// pick chooses up to limit of texts for a question and returns their
+// indices in ascending order. Texts are scored by the question terms they
+// contain, rarer terms counting more. If nothing matches, as for "summarize
+// this part", texts are picked evenly across the range instead.
+func pick(texts []string, question string, limit int) []int {
+	if limit <= 0 || len(texts) == 0 {
+		return nil
+	}
+	if len(texts) <= limit {
+		indices := make([]int, len(texts))
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	wanted := terms(question)
+	contains := make([]map[string]bool, len(texts))
+	frequency := make(map[string]int)
+	for i, text := range texts {
+		contains[i] = terms(text)
+		for term := range wanted {
+			if contains[i][term] {
+				frequency[term]++
+			}
+		}
+	}
+
+	type scored struct {
+		index int
+		score float64
+	}
+	var matches []scored
+	for i := range texts {
+		var score float64
+		for term := range wanted {
+			if contains[i][term] {
+				score += math.Log(1 + float64(len(texts))/float64(frequency[term]))
+			}
+		}
+		if score > 0 {
+			matches = append(matches, scored{i, score})
+		}
+	}
+
+	var indices []int
+	if len(matches) == 0 {
+		for i := 0; i < limit; i++ {
+			indices = append(indices, i*len(texts)/limit)
+		}
+		return indices
+	}
+	// Stable, so equal scores keep video order
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	for _, match := range matches[:min(limit, len(matches))] {
+		indices = append(indices, match.index)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// distinctFrames drops frames that show the same thing as the frame before
+// them, since a slide stays up for many frames. The first frame of each run
+// is kept, as that is when the slide appeared. Frames without text are
+// compared by scene, and frames with neither are dropped.
+func distinctFrames(frames []Frame) []Frame {
+	var distinct []Frame
+	previous := ""
+	for _, frame := range frames {
+		text := strings.Join(strings.Fields(frame.Text), " ")
+		if text == "" {
+			text = strings.TrimSpace(frame.Scene)
+		}
+		if text == "" || text == previous {
+			continue
+		}
+		previous = text
+		distinct = append(distinct, frame)
+	}
+	return distinct
+}
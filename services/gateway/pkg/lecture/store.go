@@ -0,0 +1,131 @@
+// pkg/lecture/store.go
+package lecture
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DefaultMaxFrames is how many frames of a video go into a prompt.
+const DefaultMaxFrames = 8
+
+// maxScanned bounds the rows read per video, about an hour of frames at the
+// processing pipeline's sampling rate.
+const maxScanned = 5000
+
+// Store retrieves lecture context from the processing pipeline's SingleStore
+// database: the videos and frames tables it fills. Frames are chosen by the
+// words they share with the question.
+type Store struct {
+	DB        *sql.DB
+	MaxFrames int
+}
+
+// OpenStore connects to the processing database. dsn is in the MySQL
+// driver's format, e.g. "user:pass@tcp(singlestore:3306)/video_analysis".
+func OpenStore(dsn string) (*Store, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid processing database DSN: %w", err)
+	}
+	db.SetMaxOpenConns(10)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	return &Store{DB: db, MaxFrames: DefaultMaxFrames}, nil
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+func (s *Store) Retrieve(ctx context.Context, query Query) (*Context, error) {
+	var title, status string
+	err := s.DB.QueryRowContext(ctx, `SELECT filename, status FROM videos WHERE id = ?`, query.VideoID).Scan(&title, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVideoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load video: %w", err)
+	}
+	if status != "complete" {
+		return nil, ErrVideoNotReady
+	}
+
+	end := query.End
+	if end <= 0 {
+		end = maxTimestamp
+	}
+	frames, err := s.frames(ctx, query.VideoID, query.Start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	maxFrames := s.MaxFrames
+	if query.Limit > 0 {
+		maxFrames = query.Limit
+	}
+	result := &Context{VideoID: query.VideoID, Title: title}
+	frames = distinctFrames(frames)
+	texts := make([]string, len(frames))
+	for i, frame := range frames {
+		texts[i] = frame.Text + " " + frame.Scene
+	}
+	for _, i := range pick(texts, query.Text, maxFrames) {
+		result.Frames = append(result.Frames, frames[i])
+	}
+	return result, nil
+}
+
+func (s *Store) frames(ctx context.Context, videoID string, start, end float64) ([]Frame, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, timestamp, metadata
+		FROM frames
+		WHERE video_id = ? AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp
+		LIMIT ?`, videoID, start, end, maxScanned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load frames: %w", err)
+	}
+	defer rows.Close()
+
+	var frames []Frame
+	for rows.Next() {
+		var id string
+		var timestamp float64
+		var metadata []byte
+		if err := rows.Scan(&id, &timestamp, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to scan frame: %w", err)
+		}
+		var fields map[string]any
+		if len(metadata) > 0 {
+			// Frames with unreadable metadata still mark a moment in the video
+			_ = json.Unmarshal(metadata, &fields)
+		}
+		frame := frameFromMetadata(id, 0, fields)
+		frame.VideoID, frame.Timestamp = videoID, &timestamp
+		if frame.Text == "" {
+			frame.Text = enhancedOCRText(fields)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, rows.Err()
+}
+
+// enhancedOCRText reads the OCR content of frames stored in the pipeline's
+// enhanced metadata layout, analysis.text.content.
+func enhancedOCRText(metadata map[string]any) string {
+	analysis, _ := metadata["analysis"].(map[string]any)
+	text, _ := analysis["text"].(map[string]any)
+	content, _ := text["content"].(string)
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,291 @@
+// pkg/llm/gemini.go
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	DefaultGeminiModel   = "gemini-2.0-flash"
+
+	DefaultGeminiEmbeddingModel = "text-embedding-004"
+)
+
+type geminiRequest struct {
+	SystemInstruction *Content         `json:"systemInstruction,omitempty"`
+	Contents          []Content        `json:"contents"`
+	GenerationConfig  GenerationConfig `json:"generationConfig"`
+	Tools             []geminiTool     `json:"tools,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiCandidate struct {
+	Content       Content        `json:"content"`
+	FinishReason  string         `json:"finishReason,omitempty"`
+	SafetyRatings []SafetyRating `json:"safetyRatings,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string         `json:"blockReason"`
+		SafetyRatings []SafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback,omitempty"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+}
+
+type geminiModelList struct {
+	Models []struct {
+		Name                       string   `json:"name"`
+		DisplayName                string   `json:"displayName"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	} `json:"models"`
+}
+
+type GeminiProvider struct {
+	APIKey         string
+	BaseURL        string
+	Model          string
+	EmbeddingModel string
+	HTTPClient     *http.Client
+}
+
+func NewGeminiProvider(apiKey string) *GeminiProvider {
+	return &GeminiProvider{
+		APIKey:         apiKey,
+		BaseURL:        DefaultGeminiBaseURL,
+		Model:          DefaultGeminiModel,
+		EmbeddingModel: DefaultGeminiEmbeddingModel,
+		HTTPClient:     http.DefaultClient,
+	}
+}
+
+func (g *GeminiProvider) Name() string { return "gemini" }
+
+func (g *GeminiProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, ModelListing: true, Vision: true, Tools: true}
+}
+
+func (g *GeminiProvider) client() *http.Client {
+	if g.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return g.HTTPClient
+}
+
+// authorize sends the API key in a header, since URLs end up in error
+// messages and logs.
+func (g *GeminiProvider) authorize(req *http.Request) {
+	req.Header.Set("x-goog-api-key", g.APIKey)
+}
+
+func (g *GeminiProvider) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	g.authorize(req)
+
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("gemini", resp)
+	}
+
+	var list geminiModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+
+	models := make([]Model, 0, len(list.Models))
+	for _, m := range list.Models {
+		if !containsString(m.SupportedGenerationMethods, "streamGenerateContent") {
+			continue
+		}
+		models = append(models, Model{
+			ID:          strings.TrimPrefix(m.Name, "models/"),
+			Provider:    g.Name(),
+			DisplayName: m.DisplayName,
+		})
+	}
+	return models, nil
+}
+
+// StreamGenerate calls streamGenerateContent and forwards every text part as
+// soon as its event is decoded. Function call parts are collected into the
+// result. It returns ErrStreamTruncated if the stream
+// closes before Gemini reports a finish reason.
+func (g *GeminiProvider) StreamGenerate(ctx context.Context, req Request, onChunk func(Chunk) error) (*Result, error) {
+	model := req.Model
+	if model == "" {
+		model = g.Model
+	}
+
+	body := geminiRequest{
+		Contents:         req.Contents,
+		GenerationConfig: req.Config,
+	}
+	if req.SystemInstruction != "" {
+		body.SystemInstruction = &Content{Parts: []Part{{Text: req.SystemInstruction}}}
+	}
+	if len(req.Tools) > 0 {
+		body.Tools = []geminiTool{{FunctionDeclarations: req.Tools}}
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", g.BaseURL, url.PathEscape(model))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	g.authorize(httpReq)
+
+	resp, err := g.client().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("gemini", resp)
+	}
+
+	result := &Result{}
+	err = readSSE(resp.Body, func(data []byte) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			// A partial event at EOF means the connection dropped mid-chunk
+			return ErrStreamTruncated
+		}
+		// Usage is cumulative, so the last event's counts are the totals
+		if usage := chunk.UsageMetadata; usage != nil {
+			result.Usage = &Usage{
+				PromptTokens: usage.PromptTokenCount,
+				OutputTokens: usage.CandidatesTokenCount,
+				TotalTokens:  usage.TotalTokenCount,
+			}
+		}
+		if feedback := chunk.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+			result.BlockReason = feedback.BlockReason
+			result.FinishReason = "PROMPT_BLOCKED"
+			result.SafetyRatings = feedback.SafetyRatings
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				result.FunctionCalls = append(result.FunctionCalls, *part.FunctionCall)
+				continue
+			}
+			if part.Text == "" {
+				continue
+			}
+			if err := onChunk(Chunk{Text: part.Text}); err != nil {
+				return err
+			}
+		}
+		if candidate.FinishReason != "" {
+			result.FinishReason = candidate.FinishReason
+		}
+		if len(candidate.SafetyRatings) > 0 {
+			result.SafetyRatings = candidate.SafetyRatings
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.FinishReason == "" {
+		return result, ErrStreamTruncated
+	}
+
+	return result, nil
+}
+
+type geminiEmbedResponse struct {
+	Embedding struct {
+		Values []float32 `json:"values"`
+	} `json:"embedding"`
+}
+
+// Embed calls embedContent with the embedding model.
+func (g *GeminiProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	model := g.EmbeddingModel
+	if model == "" {
+		model = DefaultGeminiEmbeddingModel
+	}
+
+	jsonData, err := json.Marshal(map[string]any{
+		"content": Content{Parts: []Part{{Text: text}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:embedContent", g.BaseURL, url.PathEscape(model))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	g.authorize(req)
+
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("gemini", resp)
+	}
+
+	var embedding geminiEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedding); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding: %w", err)
+	}
+	return embedding.Embedding.Values, nil
+}
+
+func statusError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &StatusError{Provider: provider, StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const chunkDelay = 50 * time.Millisecond
+
+type timedChunk struct {
+	Text string
+	At   time.Time
+}
+
+func sseChunk(text, finishReason string) string {
+	candidate := map[string]any{
+		"content": map[string]any{
+			"role":  "model",
+			"parts": []map[string]string{{"text": text}},
+		},
+	}
+	if finishReason != "" {
+		candidate["finishReason"] = finishReason
+	}
+	data, _ := json.Marshal(map[string]any{"candidates": []any{candidate}})
+	return fmt.Sprintf("data: %s\r\n\r\n", data)
+}
+
+// newFakeGemini serves each of events with a delay between them, flushing
+// after every write so the client sees them as separate network reads.
+func newFakeGemini(t *testing.T, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("expected alt=sse, got %q", r.URL.RawQuery)
+		}
+		if r.URL.Query().Has("key") || r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("expected the key in x-goog-api-key only, got %q", r.URL.RawQuery)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, event := range events {
+			fmt.Fprint(w, event)
+			flusher.Flush()
+			time.Sleep(chunkDelay)
+		}
+	}))
+}
+
+func newTestGemini(server *httptest.Server) *GeminiProvider {
+	provider := NewGeminiProvider("test-key")
+	provider.BaseURL = server.URL
+	provider.HTTPClient = server.Client()
+	return provider
+}
+
+func collect(t *testing.T, provider Provider) ([]timedChunk, *Result, error) {
+	t.Helper()
+	var chunks []timedChunk
+	result, err := provider.StreamGenerate(context.Background(), Request{Contents: UserText("F=ma?")}, func(chunk Chunk) error {
+		chunks = append(chunks, timedChunk{Text: chunk.Text, At: time.Now()})
+		return nil
+	})
+	return chunks, result, err
+}
+
+func TestGeminiStreamForwardsChunksInOrder(t *testing.T) {
+	server := newFakeGemini(t, []string{
+		sseChunk("Newton's ", ""),
+		sseChunk("second ", ""),
+		sseChunk("law", "STOP"),
+	})
+	defer server.Close()
+
+	start := time.Now()
+	chunks, result, err := collect(t, newTestGemini(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+
+	var texts []string
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	if got, want := strings.Join(texts, "|"), "Newton's |second |law"; got != want {
+		t.Fatalf("chunks = %q, want %q", got, want)
+	}
+	if result.FinishReason != "STOP" {
+		t.Errorf("FinishReason = %q, want STOP", result.FinishReason)
+	}
+
+	// The first chunk must be forwarded before the upstream sends the next
+	// one, and later chunks must follow upstream pacing instead of arriving
+	// together at the end.
+	if first := chunks[0].At.Sub(start); first >= chunkDelay {
+		t.Errorf("first chunk after %v, expected before the next chunk was sent", first)
+	}
+	if gap := chunks[2].At.Sub(chunks[0].At); gap < 2*chunkDelay {
+		t.Errorf("chunks arrived %v apart, expected at least %v", gap, 2*chunkDelay)
+	}
+}
+
+func TestGeminiStreamReassemblesSplitEvents(t *testing.T) {
+	event := sseChunk("reassembled", "STOP")
+	half := len(event) / 2
+	server := newFakeGemini(t, []string{event[:half], event[half:]})
+	defer server.Close()
+
+	chunks, result, err := collect(t, newTestGemini(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+	if result.FinishReason != "STOP" {
+		t.Errorf("FinishReason = %q, want STOP", result.FinishReason)
+	}
+	if len(chunks) != 1 || chunks[0].Text != "reassembled" {
+		t.Errorf("chunks = %+v, want [reassembled]", chunks)
+	}
+}
+
+func TestGeminiStreamEndingMidEventIsTruncated(t *testing.T) {
+	partial := sseChunk("cut off", "")
+	server := newFakeGemini(t, []string{
+		sseChunk("This answer ", ""),
+		partial[:len(partial)/2],
+	})
+	defer server.Close()
+
+	chunks, _, err := collect(t, newTestGemini(server))
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("err = %v, want ErrStreamTruncated", err)
+	}
+	if len(chunks) != 1 || chunks[0].Text != "This answer " {
+		t.Errorf("expected the chunk received before the drop to be forwarded, got %+v", chunks)
+	}
+}
+
+func TestGeminiStreamWithoutFinishReasonIsTruncated(t *testing.T) {
+	server := newFakeGemini(t, []string{sseChunk("no finish", "")})
+	defer server.Close()
+
+	_, _, err := collect(t, newTestGemini(server))
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("err = %v, want ErrStreamTruncated", err)
+	}
+}
+
+func TestGeminiStreamReportsUsageAndSafetyRatings(t *testing.T) {
+	final := `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"done"}]},"finishReason":"STOP",` +
+		`"safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"}]}],` +
+		`"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":3,"totalTokenCount":15}}` + "\r\n\r\n"
+	server := newFakeGemini(t, []string{sseChunk("almost ", ""), final})
+	defer server.Close()
+
+	_, result, err := collect(t, newTestGemini(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+	if result.Usage == nil || *result.Usage != (Usage{PromptTokens: 12, OutputTokens: 3, TotalTokens: 15}) {
+		t.Errorf("Usage = %+v", result.Usage)
+	}
+	if len(result.SafetyRatings) != 1 || result.SafetyRatings[0].Probability != "NEGLIGIBLE" {
+		t.Errorf("SafetyRatings = %+v", result.SafetyRatings)
+	}
+}
+
+func TestGeminiStreamDeclaresToolsAndCollectsCalls(t *testing.T) {
+	call := `data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"calculator","args":{"expression":"2*3"}}}]},"finishReason":"STOP"}]}` + "\r\n\r\n"
+	var body geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, call)
+	}))
+	defer server.Close()
+
+	req := Request{
+		Contents: UserText("What is 2*3?"),
+		Tools:    []FunctionDeclaration{{Name: "calculator", Description: "Evaluates arithmetic"}},
+	}
+	result, err := newTestGemini(server).StreamGenerate(context.Background(), req, func(Chunk) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+	if len(body.Tools) != 1 || body.Tools[0].FunctionDeclarations[0].Name != "calculator" {
+		t.Errorf("declared tools = %+v", body.Tools)
+	}
+	if len(result.FunctionCalls) != 1 || result.FunctionCalls[0].Name != "calculator" ||
+		string(result.FunctionCalls[0].Args) != `{"expression":"2*3"}` {
+		t.Errorf("FunctionCalls = %+v", result.FunctionCalls)
+	}
+}
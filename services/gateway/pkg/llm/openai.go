@@ -0,0 +1,279 @@
+// pkg/llm/openai.go
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any server implementing the OpenAI chat completions
+// API, such as vLLM, Ollama or llama.cpp, as well as OpenAI itself.
+type OpenAIProvider struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	// EmbeddingModel is used by Embed. Servers without an embeddings
+	// endpoint leave it empty.
+	EmbeddingModel string
+	HTTPClient     *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Stream      bool            `json:"stream"`
+	Temperature float64         `json:"temperature"`
+	TopP        float64         `json:"top_p,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	// StreamOptions asks for a final chunk carrying token usage.
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+}
+
+type openAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (o *OpenAIProvider) Name() string { return "openai" }
+
+func (o *OpenAIProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, ModelListing: true}
+}
+
+func (o *OpenAIProvider) client() *http.Client {
+	if o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
+
+func (o *OpenAIProvider) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.BaseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	return req, nil
+}
+
+func (o *OpenAIProvider) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := o.newRequest(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", o.BaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("openai", resp)
+	}
+
+	var list openAIModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+
+	models := make([]Model, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, Model{ID: m.ID, Provider: o.Name()})
+	}
+	return models, nil
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed calls /embeddings with the embedding model.
+func (o *OpenAIProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	if o.EmbeddingModel == "" {
+		return nil, fmt.Errorf("%w: no embedding model configured", ErrUnsupported)
+	}
+
+	jsonData, err := json.Marshal(map[string]any{"model": o.EmbeddingModel, "input": text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := o.newRequest(ctx, http.MethodPost, "/embeddings", jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", o.BaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("openai", resp)
+	}
+
+	var embedding openAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedding); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding: %w", err)
+	}
+	if len(embedding.Data) == 0 {
+		return nil, fmt.Errorf("embedding response has no data")
+	}
+	return embedding.Data[0].Embedding, nil
+}
+
+func (o *OpenAIProvider) StreamGenerate(ctx context.Context, req Request, onChunk func(Chunk) error) (*Result, error) {
+	if len(req.Tools) > 0 {
+		return nil, fmt.Errorf("function calling: %w", ErrUnsupported)
+	}
+	if HasInlineData(req.Contents) {
+		return nil, fmt.Errorf("attachments: %w", ErrUnsupported)
+	}
+	model := req.Model
+	if model == "" {
+		model = o.Model
+	}
+
+	messages := make([]openAIMessage, 0, len(req.Contents)+1)
+	if req.SystemInstruction != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.SystemInstruction})
+	}
+	for _, content := range req.Contents {
+		role := content.Role
+		if role == RoleModel {
+			role = "assistant"
+		}
+		messages = append(messages, openAIMessage{Role: role, Content: joinText(content.Parts)})
+	}
+
+	jsonData, err := json.Marshal(openAIRequest{
+		Model:       model,
+		Messages:    messages,
+		Stream:      true,
+		Temperature: req.Config.Temperature,
+		TopP:        req.Config.TopP,
+		MaxTokens:   req.Config.MaxOutputTokens,
+
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := o.newRequest(ctx, http.MethodPost, "/chat/completions", jsonData)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := o.client().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", o.BaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("openai", resp)
+	}
+
+	result := &Result{}
+	done := false
+	err = readSSE(resp.Body, func(data []byte) error {
+		if string(data) == "[DONE]" {
+			done = true
+			return nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return ErrStreamTruncated
+		}
+		if usage := chunk.Usage; usage != nil {
+			result.Usage = &Usage{
+				PromptTokens: usage.PromptTokens,
+				OutputTokens: usage.CompletionTokens,
+				TotalTokens:  usage.TotalTokens,
+			}
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				if err := onChunk(Chunk{Text: choice.Delta.Content}); err != nil {
+					return err
+				}
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				result.FinishReason = *choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if !done && result.FinishReason == "" {
+		return result, ErrStreamTruncated
+	}
+
+	return result, nil
+}
+
+func joinText(parts []Part) string {
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
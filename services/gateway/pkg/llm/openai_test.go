@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openAIChunk(text, finishReason string) string {
+	choice := map[string]any{"index": 0, "delta": map[string]string{"content": text}, "finish_reason": nil}
+	if finishReason != "" {
+		choice["finish_reason"] = finishReason
+	}
+	data, _ := json.Marshal(map[string]any{"object": "chat.completion.chunk", "choices": []any{choice}})
+	return fmt.Sprintf("data: %s\n\n", data)
+}
+
+const openAIDone = "data: [DONE]\n\n"
+
+// newFakeOpenAI serves each of events like newFakeGemini, and records the
+// request it was sent in body.
+func newFakeOpenAI(t *testing.T, body *openAIRequest, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if body != nil {
+			if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, event := range events {
+			fmt.Fprint(w, event)
+			flusher.Flush()
+			time.Sleep(chunkDelay)
+		}
+	}))
+}
+
+func newTestOpenAI(server *httptest.Server) *OpenAIProvider {
+	provider := NewOpenAIProvider(server.URL, "test-key", "test-model")
+	provider.HTTPClient = server.Client()
+	return provider
+}
+
+func TestOpenAIStreamForwardsChunksUntilDone(t *testing.T) {
+	var body openAIRequest
+	server := newFakeOpenAI(t, &body, []string{
+		": keepalive\n\n",
+		openAIChunk("Newton's ", ""),
+		openAIChunk("second ", ""),
+		openAIChunk("law", "stop"),
+		openAIDone,
+	})
+	defer server.Close()
+
+	start := time.Now()
+	chunks, result, err := collect(t, newTestOpenAI(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+
+	var texts []string
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	if got, want := strings.Join(texts, "|"), "Newton's |second |law"; got != want {
+		t.Fatalf("chunks = %q, want %q", got, want)
+	}
+	if result.FinishReason != "stop" {
+		t.Errorf("FinishReason = %q, want stop", result.FinishReason)
+	}
+	if first := chunks[0].At.Sub(start); first >= 2*chunkDelay {
+		t.Errorf("first chunk after %v, expected before the next chunk was sent", first)
+	}
+
+	if !body.Stream || body.Model != "test-model" || body.StreamOptions == nil || !body.StreamOptions.IncludeUsage {
+		t.Errorf("request = %+v, want a streamed request for usage", body)
+	}
+	if len(body.Messages) != 1 || body.Messages[0] != (openAIMessage{Role: RoleUser, Content: "F=ma?"}) {
+		t.Errorf("messages = %+v", body.Messages)
+	}
+}
+
+func TestOpenAIStreamDoneWithoutFinishReason(t *testing.T) {
+	// Some servers only mark the end of the stream with [DONE]
+	server := newFakeOpenAI(t, nil, []string{openAIChunk("no finish", ""), openAIDone})
+	defer server.Close()
+
+	chunks, result, err := collect(t, newTestOpenAI(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+	if len(chunks) != 1 || result.FinishReason != "" {
+		t.Errorf("chunks = %+v, result = %+v", chunks, result)
+	}
+}
+
+func TestOpenAIStreamWithoutDoneIsTruncated(t *testing.T) {
+	server := newFakeOpenAI(t, nil, []string{openAIChunk("This answer ", ""), openAIChunk("is cut", "")})
+	defer server.Close()
+
+	chunks, _, err := collect(t, newTestOpenAI(server))
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("err = %v, want ErrStreamTruncated", err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("expected the chunks received before the drop to be forwarded, got %+v", chunks)
+	}
+}
+
+func TestOpenAIStreamEndingMidEventIsTruncated(t *testing.T) {
+	partial := openAIChunk("cut off", "stop")
+	server := newFakeOpenAI(t, nil, []string{openAIChunk("This answer ", ""), partial[:len(partial)/2]})
+	defer server.Close()
+
+	chunks, _, err := collect(t, newTestOpenAI(server))
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("err = %v, want ErrStreamTruncated", err)
+	}
+	if len(chunks) != 1 || chunks[0].Text != "This answer " {
+		t.Errorf("expected the chunk received before the drop to be forwarded, got %+v", chunks)
+	}
+}
+
+func TestOpenAIStreamReportsUsage(t *testing.T) {
+	// With include_usage the usage arrives in a last chunk with no choices
+	usage := `data: {"object":"chat.completion.chunk","choices":[],` +
+		`"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}` + "\n\n"
+	server := newFakeOpenAI(t, nil, []string{openAIChunk("done", "stop"), usage, openAIDone})
+	defer server.Close()
+
+	_, result, err := collect(t, newTestOpenAI(server))
+	if err != nil {
+		t.Fatalf("StreamGenerate: %v", err)
+	}
+	if result.Usage == nil || *result.Usage != (Usage{PromptTokens: 12, OutputTokens: 3, TotalTokens: 15}) {
+		t.Errorf("Usage = %+v", result.Usage)
+	}
+}
@@ -0,0 +1,186 @@
+// pkg/llm/provider.go
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+)
+
+// ErrStreamTruncated is returned when an upstream stream closes before the
+// provider reported that the response was finished.
+var ErrStreamTruncated = errors.New("stream ended before the response was complete")
+
+// ErrUnsupported is returned when a request needs a capability the selected
+// provider does not have.
+var ErrUnsupported = errors.New("operation not supported by provider")
+
+// Part is one piece of a turn: text, an attached file, a function call made
+// by the model or the response to one. Exactly one field is set.
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// Blob is a file sent to the model inline, such as a photographed
+// worksheet. Only providers with the Vision capability accept it.
+type Blob struct {
+	MIMEType string `json:"mimeType"`
+	Data     []byte `json:"data"`
+}
+
+// HasInlineData reports whether any turn of contents carries a file.
+func HasInlineData(contents []Content) bool {
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			if part.InlineData != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FunctionDeclaration describes a tool the model may call. Parameters is a
+// JSON schema object in the subset Gemini accepts.
+type FunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// FunctionCall is the model asking for a declared function to be run. ID,
+// when the provider sets one, must be echoed in the response.
+type FunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// FunctionResponse carries the result of a FunctionCall back to the model.
+type FunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+// Content is a single role-tagged turn of a conversation. Roles use the
+// Gemini vocabulary ("user" and "model"); providers translate as needed.
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+type GenerationConfig struct {
+	Temperature     float64 `json:"temperature"`
+	TopK            int     `json:"topK"`
+	TopP            float64 `json:"topP"`
+	MaxOutputTokens int     `json:"maxOutputTokens"`
+}
+
+func DefaultGenerationConfig() GenerationConfig {
+	return GenerationConfig{
+		Temperature:     0.7,
+		TopK:            40,
+		TopP:            0.95,
+		MaxOutputTokens: 2048,
+	}
+}
+
+// Request is a provider-agnostic generation request. An empty Model selects
+// the provider's default model.
+type Request struct {
+	Model string
+	// SystemInstruction steers the model for the whole conversation. It is
+	// not part of Contents so history can be replayed under a different one.
+	SystemInstruction string
+	Contents          []Content
+	Config            GenerationConfig
+	// Tools are the functions the model may call instead of answering.
+	// Only providers with the Tools capability accept them.
+	Tools []FunctionDeclaration
+}
+
+type Chunk struct {
+	Text string
+}
+
+type Result struct {
+	FinishReason string
+	// Usage is the provider's token accounting, nil if it reported none.
+	Usage         *Usage
+	SafetyRatings []SafetyRating
+	// BlockReason is set when the provider refused the prompt itself.
+	BlockReason string
+	// FunctionCalls are the functions the model asked to be run. The
+	// caller runs them and sends a follow-up request with the responses.
+	FunctionCalls []FunctionCall
+}
+
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// SafetyRating is a provider's assessment of the response for one harm
+// category. Probability uses the Gemini vocabulary, e.g. "NEGLIGIBLE".
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// StatusError is returned when a provider answers with a non-200 status.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+type Capabilities struct {
+	Streaming    bool `json:"streaming"`
+	ModelListing bool `json:"model_listing"`
+	Vision       bool `json:"vision"`
+	Tools        bool `json:"tools"`
+}
+
+type Model struct {
+	ID          string `json:"id"`
+	Provider    string `json:"provider"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// Provider is an LLM backend the gateway can stream completions from.
+type Provider interface {
+	// Name identifies the provider in config and in chat metadata.
+	Name() string
+	Capabilities() Capabilities
+	ListModels(ctx context.Context) ([]Model, error)
+	// StreamGenerate calls onChunk for every piece of text as soon as it is
+	// received. Returning an error from onChunk aborts the stream.
+	StreamGenerate(ctx context.Context, req Request, onChunk func(Chunk) error) (*Result, error)
+}
+
+// Embedder is implemented by providers that can turn text into a vector
+// for similarity search.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// UserText is a convenience for building a single-turn request.
+func UserText(text string) []Content {
+	return []Content{{Role: RoleUser, Parts: []Part{{Text: text}}}}
+}
@@ -0,0 +1,64 @@
+// pkg/llm/registry.go
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds the providers configured for this deployment and the one
+// used when a request does not ask for a specific provider.
+type Registry struct {
+	mu          sync.RWMutex
+	providers   map[string]Provider
+	defaultName string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name()] = p
+	if r.defaultName == "" {
+		r.defaultName = p.Name()
+	}
+}
+
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("unknown provider %q", name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// Get returns the named provider, or the default provider if name is empty.
+func (r *Registry) Get(name string) (Provider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultName
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	return p, nil
+}
+
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,206 @@
+// pkg/llm/scripted.go
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ScriptRule replies with Reply when the latest user turn contains Match
+// (case-insensitive). A rule naming a Tool first calls it with Args, if the
+// request declares it, and replies once the result comes back; "{result}"
+// in Reply is replaced by the result.
+type ScriptRule struct {
+	Match string          `json:"match"`
+	Reply string          `json:"reply"`
+	Tool  string          `json:"tool,omitempty"`
+	Args  json.RawMessage `json:"args,omitempty"`
+}
+
+type Script struct {
+	Rules []ScriptRule `json:"rules"`
+	// Default is used when no rule matches. If empty the user text is echoed.
+	Default      string `json:"default"`
+	TokenDelayMs int    `json:"token_delay_ms"`
+}
+
+// ScriptedProvider is a deterministic, offline provider for local
+// development and CI. With an empty script it simply echoes the user.
+type ScriptedProvider struct {
+	name   string
+	script Script
+}
+
+func NewEchoProvider() *ScriptedProvider {
+	return &ScriptedProvider{name: "echo"}
+}
+
+func NewScriptedProvider(script Script) *ScriptedProvider {
+	return &ScriptedProvider{name: "scripted", script: script}
+}
+
+func LoadScript(path string) (Script, error) {
+	var script Script
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return script, fmt.Errorf("failed to read script: %w", err)
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return script, fmt.Errorf("failed to parse script %s: %w", path, err)
+	}
+	return script, nil
+}
+
+func (s *ScriptedProvider) Name() string { return s.name }
+
+func (s *ScriptedProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, ModelListing: true, Vision: true, Tools: true}
+}
+
+func (s *ScriptedProvider) ListModels(ctx context.Context) ([]Model, error) {
+	return []Model{{ID: s.name, Provider: s.name, DisplayName: "Deterministic " + s.name + " model"}}, nil
+}
+
+func (s *ScriptedProvider) StreamGenerate(ctx context.Context, req Request, onChunk func(Chunk) error) (*Result, error) {
+	text := lastUserText(req.Contents)
+	rule := s.match(text)
+	responses := functionResponses(req.Contents)
+	if rule != nil && rule.Tool != "" && responses == nil && declares(req.Tools, rule.Tool) {
+		return &Result{
+			FinishReason:  "STOP",
+			FunctionCalls: []FunctionCall{{Name: rule.Tool, Args: rule.Args}},
+		}, nil
+	}
+	reply := s.reply(rule, text, responses)
+	delay := time.Duration(s.script.TokenDelayMs) * time.Millisecond
+
+	for _, token := range SplitIntoTokens(reply) {
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onChunk(Chunk{Text: token}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{FinishReason: "STOP"}, nil
+}
+
+func (s *ScriptedProvider) match(text string) *ScriptRule {
+	lower := strings.ToLower(text)
+	for i, rule := range s.script.Rules {
+		if strings.Contains(lower, strings.ToLower(rule.Match)) {
+			return &s.script.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (s *ScriptedProvider) reply(rule *ScriptRule, text string, responses []FunctionResponse) string {
+	if rule != nil {
+		return strings.ReplaceAll(rule.Reply, "{result}", resultText(responses))
+	}
+	if s.script.Default != "" {
+		return s.script.Default
+	}
+	return "Echo: " + text
+}
+
+// lastUserText skips turns that only carry function responses.
+func lastUserText(contents []Content) string {
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Role != RoleUser {
+			continue
+		}
+		if text := joinText(contents[i].Parts); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// functionResponses returns the responses in the last turn, nil if it has
+// none.
+func functionResponses(contents []Content) []FunctionResponse {
+	if len(contents) == 0 {
+		return nil
+	}
+	var responses []FunctionResponse
+	for _, part := range contents[len(contents)-1].Parts {
+		if part.FunctionResponse != nil {
+			responses = append(responses, *part.FunctionResponse)
+		}
+	}
+	return responses
+}
+
+func declares(tools []FunctionDeclaration, name string) bool {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitIntoTokens splits text on word boundaries, keeping the separator
+// attached to the preceding token.
+func SplitIntoTokens(text string) []string {
+	var tokens []string
+	var currentToken []rune
+
+	for _, char := range text {
+		currentToken = append(currentToken, char)
+
+		if char == ' ' || char == '.' || char == ',' || char == '!' || char == '?' || char == '\n' {
+			tokens = append(tokens, string(currentToken))
+			currentToken = []rune{}
+		}
+	}
+
+	if len(currentToken) > 0 {
+		tokens = append(tokens, string(currentToken))
+	}
+
+	return tokens
+}
+
+// resultText renders the first response as a model would read it, after a
+// JSON round trip, unwrapping nested "result" fields down to the value.
+func resultText(responses []FunctionResponse) string {
+	if len(responses) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(responses[0].Response)
+	var value any
+	_ = json.Unmarshal(data, &value)
+	for {
+		object, ok := value.(map[string]any)
+		if !ok {
+			break
+		}
+		result, ok := object["result"]
+		if !ok {
+			break
+		}
+		value = result
+	}
+	switch v := value.(type) {
+	case string, float64, bool:
+		return fmt.Sprint(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
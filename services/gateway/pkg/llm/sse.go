@@ -0,0 +1,58 @@
+// pkg/llm/sse.go
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// readSSE reads a text/event-stream body and calls onData with the data of
+// every complete event. Lines are reassembled across network reads, so an
+// event split over several TCP packets is delivered once, whole. A trailing
+// event that is not terminated by a blank line is still delivered at EOF.
+func readSSE(r io.Reader, onData func(data []byte) error) error {
+	reader := bufio.NewReader(r)
+	var data bytes.Buffer
+	hasData := false
+
+	dispatch := func() error {
+		if !hasData {
+			return nil
+		}
+		payload := append([]byte(nil), data.Bytes()...)
+		data.Reset()
+		hasData = false
+		return onData(payload)
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+
+			switch {
+			case len(line) == 0:
+				if dispatchErr := dispatch(); dispatchErr != nil {
+					return dispatchErr
+				}
+			case line[0] == ':':
+				// Comment line, used by some servers as a keepalive
+			case bytes.HasPrefix(line, []byte("data:")):
+				value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+				if hasData {
+					data.WriteByte('\n')
+				}
+				data.Write(value)
+				hasData = true
+			}
+		}
+
+		if err == io.EOF {
+			return dispatch()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
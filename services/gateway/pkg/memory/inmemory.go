@@ -0,0 +1,90 @@
+// pkg/memory/inmemory.go
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+type conversation struct {
+	turns     []llm.Content
+	updatedAt time.Time
+}
+
+// InMemoryStore is a process-local Store. Conversations idle for longer than
+// ttl are forgotten, and each keeps at most maxTurns turns.
+type InMemoryStore struct {
+	mu            sync.Mutex
+	conversations map[string]*conversation
+	ttl           time.Duration
+	maxTurns      int
+	lastSweep     time.Time
+}
+
+func NewInMemoryStore(ttl time.Duration, maxTurns int) *InMemoryStore {
+	return &InMemoryStore{
+		conversations: make(map[string]*conversation),
+		ttl:           ttl,
+		maxTurns:      maxTurns,
+		lastSweep:     time.Now(),
+	}
+}
+
+func (s *InMemoryStore) History(ctx context.Context, conversationID string) ([]llm.Content, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[conversationID]
+	if !ok || s.expired(conv, time.Now()) {
+		return nil, nil
+	}
+	return append([]llm.Content(nil), conv.turns...), nil
+}
+
+func (s *InMemoryStore) Append(ctx context.Context, conversationID string, turns ...llm.Content) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	conv, ok := s.conversations[conversationID]
+	if !ok || s.expired(conv, now) {
+		conv = &conversation{}
+		s.conversations[conversationID] = conv
+	}
+	conv.turns = append(conv.turns, turns...)
+	if s.maxTurns > 0 && len(conv.turns) > s.maxTurns {
+		conv.turns = conv.turns[len(conv.turns)-s.maxTurns:]
+	}
+	conv.updatedAt = now
+	return nil
+}
+
+func (s *InMemoryStore) Clear(ctx context.Context, conversationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conversations, conversationID)
+	return nil
+}
+
+func (s *InMemoryStore) expired(conv *conversation, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(conv.updatedAt) > s.ttl
+}
+
+// sweep drops expired conversations at most once per minute. Callers must
+// hold s.mu.
+func (s *InMemoryStore) sweep(now time.Time) {
+	if s.ttl <= 0 || now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, conv := range s.conversations {
+		if s.expired(conv, now) {
+			delete(s.conversations, id)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// pkg/memory/redis.go
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+const redisKeyPrefix = "zephyr:conversation:"
+
+// RedisStore keeps conversations in Redis lists so every gateway replica
+// sees the same history.
+type RedisStore struct {
+	client   *redis.Client
+	ttl      time.Duration
+	maxTurns int
+}
+
+func NewRedisStore(client *redis.Client, ttl time.Duration, maxTurns int) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl, maxTurns: maxTurns}
+}
+
+func (s *RedisStore) key(conversationID string) string {
+	return redisKeyPrefix + conversationID
+}
+
+func (s *RedisStore) History(ctx context.Context, conversationID string) ([]llm.Content, error) {
+	values, err := s.client.LRange(ctx, s.key(conversationID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation %s: %w", conversationID, err)
+	}
+
+	turns := make([]llm.Content, 0, len(values))
+	for _, value := range values {
+		var turn llm.Content
+		if err := json.Unmarshal([]byte(value), &turn); err != nil {
+			return nil, fmt.Errorf("failed to decode turn in conversation %s: %w", conversationID, err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, nil
+}
+
+func (s *RedisStore) Append(ctx context.Context, conversationID string, turns ...llm.Content) error {
+	if len(turns) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(turns))
+	for _, turn := range turns {
+		data, err := json.Marshal(turn)
+		if err != nil {
+			return fmt.Errorf("failed to encode turn: %w", err)
+		}
+		values = append(values, data)
+	}
+
+	key := s.key(conversationID)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		if s.maxTurns > 0 {
+			pipe.LTrim(ctx, key, int64(-s.maxTurns), -1)
+		}
+		if s.ttl > 0 {
+			pipe.Expire(ctx, key, s.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append to conversation %s: %w", conversationID, err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Clear(ctx context.Context, conversationID string) error {
+	if err := s.client.Del(ctx, s.key(conversationID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear conversation %s: %w", conversationID, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// pkg/memory/store.go
+package memory
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// Store keeps the role-tagged turns of each conversation so they can be
+// replayed to the provider on the next message.
+type Store interface {
+	// History returns the turns of a conversation, oldest first.
+	History(ctx context.Context, conversationID string) ([]llm.Content, error)
+	Append(ctx context.Context, conversationID string, turns ...llm.Content) error
+	Clear(ctx context.Context, conversationID string) error
+}
+
+// EstimateTokens approximates the token count of text. Gemini and most BPE
+// tokenizers average roughly four characters per token for English.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// blobTokens is what Gemini charges for an image up to 384 pixels a side.
+// Larger images and documents cost more, so attachments are underestimated.
+const blobTokens = 258
+
+// ContentTokens estimates the tokens of every part of contents.
+func ContentTokens(contents ...llm.Content) int {
+	tokens := 0
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			tokens += EstimateTokens(part.Text)
+			if part.InlineData != nil {
+				tokens += blobTokens
+			}
+		}
+	}
+	return tokens
+}
+
+// Trim drops the oldest turns until the estimated token count fits within
+// budget. The newest turn is always kept, and the result never starts with a
+// model turn since providers expect the conversation to open with the user.
+// A budget of zero or less disables trimming.
+func Trim(contents []llm.Content, budget int) []llm.Content {
+	if budget <= 0 || len(contents) == 0 {
+		return contents
+	}
+
+	start := len(contents) - 1
+	used := ContentTokens(contents[start])
+	for start > 0 {
+		next := used + ContentTokens(contents[start-1])
+		if next > budget {
+			break
+		}
+		used = next
+		start--
+	}
+
+	for start < len(contents)-1 && contents[start].Role != llm.RoleUser {
+		start++
+	}
+	return contents[start:]
+}
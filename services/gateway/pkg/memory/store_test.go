@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// turn is a turn of role whose text is estimated at tokens tokens.
+func turn(role string, tokens int) llm.Content {
+	return llm.Content{Role: role, Parts: []llm.Part{{Text: strings.Repeat("abcd", tokens)}}}
+}
+
+func TestTrim(t *testing.T) {
+	conversation := []llm.Content{
+		turn(llm.RoleUser, 10), turn(llm.RoleModel, 10),
+		turn(llm.RoleUser, 10), turn(llm.RoleModel, 10),
+		turn(llm.RoleUser, 10),
+	}
+	tests := []struct {
+		name     string
+		contents []llm.Content
+		budget   int
+		// want is the index of the first turn kept
+		want int
+	}{
+		{"no budget keeps everything", conversation, 0, 0},
+		{"negative budget keeps everything", conversation, -1, 0},
+		{"everything fits", conversation, 50, 0},
+		{"drops the oldest pair", conversation, 49, 2},
+		{"never starts with a model turn", conversation, 40, 2},
+		{"exactly one pair and the new turn", conversation, 30, 2},
+		{"only the new turn fits", conversation, 29, 4},
+		{"an oversized new turn is kept alone", conversation, 5, 4},
+		{"a single oversized turn is kept", []llm.Content{turn(llm.RoleUser, 100)}, 10, 0},
+		{"empty", nil, 10, 0},
+		{"an image counts against the budget", []llm.Content{
+			{Role: llm.RoleUser, Parts: []llm.Part{{InlineData: &llm.Blob{MIMEType: "image/png"}}}},
+			turn(llm.RoleModel, 10), turn(llm.RoleUser, 10),
+		}, 100, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Trim(test.contents, test.budget)
+			if want := test.contents[test.want:]; len(got) != len(want) {
+				t.Fatalf("kept %d turns, want %d", len(got), len(want))
+			}
+			if len(got) > 1 && got[0].Role != llm.RoleUser {
+				t.Errorf("trimmed history starts with a %s turn", got[0].Role)
+			}
+		})
+	}
+}
+
+func testStore(t *testing.T, store Store, expire func()) {
+	t.Helper()
+	ctx := context.Background()
+
+	if turns, err := store.History(ctx, "alice\x00c1"); err != nil || len(turns) != 0 {
+		t.Fatalf("History of a new conversation = %v, %v", turns, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Append(ctx, "alice\x00c1", turn(llm.RoleUser, i+1), turn(llm.RoleModel, i+1)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	store.Append(ctx, "bob\x00c1", turn(llm.RoleUser, 1))
+
+	// Only the newest four turns are kept, oldest first
+	turns, err := store.History(ctx, "alice\x00c1")
+	if err != nil || len(turns) != 4 {
+		t.Fatalf("History = %d turns, %v, want 4", len(turns), err)
+	}
+	if turns[0].Role != llm.RoleUser || ContentTokens(turns[0]) != 2 || ContentTokens(turns[3]) != 3 {
+		t.Errorf("History kept the wrong turns: %+v", turns)
+	}
+	if turns, _ := store.History(ctx, "bob\x00c1"); len(turns) != 1 {
+		t.Errorf("bob's conversation has %d turns", len(turns))
+	}
+
+	if err := store.Clear(ctx, "alice\x00c1"); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if turns, _ := store.History(ctx, "alice\x00c1"); len(turns) != 0 {
+		t.Errorf("History after Clear = %d turns", len(turns))
+	}
+
+	expire()
+	if turns, _ := store.History(ctx, "bob\x00c1"); len(turns) != 0 {
+		t.Errorf("History after the ttl = %d turns", len(turns))
+	}
+}
+
+func TestInMemoryStore(t *testing.T) {
+	testStore(t, NewInMemoryStore(100*time.Millisecond, 4), func() { time.Sleep(150 * time.Millisecond) })
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	testStore(t, NewRedisStore(client, time.Minute, 4), func() { server.FastForward(2 * time.Minute) })
+}
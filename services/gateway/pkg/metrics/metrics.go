@@ -0,0 +1,160 @@
+// pkg/metrics/metrics.go
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/ws"
+)
+
+const namespace = "zephyr_gateway"
+
+// Labels are kept to small, fixed sets: provider names come from config and
+// message types from the protocol, never from client-supplied strings such
+// as model names.
+var (
+	Messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "WebSocket messages by direction (in, out) and type.",
+	}, []string{"direction", "type"})
+
+	TimeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_time_to_first_token_seconds",
+		Help:      "Time from starting a generation to forwarding its first token.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 0.75, 1, 1.5, 2, 3, 5, 8, 13},
+	}, []string{"provider"})
+
+	GenerationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_duration_seconds",
+		Help:      "Total generation time by outcome (complete, cancelled, error).",
+		Buckets:   []float64{0.5, 1, 2, 4, 8, 15, 30, 60, 120},
+	}, []string{"provider", "outcome"})
+
+	UpstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Generation requests sent to LLM providers.",
+	}, []string{"provider"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed provider requests by HTTP status, or truncated/network for streams that broke.",
+	}, []string{"provider", "status"})
+
+	Tokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Tokens sent to (prompt) and received from (output) providers.",
+	}, []string{"provider", "direction"})
+
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Chat messages refused by a rate limit or quota.",
+	}, []string{"limit"})
+
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Response cache lookups by result (exact, semantic, miss, error).",
+	}, []string{"result"})
+
+	ToolCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Tool calls made by models, by tool and outcome (ok, error, timeout, unknown).",
+	}, []string{"tool", "outcome"})
+
+	ToolDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Time to run a tool call.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 8),
+	}, []string{"tool"})
+
+	Cancellations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cancellations_total",
+		Help:      "Generations stopped early, by reason (client, disconnect).",
+	}, []string{"reason"})
+
+	Resumes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_resumes_total",
+		Help:      "Resume requests by outcome (resumed, not_found, truncated, disabled, error).",
+	}, []string{"outcome"})
+
+	SendQueueFrames = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "send_queue_frames",
+		Help:      "Frames queued for clients across all connections.",
+	})
+
+	SlowConsumers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_consumer_total",
+		Help:      "Frames that found their connection's send queue full, by what was done (coalesced, dropped, paused).",
+	}, []string{"action"})
+
+	SendQueuePause = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_queue_pause_seconds",
+		Help:      "How long generations waited for room in a full send queue.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	})
+
+	ClusterEnvelopes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cluster_envelopes_total",
+		Help:      "Envelopes routed to connections, by route (local, published, received, dropped).",
+	}, []string{"route"})
+)
+
+// UpstreamStatus is the status label for a failed provider request.
+func UpstreamStatus(err error) string {
+	var status *llm.StatusError
+	switch {
+	case errors.As(err, &status):
+		return strconv.Itoa(status.StatusCode)
+	case errors.Is(err, llm.ErrStreamTruncated):
+		return "truncated"
+	default:
+		return "network"
+	}
+}
+
+// RegisterConnections exports the connection counters of m.
+func RegisterConnections(m *ws.ConnectionManager) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections_active",
+		Help:      "Open WebSocket connections.",
+	}, func() float64 { return float64(m.Stats().Active) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_opened_total",
+		Help:      "WebSocket connections accepted.",
+	}, func() float64 { return float64(m.Stats().Opened) })
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_reaped_total",
+		Help:      "WebSocket connections closed because the client went silent.",
+	}, func() float64 { return float64(m.Stats().Reaped) })
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/chat"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/ratelimit"
+)
+
+type discardWriter struct{}
+
+func (discardWriter) WriteJSON(interface{}) error { return nil }
+
+// samples returns how many observations histogram has under labels.
+func samples(t *testing.T, histogram *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := histogram.WithLabelValues(labels...).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestChatIsCounted(t *testing.T) {
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewScriptedProvider(llm.Script{Default: "an answer"}))
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Config{
+		UserMessages: ratelimit.Rate{PerMinute: 1, Burst: 1},
+	})
+	service := &chat.Service{Providers: providers, Limiter: limiter}
+
+	counters := []struct {
+		name    string
+		counter prometheus.Counter
+		want    float64
+		before  float64
+	}{
+		{"chats in", metrics.Messages.WithLabelValues("in", chat.TypeChat), 2, 0},
+		{"completes out", metrics.Messages.WithLabelValues("out", chat.TypeComplete), 1, 0},
+		{"rate limit rejections", metrics.RateLimitRejections.WithLabelValues(ratelimit.LimitUserMessages), 1, 0},
+	}
+	for i := range counters {
+		counters[i].before = testutil.ToFloat64(counters[i].counter)
+	}
+	durations := samples(t, metrics.GenerationDuration, "scripted", "complete")
+	firstTokens := samples(t, metrics.TimeToFirstToken, "scripted")
+
+	// The second chat is over the one-a-minute limit
+	session := service.NewSession(context.Background(), &discardWriter{}, "10.0.0.1")
+	session.HandleFrame([]byte(`{"type":"chat","message_id":"m1","content":"hi"}`))
+	session.HandleFrame([]byte(`{"type":"chat","message_id":"m2","content":"hi again"}`))
+	session.Wait()
+	session.Close()
+
+	for _, c := range counters {
+		if delta := testutil.ToFloat64(c.counter) - c.before; delta != c.want {
+			t.Errorf("%s went up by %v, want %v", c.name, delta, c.want)
+		}
+	}
+	if got := samples(t, metrics.GenerationDuration, "scripted", "complete"); got != durations+1 {
+		t.Errorf("generation durations = %d, want %d", got, durations+1)
+	}
+	if got := samples(t, metrics.TimeToFirstToken, "scripted"); got != firstTokens+1 {
+		t.Errorf("times to first token = %d, want %d", got, firstTokens+1)
+	}
+	if n := testutil.CollectAndCount(metrics.RateLimitRejections, "zephyr_gateway_rate_limit_rejections_total"); n == 0 {
+		t.Error("no rate limit rejections collected")
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	for _, series := range []string{
+		`zephyr_gateway_messages_total{direction="in",type="chat"}`,
+		`zephyr_gateway_rate_limit_rejections_total{limit="user_messages_per_minute"}`,
+		`zephyr_gateway_generation_duration_seconds_count{outcome="complete",provider="scripted"}`,
+		`zephyr_gateway_generation_time_to_first_token_seconds_count{provider="scripted"}`,
+	} {
+		if !strings.Contains(string(body), series) {
+			t.Errorf("/metrics does not serve %s", series)
+		}
+	}
+}
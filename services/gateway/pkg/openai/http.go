@@ -0,0 +1,373 @@
+// pkg/openai/http.go
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/attachment"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/auth"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/chat"
+)
+
+// listModelsTimeout bounds asking each provider for its models.
+const listModelsTimeout = 5 * time.Second
+
+// Handler serves the OpenAI chat completions and models APIs, so tools
+// built for OpenAI can use the gateway unchanged. Completions run through
+// the same sessions as /chat, with its assistants, rate limits and tools.
+//
+// Models are addressed as an assistant id, a provider name, a
+// "provider/model" pair or DefaultModel.
+type Handler struct {
+	Service *chat.Service
+	// ClientIP returns the address per-IP limits apply to.
+	ClientIP func(*http.Request) string
+	// MaxBodyBytes bounds the request body. Zero allows a request with
+	// attachments of the default size.
+	MaxBodyBytes int64
+	// WriteTimeout bounds writing each streamed chunk.
+	WriteTimeout time.Duration
+	// Draining turns new completions away while it returns true.
+	Draining func() bool
+}
+
+// ServeModels answers GET /v1/models with the assistants and the models
+// of every provider that lists them. Providers that fail to answer are
+// left out.
+func (h *Handler) ServeModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, invalidRequest("use GET"))
+		return
+	}
+
+	list := ModelList{Object: "list", Data: []Model{{ID: DefaultModel, Object: "model", OwnedBy: "zephyr"}}}
+	if assistants := h.Service.Assistants; assistants != nil {
+		for _, a := range assistants.List() {
+			list.Data = append(list.Data, Model{ID: a.ID, Object: "model", OwnedBy: "zephyr"})
+		}
+	}
+
+	names := h.Service.Providers.Names()
+	models := make([][]Model, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		provider, err := h.Service.Providers.Get(name)
+		if err != nil {
+			continue
+		}
+		models[i] = []Model{{ID: name, Object: "model", OwnedBy: name}}
+		if !provider.Capabilities().ModelListing {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), listModelsTimeout)
+			defer cancel()
+			listed, err := provider.ListModels(ctx)
+			if err != nil {
+				log.Printf("Failed to list %s models: %v", name, err)
+				return
+			}
+			for _, m := range listed {
+				models[i] = append(models[i], Model{ID: name + "/" + m.ID, Object: "model", OwnedBy: name})
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	for _, m := range models {
+		list.Data = append(list.Data, m...)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// ServeCompletions answers POST /v1/chat/completions, streaming
+// chat.completion.chunk events when the request sets stream.
+func (h *Handler) ServeCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, invalidRequest("use POST"))
+		return
+	}
+	if h.Draining != nil && h.Draining() {
+		writeError(w, http.StatusServiceUnavailable, ErrorResponse{Error: ErrorDetail{
+			Message: "server is shutting down, retry shortly", Type: "server_error", Code: "server_shutting_down",
+		}})
+		return
+	}
+
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = chat.MaxFrameBytes(attachment.DefaultMaxBytes)
+	}
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, invalidRequest("request is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, invalidRequest("invalid JSON: %v", err))
+		return
+	}
+
+	message, requestErr := toMessage(&req)
+	if requestErr == nil {
+		requestErr = h.route(&message, req.Model)
+	}
+	if requestErr != nil {
+		status := http.StatusBadRequest
+		detail := invalidRequest("%s", requestErr.message)
+		detail.Error.Param = &requestErr.param
+		if requestErr.param == "model" {
+			status, detail.Error.Code = http.StatusNotFound, "model_not_found"
+		}
+		writeError(w, status, detail)
+		return
+	}
+	if invalid := message.Validate(); invalid != nil {
+		writeError(w, invalid.HTTPStatus(), toError(invalid))
+		return
+	}
+
+	ctx := context.Background()
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		ctx = auth.WithIdentity(ctx, identity)
+		// Trusted backends name the student they ask for
+		if req.User != "" && identity.HasRole(chat.ServiceRole) {
+			message.Metadata["user_id"] = req.User
+		}
+	}
+	model := req.Model
+	if model == "" {
+		model = DefaultModel
+	}
+	completions := &completionWriter{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		timeout: h.WriteTimeout,
+		stream:  req.Stream,
+		usage:   req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+		model:   model,
+		created: time.Now().Unix(),
+	}
+	session := h.Service.NewSession(ctx, completions, h.ClientIP(r))
+	// Closing cancels the generation if the client went away
+	defer session.Close()
+	if err := session.HandleMessage(message); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+	if !req.Stream {
+		// The writer goroutine may still hold the last frame
+		session.Close()
+		completions.respond()
+	}
+}
+
+// route addresses message to the assistant or provider named by model.
+func (h *Handler) route(message *chat.Message, model string) *requestError {
+	if model == "" || model == DefaultModel {
+		return nil
+	}
+	if assistants := h.Service.Assistants; assistants != nil {
+		for _, a := range assistants.List() {
+			if a.ID == model {
+				message.Metadata["assistant"] = model
+				return nil
+			}
+		}
+	}
+	provider, providerModel, _ := strings.Cut(model, "/")
+	if _, err := h.Service.Providers.Get(provider); err != nil || provider == "" {
+		return invalid("model", "the model %q does not exist; see /v1/models", model)
+	}
+	message.Metadata["provider"] = provider
+	if providerModel != "" {
+		message.Metadata["model"] = providerModel
+	}
+	return nil
+}
+
+// completionWriter turns the frames of a generation into a completion. When
+// streaming, each is written as a chunk as it arrives; otherwise they are
+// collected for respond. A rejection before the generation starts is
+// answered with its HTTP status.
+type completionWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+	stream  bool
+	usage   bool
+	model   string
+	created int64
+
+	id       string
+	started  bool
+	finished bool
+	text     strings.Builder
+	finish   string
+	reported *Usage
+	failure  *chat.Error
+}
+
+func (c *completionWriter) WriteJSON(v interface{}) error {
+	frame, ok := v.(chat.Message)
+	if !ok || c.finished {
+		return nil
+	}
+
+	switch frame.Type {
+	case chat.TypeStart:
+		c.started = true
+		c.id = "chatcmpl-" + frame.MessageID
+		if c.stream {
+			c.w.Header().Set("Content-Type", "text/event-stream")
+			c.w.Header().Set("Cache-Control", "no-cache")
+			c.w.Header().Set("X-Accel-Buffering", "no")
+			c.w.WriteHeader(http.StatusOK)
+			return c.chunk(Choice{Delta: &ReplyMessage{Role: "assistant"}}, nil)
+		}
+	case chat.TypeToken:
+		c.text.WriteString(frame.Content)
+		if c.stream {
+			return c.chunk(Choice{Delta: &ReplyMessage{Content: frame.Content}}, nil)
+		}
+	case chat.TypeComplete:
+		c.finished = true
+		c.finish = finishReason(frame.FinishReason)
+		if frame.Usage != nil {
+			c.reported = &Usage{
+				PromptTokens:     frame.Usage.PromptTokens,
+				CompletionTokens: frame.Usage.OutputTokens,
+				TotalTokens:      frame.Usage.PromptTokens + frame.Usage.OutputTokens,
+			}
+		}
+		if !c.stream {
+			return nil
+		}
+		finish := c.finish
+		if err := c.chunk(Choice{Delta: &ReplyMessage{}, FinishReason: &finish}, nil); err != nil {
+			return err
+		}
+		if c.usage && c.reported != nil {
+			if err := c.write(ChatCompletion{
+				ID: c.id, Object: "chat.completion.chunk", Created: c.created, Model: c.model,
+				Choices: []Choice{}, Usage: c.reported,
+			}); err != nil {
+				return err
+			}
+		}
+		return c.done()
+	case chat.TypeCancelled:
+		c.finished = true
+		if c.stream && c.started {
+			return c.done()
+		}
+	case chat.TypeError, chat.TypeRateLimited, chat.TypeServerShutdown:
+		if frame.Error == nil {
+			return nil
+		}
+		c.finished = true
+		c.failure = frame.Error
+		if !c.stream {
+			return nil
+		}
+		if !c.started {
+			writeError(c.w, frame.Error.HTTPStatus(), toError(frame.Error))
+			return nil
+		}
+		// Headers are gone; OpenAI reports mid-stream failures as an
+		// error event
+		if err := c.write(toError(frame.Error)); err != nil {
+			return err
+		}
+		return c.done()
+	}
+	return nil
+}
+
+func (c *completionWriter) chunk(choice Choice, usage *Usage) error {
+	return c.write(ChatCompletion{
+		ID: c.id, Object: "chat.completion.chunk", Created: c.created, Model: c.model,
+		Choices: []Choice{choice}, Usage: usage,
+	})
+}
+
+func (c *completionWriter) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode chunk: %w", err)
+	}
+	if c.timeout > 0 {
+		c.rc.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	if _, err := io.WriteString(c.w, "data: "+string(data)+"\n\n"); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+func (c *completionWriter) done() error {
+	if _, err := io.WriteString(c.w, "data: [DONE]\n\n"); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// respond writes the collected answer of a non-streaming completion.
+func (c *completionWriter) respond() {
+	switch {
+	case c.failure != nil:
+		writeError(c.w, c.failure.HTTPStatus(), toError(c.failure))
+	case c.finish == "":
+		// The generation was cancelled, which only the server does here
+		writeError(c.w, http.StatusServiceUnavailable, ErrorResponse{Error: ErrorDetail{
+			Message: "the generation was cancelled", Type: "server_error", Code: "cancelled",
+		}})
+	default:
+		finish := c.finish
+		writeJSON(c.w, http.StatusOK, ChatCompletion{
+			ID:      c.id,
+			Object:  "chat.completion",
+			Created: c.created,
+			Model:   c.model,
+			Choices: []Choice{{Message: &ReplyMessage{Role: "assistant", Content: c.text.String()}, FinishReason: &finish}},
+			Usage:   c.reported,
+		})
+	}
+}
+
+func invalidRequest(format string, args ...any) ErrorResponse {
+	return ErrorResponse{Error: ErrorDetail{Message: fmt.Sprintf(format, args...), Type: "invalid_request_error"}}
+}
+
+func writeError(w http.ResponseWriter, status int, response ErrorResponse) {
+	writeJSON(w, status, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write OpenAI response: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+// pkg/openai/openai.go
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/assistant"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/chat"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// DefaultModel addresses the default assistant, or the assistant picked by
+// auto-routing, with its own provider.
+const DefaultModel = "zephyr"
+
+// ChatCompletionRequest is the subset of the OpenAI chat completions
+// request the gateway understands. Other fields are accepted and ignored so
+// existing clients work unchanged.
+type ChatCompletionRequest struct {
+	Model               string         `json:"model"`
+	Messages            []ChatMessage  `json:"messages"`
+	Stream              bool           `json:"stream"`
+	StreamOptions       *StreamOptions `json:"stream_options,omitempty"`
+	Temperature         *float64       `json:"temperature,omitempty"`
+	TopP                *float64       `json:"top_p,omitempty"`
+	MaxTokens           *int           `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int           `json:"max_completion_tokens,omitempty"`
+	N                   *int           `json:"n,omitempty"`
+	User                string         `json:"user,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatMessage is one message of the conversation. Content is either a
+// string or an array of text and image_url parts.
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type ChatCompletion struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+// Choice is a choice of a completion, with Message set, or of a streamed
+// chunk, with Delta set. FinishReason is null until the last chunk.
+type Choice struct {
+	Index        int           `json:"index"`
+	Message      *ReplyMessage `json:"message,omitempty"`
+	Delta        *ReplyMessage `json:"delta,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+type ReplyMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// ErrorResponse is OpenAI's error envelope.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code"`
+}
+
+// requestError is a request the gateway cannot map onto a chat message.
+type requestError struct {
+	param   string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func invalid(param, format string, args ...any) *requestError {
+	return &requestError{param: param, message: fmt.Sprintf(format, args...)}
+}
+
+// toMessage turns a completion request into a chat message: the last user
+// message becomes its content and attachments, earlier turns its history
+// and system messages its instructions. Routing metadata is added by the
+// caller.
+func toMessage(req *ChatCompletionRequest) (chat.Message, *requestError) {
+	message := chat.Message{Type: chat.TypeChat, Metadata: map[string]any{}}
+	if len(req.Messages) == 0 {
+		return message, invalid("messages", "messages must not be empty")
+	}
+	if req.N != nil && *req.N != 1 {
+		return message, invalid("n", "only n=1 is supported")
+	}
+
+	var instructions []string
+	last := len(req.Messages) - 1
+	for i, m := range req.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		text, attachments, err := parseContent(m.Content, param)
+		if err != nil {
+			return message, err
+		}
+		switch m.Role {
+		case "system", "developer":
+			instructions = append(instructions, text)
+			continue
+		case "user":
+			if i == last {
+				message.Content = text
+				message.Attachments = attachments
+				continue
+			}
+			// Like conversation memory, earlier turns keep a note in place of
+			// their images
+			turn := llm.Content{Role: llm.RoleUser}
+			for range attachments {
+				turn.Parts = append(turn.Parts, llm.Part{Text: "[Attached image]"})
+			}
+			if text != "" {
+				turn.Parts = append(turn.Parts, llm.Part{Text: text})
+			}
+			message.History = append(message.History, turn)
+		case "assistant":
+			if len(attachments) > 0 {
+				return message, invalid(param+".content", "assistant messages can only contain text")
+			}
+			message.History = append(message.History, llm.Content{Role: llm.RoleModel, Parts: []llm.Part{{Text: text}}})
+		case "tool", "function":
+			return message, invalid(param+".role", "client-side tools are not supported; the gateway runs its own")
+		default:
+			return message, invalid(param+".role", "unknown role %q", m.Role)
+		}
+	}
+	if req.Messages[last].Role != "user" {
+		return message, invalid(fmt.Sprintf("messages[%d].role", last), "the last message must be from the user")
+	}
+	message.Instructions = strings.Join(instructions, "\n\n")
+
+	var generation assistant.Generation
+	set := false
+	if t := req.Temperature; t != nil {
+		if *t < 0 || *t > 2 {
+			return message, invalid("temperature", "temperature must be between 0 and 2")
+		}
+		generation.Temperature, set = t, true
+	}
+	if p := req.TopP; p != nil {
+		if *p < 0 || *p > 1 {
+			return message, invalid("top_p", "top_p must be between 0 and 1")
+		}
+		generation.TopP, set = p, true
+	}
+	maxTokens := req.MaxCompletionTokens
+	if maxTokens == nil {
+		maxTokens = req.MaxTokens
+	}
+	if maxTokens != nil {
+		if *maxTokens <= 0 {
+			return message, invalid("max_tokens", "max_tokens must be positive")
+		}
+		generation.MaxOutputTokens, set = maxTokens, true
+	}
+	if set {
+		message.Generation = &generation
+	}
+	return message, nil
+}
+
+// parseContent reads a string content, or the text and images of a
+// content array. Images must be inline data: URLs, as the gateway does not
+// fetch remote files.
+func parseContent(raw json.RawMessage, param string) (string, []chat.Attachment, *requestError) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, invalid(param+".content", "content must be a string or an array of parts")
+	}
+
+	var texts []string
+	var attachments []chat.Attachment
+	for j, part := range parts {
+		field := fmt.Sprintf("%s.content[%d]", param, j)
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			if part.ImageURL == nil {
+				return "", nil, invalid(field+".image_url", "image_url is required")
+			}
+			data, err := decodeDataURL(part.ImageURL.URL)
+			if err != nil {
+				return "", nil, invalid(field+".image_url.url", "%v", err)
+			}
+			attachments = append(attachments, chat.Attachment{Data: data})
+		default:
+			return "", nil, invalid(field+".type", "unsupported content part %q", part.Type)
+		}
+	}
+	return strings.Join(texts, "\n"), attachments, nil
+}
+
+func decodeDataURL(url string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, fmt.Errorf("images must be sent as base64 data: URLs")
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, fmt.Errorf("images must be sent as base64 data: URLs")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 image data: %v", err)
+	}
+	return data, nil
+}
+
+// finishReason maps a provider finish reason to OpenAI's.
+func finishReason(reason string) string {
+	switch strings.ToUpper(reason) {
+	case "MAX_TOKENS", "LENGTH":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "CONTENT_FILTER":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// toError maps a chat error to OpenAI's envelope.
+func toError(err *chat.Error) ErrorResponse {
+	detail := ErrorDetail{Message: err.Message, Code: err.Name}
+	switch status := err.HTTPStatus(); {
+	case status == 429:
+		detail.Type = "rate_limit_error"
+	case status < 500:
+		detail.Type = "invalid_request_error"
+	default:
+		detail.Type = "server_error"
+	}
+	if len(err.Fields) > 0 {
+		param := err.Fields[0].Field
+		detail.Param = &param
+		detail.Message += ": " + err.Fields[0].Field + " " + err.Fields[0].Problem
+	}
+	return ErrorResponse{Error: detail}
+}
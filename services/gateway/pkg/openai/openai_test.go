@@ -0,0 +1,157 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/chat"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	providers := llm.NewRegistry()
+	providers.Register(llm.NewEchoProvider())
+	handler := &Handler{
+		Service:  &chat.Service{Providers: providers},
+		ClientIP: func(r *http.Request) string { return "127.0.0.1" },
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", handler.ServeCompletions)
+	mux.HandleFunc("/v1/models", handler.ServeModels)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, server *httptest.Server, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestCompletion(t *testing.T) {
+	server := newServer(t)
+
+	resp := post(t, server, `{"model":"echo","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":"Echo: hi"},
+		{"role":"user","content":[{"type":"text","text":"hello there"}]}]}`)
+	var completion ChatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || completion.Object != "chat.completion" || len(completion.Choices) != 1 {
+		t.Fatalf("completion = %d %+v", resp.StatusCode, completion)
+	}
+	choice := completion.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "Echo: hello there" || *choice.FinishReason != "stop" {
+		t.Errorf("choice = %+v", choice.Message)
+	}
+	if !strings.HasPrefix(completion.ID, "chatcmpl-") || completion.Model != "echo" {
+		t.Errorf("completion = %+v", completion)
+	}
+}
+
+func TestStreamedCompletion(t *testing.T) {
+	server := newServer(t)
+
+	resp := post(t, server, `{"messages":[{"role":"user","content":"hello there"}],"stream":true,"stream_options":{"include_usage":true}}`)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var chunks []ChatCompletion
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk ChatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done || len(chunks) < 3 {
+		t.Fatalf("chunks = %+v, done = %v", chunks, done)
+	}
+
+	var text strings.Builder
+	finished := false
+	for _, chunk := range chunks {
+		if chunk.Object != "chat.completion.chunk" || chunk.Model != DefaultModel {
+			t.Errorf("chunk = %+v", chunk)
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+			finished = finished || choice.FinishReason != nil
+		}
+	}
+	if text.String() != "Echo: hello there" || !finished {
+		t.Errorf("streamed %q, finished = %v", text.String(), finished)
+	}
+	if first := chunks[0].Choices[0].Delta; first.Role != "assistant" {
+		t.Errorf("first delta = %+v", first)
+	}
+	if last := chunks[len(chunks)-1]; len(last.Choices) != 0 || last.Usage == nil {
+		t.Errorf("last chunk = %+v, want usage", last)
+	}
+}
+
+func TestCompletionRejections(t *testing.T) {
+	server := newServer(t)
+
+	for _, c := range []struct {
+		body   string
+		status int
+		param  string
+	}{
+		{`{"messages":[]}`, http.StatusBadRequest, "messages"},
+		{`{"messages":[{"role":"tool","content":"42"}]}`, http.StatusBadRequest, "messages[0].role"},
+		{`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]}`, http.StatusBadRequest, "messages[1].role"},
+		{`{"messages":[{"role":"user","content":"hi"}],"temperature":3}`, http.StatusBadRequest, "temperature"},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound, "model"},
+	} {
+		resp := post(t, server, c.body)
+		var response ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		if resp.StatusCode != c.status || response.Error.Param == nil || *response.Error.Param != c.param {
+			t.Errorf("%s answered %d %+v", c.body, resp.StatusCode, response.Error)
+		}
+	}
+}
+
+func TestModels(t *testing.T) {
+	server := newServer(t)
+
+	resp, err := http.Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list ModelList
+	json.NewDecoder(resp.Body).Decode(&list)
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	if list.Object != "list" || len(ids) < 2 || ids[0] != DefaultModel || ids[1] != "echo" {
+		t.Errorf("models = %v", ids)
+	}
+}
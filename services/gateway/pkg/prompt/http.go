@@ -0,0 +1,94 @@
+// pkg/prompt/http.go
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// maxRenderRequest bounds the body of a render request.
+const maxRenderRequest = 256 << 10
+
+// RenderRequest asks to render a stored template, or a draft that has not
+// been saved yet so staff can preview a change before shipping it.
+type RenderRequest struct {
+	ID        string         `json:"id"`
+	Version   int            `json:"version"`
+	Draft     *Template      `json:"draft"`
+	Variables map[string]any `json:"variables"`
+}
+
+type RenderResponse struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+type errorResponse struct {
+	Error     string          `json:"error"`
+	Variables []VariableError `json:"variables,omitempty"`
+}
+
+// ServeList answers GET with every template version and its variables.
+func (l *Library) ServeList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use GET"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"templates": l.List()})
+}
+
+// ServeRender answers POST with a RenderRequest by rendering the template
+// with the given variables, exactly as a chat would.
+func (l *Library) ServeRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use POST"})
+		return
+	}
+
+	var req RenderRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRenderRequest))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	t := req.Draft
+	if t != nil {
+		if t.Version == 0 {
+			t.Version = 1
+		}
+		if err := t.compile(); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid draft: " + err.Error()})
+			return
+		}
+	} else {
+		var err error
+		if t, err = l.Get(req.ID, req.Version); err != nil {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	text, err := t.Render(req.Variables)
+	var invalid VariablesError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error(), Variables: invalid})
+	case err != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, RenderResponse{ID: t.ID, Version: t.Version, Text: text})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write prompt response: %v", err)
+	}
+}
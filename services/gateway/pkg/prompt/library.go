@@ -0,0 +1,192 @@
+// pkg/prompt/library.go
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Library holds every template version found in a directory, one YAML
+// file per version. Old versions stay loadable so an assistant can be
+// pinned to one while a new version is tried out.
+type Library struct {
+	dir string
+
+	mu        sync.RWMutex
+	templates map[string]map[int]*Template
+	modTimes  map[string]time.Time
+}
+
+// Load reads every *.yaml and *.yml file under dir.
+func Load(dir string) (*Library, error) {
+	l := &Library{dir: dir}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the directory. On error the library is left unchanged.
+func (l *Library) Reload() error {
+	modTimes, err := l.files()
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[string]map[int]*Template)
+	for path := range modTimes {
+		t, err := loadFile(path)
+		if err != nil {
+			return err
+		}
+		versions := templates[t.ID]
+		if versions == nil {
+			versions = make(map[int]*Template)
+			templates[t.ID] = versions
+		}
+		if other, exists := versions[t.Version]; exists {
+			return fmt.Errorf("template %s is defined in both %s and %s", t.Ref(), other.Path, path)
+		}
+		versions[t.Version] = t
+	}
+
+	l.mu.Lock()
+	l.templates = templates
+	l.modTimes = modTimes
+	l.mu.Unlock()
+	return nil
+}
+
+// files returns the template files under the directory with their
+// modification times.
+func (l *Library) files() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := filepath.WalkDir(l.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt templates: %w", err)
+	}
+	return modTimes, nil
+}
+
+func loadFile(path string) (*Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	defer f.Close()
+
+	var t Template
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	t.Path = path
+	if err := t.compile(); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// Watch reloads the library whenever a template file is added, removed or
+// changed, until ctx is cancelled. A failed reload keeps the previous
+// templates.
+func (l *Library) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := l.files()
+			if err != nil {
+				log.Printf("Failed to check prompt templates: %v", err)
+				continue
+			}
+			l.mu.RLock()
+			changed := len(current) != len(l.modTimes)
+			for path, modTime := range current {
+				if !modTime.Equal(l.modTimes[path]) {
+					changed = true
+				}
+			}
+			l.mu.RUnlock()
+
+			if !changed {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				log.Printf("Failed to reload prompt templates, keeping the previous ones: %v", err)
+				continue
+			}
+			log.Printf("Reloaded prompt templates")
+		}
+	}
+}
+
+// Get returns version of the template id, or its latest version if
+// version is 0.
+func (l *Library) Get(id string, version int) (*Template, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	versions, ok := l.templates[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template %q", id)
+	}
+	if version == 0 {
+		for v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("prompt template %q has no version %d", id, version)
+	}
+	return t, nil
+}
+
+// List returns every template version, sorted by id and then version.
+func (l *Library) List() []*Template {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var list []*Template
+	for _, versions := range l.templates {
+		for _, t := range versions {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
@@ -0,0 +1,224 @@
+// pkg/prompt/template.go
+package prompt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Variable types.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeEnum   = "enum"
+)
+
+// Template is one version of a named prompt. Templates use text/template
+// syntax with the variables as the data, e.g. {{.level}}.
+type Template struct {
+	ID          string     `yaml:"id" json:"id"`
+	Version     int        `yaml:"version" json:"version"`
+	Description string     `yaml:"description" json:"description,omitempty"`
+	Variables   []Variable `yaml:"variables" json:"variables,omitempty"`
+	Text        string     `yaml:"template" json:"template"`
+
+	// Path is the file the template was loaded from.
+	Path string `yaml:"-" json:"path"`
+
+	parsed *template.Template
+}
+
+// Variable declares a value a template accepts. Values are checked against
+// Type before rendering so a bad value is reported instead of silently
+// rendering as "<no value>".
+type Variable struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type" json:"type"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Required    bool   `yaml:"required" json:"required,omitempty"`
+	Default     any    `yaml:"default" json:"default,omitempty"`
+	// Values lists the allowed values of an enum.
+	Values []string `yaml:"values" json:"values,omitempty"`
+}
+
+// Ref names a template version, e.g. "math-physics@v3".
+func (t *Template) Ref() string {
+	return fmt.Sprintf("%s@v%d", t.ID, t.Version)
+}
+
+// funcs are available to every template.
+var funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+	"trim":  strings.TrimSpace,
+}
+
+func (t *Template) compile() error {
+	var problems []string
+	if t.ID == "" {
+		problems = append(problems, "id is required")
+	}
+	if t.Version <= 0 {
+		problems = append(problems, "version must be positive")
+	}
+	seen := make(map[string]bool)
+	for _, v := range t.Variables {
+		if v.Name == "" {
+			problems = append(problems, "variables need a name")
+			continue
+		}
+		if seen[v.Name] {
+			problems = append(problems, fmt.Sprintf("variable %q is declared twice", v.Name))
+		}
+		seen[v.Name] = true
+		switch v.Type {
+		case TypeString, TypeInt, TypeNumber, TypeBool:
+		case TypeEnum:
+			if len(v.Values) == 0 {
+				problems = append(problems, fmt.Sprintf("enum variable %q needs values", v.Name))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("variable %q has unknown type %q", v.Name, v.Type))
+			continue
+		}
+		if v.Default != nil {
+			if _, err := v.convert(v.Default); err != nil {
+				problems = append(problems, fmt.Sprintf("default of %q %v", v.Name, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	parsed, err := template.New(t.ID).Funcs(funcs).Option("missingkey=error").Parse(t.Text)
+	if err != nil {
+		return err
+	}
+	t.parsed = parsed
+	return nil
+}
+
+// VariableError is a value that does not fit its variable.
+type VariableError struct {
+	Variable string `json:"variable"`
+	Problem  string `json:"problem"`
+}
+
+// VariablesError lists every bad value passed to Render.
+type VariablesError []VariableError
+
+func (e VariablesError) Error() string {
+	problems := make([]string, len(e))
+	for i, v := range e {
+		problems[i] = v.Variable + " " + v.Problem
+	}
+	return "invalid template variables: " + strings.Join(problems, "; ")
+}
+
+// Render executes the template with values. Missing variables take their
+// default, or the zero value of their type if they are optional. Values
+// that are not declared are ignored, so clients can send the same
+// variables to every assistant. Invalid values fail with VariablesError.
+func (t *Template) Render(values map[string]any) (string, error) {
+	data := make(map[string]any, len(t.Variables))
+	var problems VariablesError
+	for _, v := range t.Variables {
+		raw, ok := values[v.Name]
+		if !ok || raw == nil {
+			raw = v.Default
+		}
+		if raw == nil {
+			if v.Required {
+				problems = append(problems, VariableError{v.Name, "is required"})
+				continue
+			}
+			data[v.Name] = v.zero()
+			continue
+		}
+		value, err := v.convert(raw)
+		if err != nil {
+			problems = append(problems, VariableError{v.Name, err.Error()})
+			continue
+		}
+		data[v.Name] = value
+	}
+	if len(problems) > 0 {
+		sort.Slice(problems, func(i, j int) bool { return problems[i].Variable < problems[j].Variable })
+		return "", problems
+	}
+
+	var b strings.Builder
+	if err := t.parsed.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", t.Ref(), err)
+	}
+	return b.String(), nil
+}
+
+func (v Variable) zero() any {
+	switch v.Type {
+	case TypeInt:
+		return int64(0)
+	case TypeNumber:
+		return 0.0
+	case TypeBool:
+		return false
+	default:
+		return ""
+	}
+}
+
+// convert checks raw against the variable's type. Numbers arrive as
+// float64 from JSON and as int from YAML defaults; both are accepted.
+func (v Variable) convert(raw any) (any, error) {
+	switch v.Type {
+	case TypeString:
+		if s, ok := raw.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a string")
+	case TypeEnum:
+		if s, ok := raw.(string); ok {
+			for _, allowed := range v.Values {
+				if s == allowed {
+					return s, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(v.Values, ", "))
+	case TypeBool:
+		if b, ok := raw.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("must be a boolean")
+	case TypeInt:
+		switch n := raw.(type) {
+		case int:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), nil
+			}
+		}
+		return nil, fmt.Errorf("must be an integer")
+	case TypeNumber:
+		switch n := raw.(type) {
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+		return nil, fmt.Errorf("must be a number")
+	}
+	return nil, fmt.Errorf("has unknown type %q", v.Type)
+}
@@ -0,0 +1,94 @@
+package prompt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderShippedTemplate(t *testing.T) {
+	library, err := Load("../../prompts")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	latest, err := library.Get("math-physics", 0)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if latest.Version != 2 {
+		t.Errorf("latest version = %d, want 2", latest.Version)
+	}
+
+	text, err := latest.Render(map[string]any{"course": "AP Physics 1", "hints_only": true})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, want := range []string{"high school student", `"AP Physics 1"`, "Do not give the full solution"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("rendered prompt lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "<no value>") {
+		t.Errorf("rendered prompt has a missing value:\n%s", text)
+	}
+
+	if _, err := library.Get("math-physics", 1); err != nil {
+		t.Errorf("old version not loadable: %v", err)
+	}
+}
+
+func TestRenderRejectsBadVariables(t *testing.T) {
+	tmpl := &Template{
+		ID:      "t",
+		Version: 1,
+		Variables: []Variable{
+			{Name: "level", Type: TypeEnum, Values: []string{"a", "b"}},
+			{Name: "count", Type: TypeInt, Required: true},
+			{Name: "ratio", Type: TypeNumber, Default: 1},
+		},
+		Text: "{{.level}} {{.count}} {{.ratio}}",
+	}
+	if err := tmpl.compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	_, err := tmpl.Render(map[string]any{"level": "c", "count": 1.5})
+	var invalid VariablesError
+	if !errors.As(err, &invalid) || len(invalid) != 2 {
+		t.Fatalf("Render error = %v, want two variable errors", err)
+	}
+	if invalid[0].Variable != "count" || invalid[1].Variable != "level" {
+		t.Errorf("variable errors = %+v", invalid)
+	}
+
+	text, err := tmpl.Render(map[string]any{"level": "b", "count": 3.0, "unused": true})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if text != "b 3 1" {
+		t.Errorf("Render = %q", text)
+	}
+}
+
+func TestServeRenderDraft(t *testing.T) {
+	library, err := Load("../../prompts")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	body := `{"draft": {"id": "greeting", "template": "Hello {{.name}}", "variables": [{"name": "name", "type": "string", "required": true}]}, "variables": {"name": "Ada"}}`
+	rec := httptest.NewRecorder()
+	library.ServeRender(rec, httptest.NewRequest(http.MethodPost, "/v1/prompts/render", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"text":"Hello Ada"`) {
+		t.Errorf("draft render = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	library.ServeRender(rec, httptest.NewRequest(http.MethodPost, "/v1/prompts/render", strings.NewReader(`{"id": "math-physics", "variables": {"level": "phd"}}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"variable":"level"`) {
+		t.Errorf("invalid variable render = %d %s", rec.Code, rec.Body)
+	}
+}
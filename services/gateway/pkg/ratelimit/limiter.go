@@ -0,0 +1,201 @@
+// pkg/ratelimit/limiter.go
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Names of the limits, reported to clients in rate_limited messages.
+const (
+	LimitUserMessages = "user_messages_per_minute"
+	LimitIPMessages   = "ip_messages_per_minute"
+	LimitConcurrency  = "concurrent_generations"
+	LimitDailyTokens  = "daily_token_quota"
+)
+
+// concurrencyTTL bounds how long a concurrency slot survives if the replica
+// holding it dies without releasing it.
+const concurrencyTTL = 10 * time.Minute
+
+// Rate is a token bucket refilled at PerMinute tokens per minute and
+// holding at most Burst tokens.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+func (r Rate) enabled() bool { return r.PerMinute > 0 }
+
+func (r Rate) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.PerMinute)
+}
+
+func (r Rate) perSecond() float64 { return float64(r.PerMinute) / 60 }
+
+// Backend stores limiter state. The in-memory backend is enough for a
+// single replica; Redis makes limits hold across replicas.
+type Backend interface {
+	// Allow takes one token from the bucket at key. When the bucket is
+	// empty it returns false and how long until a token is available.
+	Allow(ctx context.Context, key string, rate Rate, now time.Time) (bool, time.Duration, error)
+	// Acquire takes a slot of a counter limited to max, if one is free.
+	Acquire(ctx context.Context, key string, max int, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, key string) error
+	// AddUsage adds n to the counter at key, which expires at expireAt,
+	// and returns the new total.
+	AddUsage(ctx context.Context, key string, n int64, expireAt time.Time) (int64, error)
+	Usage(ctx context.Context, key string) (int64, error)
+}
+
+type Config struct {
+	UserMessages Rate
+	IPMessages   Rate
+	// MaxConcurrentPerUser limits generations across all of a user's
+	// connections. Zero disables the limit.
+	MaxConcurrentPerUser int
+	// DailyTokenQuota limits prompt plus output tokens per user per UTC
+	// day. Zero disables the quota.
+	DailyTokenQuota int64
+}
+
+// Rejection describes which limit refused a request.
+type Rejection struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("rate limited by %s, retry after %v", r.Limit, r.RetryAfter)
+}
+
+// Limiter applies the configured limits. Backend errors fail open so an
+// unavailable Redis does not take chat down with it.
+type Limiter struct {
+	backend Backend
+	now     func() time.Time
+
+	mu     sync.RWMutex
+	config Config
+}
+
+func NewLimiter(backend Backend, config Config) *Limiter {
+	return &Limiter{backend: backend, config: config, now: time.Now}
+}
+
+// SetConfig replaces the limits. Buckets and counters already in the
+// backend are kept, so a reload does not hand everyone a fresh burst.
+func (l *Limiter) SetConfig(config Config) {
+	l.mu.Lock()
+	l.config = config
+	l.mu.Unlock()
+}
+
+func (l *Limiter) currentConfig() Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
+
+// CheckMessage applies the per-user and per-IP message rates.
+func (l *Limiter) CheckMessage(ctx context.Context, user, ip string) *Rejection {
+	config := l.currentConfig()
+	now := l.now()
+
+	if config.UserMessages.enabled() && user != "" {
+		if rejection := l.allow(ctx, "msg:user:"+user, config.UserMessages, now, LimitUserMessages); rejection != nil {
+			return rejection
+		}
+	}
+	if config.IPMessages.enabled() && ip != "" {
+		if rejection := l.allow(ctx, "msg:ip:"+ip, config.IPMessages, now, LimitIPMessages); rejection != nil {
+			return rejection
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) allow(ctx context.Context, key string, rate Rate, now time.Time, limit string) *Rejection {
+	allowed, retryAfter, err := l.backend.Allow(ctx, key, rate, now)
+	if err != nil {
+		log.Printf("Rate limiter backend error for %s: %v", key, err)
+		return nil
+	}
+	if !allowed {
+		return &Rejection{Limit: limit, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// CheckQuota rejects users who have used up today's token quota.
+func (l *Limiter) CheckQuota(ctx context.Context, user string) *Rejection {
+	config := l.currentConfig()
+	if config.DailyTokenQuota <= 0 || user == "" {
+		return nil
+	}
+
+	now := l.now()
+	used, err := l.backend.Usage(ctx, quotaKey(user, now))
+	if err != nil {
+		log.Printf("Rate limiter backend error for %s quota: %v", user, err)
+		return nil
+	}
+	if used >= config.DailyTokenQuota {
+		return &Rejection{Limit: LimitDailyTokens, RetryAfter: nextDay(now).Sub(now)}
+	}
+	return nil
+}
+
+// RecordTokens charges tokens against the user's daily quota.
+func (l *Limiter) RecordTokens(ctx context.Context, user string, tokens int) {
+	config := l.currentConfig()
+	if config.DailyTokenQuota <= 0 || user == "" || tokens <= 0 {
+		return
+	}
+
+	now := l.now()
+	if _, err := l.backend.AddUsage(ctx, quotaKey(user, now), int64(tokens), nextDay(now).Add(time.Hour)); err != nil {
+		log.Printf("Failed to record token usage for %s: %v", user, err)
+	}
+}
+
+// AcquireGeneration reserves one of the user's concurrent generation slots.
+// The returned release func must be called when the generation ends.
+func (l *Limiter) AcquireGeneration(ctx context.Context, user string) (func(), *Rejection) {
+	config := l.currentConfig()
+	noop := func() {}
+	if config.MaxConcurrentPerUser <= 0 || user == "" {
+		return noop, nil
+	}
+
+	key := "gen:user:" + user
+	acquired, err := l.backend.Acquire(ctx, key, config.MaxConcurrentPerUser, concurrencyTTL)
+	if err != nil {
+		log.Printf("Rate limiter backend error for %s: %v", key, err)
+		return noop, nil
+	}
+	if !acquired {
+		return noop, &Rejection{Limit: LimitConcurrency, RetryAfter: time.Second}
+	}
+
+	return func() {
+		// The generation context may already be cancelled
+		if err := l.backend.Release(context.Background(), key); err != nil {
+			log.Printf("Failed to release %s: %v", key, err)
+		}
+	}, nil
+}
+
+func quotaKey(user string, now time.Time) string {
+	return "quota:" + user + ":" + now.UTC().Format("2006-01-02")
+}
+
+func nextDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
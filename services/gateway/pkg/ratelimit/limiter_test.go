@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeClock is the limiter's clock, moved by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestLimiter(backend Backend, config Config) (*Limiter, *fakeClock) {
+	// An hour before midnight UTC; counters still expire in real time
+	clock := &fakeClock{now: time.Now().UTC().Truncate(24 * time.Hour).Add(23 * time.Hour)}
+	limiter := NewLimiter(backend, config)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func testRefill(t *testing.T, backend Backend) {
+	t.Helper()
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(backend, Config{
+		UserMessages: Rate{PerMinute: 60, Burst: 3},
+		IPMessages:   Rate{PerMinute: 120},
+	})
+
+	// A fresh bucket holds the burst
+	for i := 0; i < 3; i++ {
+		if rejection := limiter.CheckMessage(ctx, "u1", ""); rejection != nil {
+			t.Fatalf("message %d rejected: %v", i+1, rejection)
+		}
+	}
+	rejection := limiter.CheckMessage(ctx, "u1", "")
+	if rejection == nil || rejection.Limit != LimitUserMessages || rejection.RetryAfter != time.Second {
+		t.Fatalf("message past the burst = %+v, want retry in 1s", rejection)
+	}
+
+	clock.Advance(400 * time.Millisecond)
+	if rejection := limiter.CheckMessage(ctx, "u1", ""); rejection == nil || rejection.RetryAfter != 600*time.Millisecond {
+		t.Errorf("partly refilled = %+v, want retry in 600ms", rejection)
+	}
+	clock.Advance(600 * time.Millisecond)
+	if rejection := limiter.CheckMessage(ctx, "u1", ""); rejection != nil {
+		t.Errorf("refilled token rejected: %v", rejection)
+	}
+	// Idle time refills no more than the burst
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		limiter.CheckMessage(ctx, "u1", "")
+	}
+	if limiter.CheckMessage(ctx, "u1", "") == nil {
+		t.Error("refilled past the burst")
+	}
+
+	// Other users have their own bucket; without a burst an IP gets a
+	// minute's worth
+	for i := 0; i < 120; i++ {
+		if rejection := limiter.CheckMessage(ctx, "u2", "10.0.0.1"); rejection != nil && rejection.Limit == LimitIPMessages {
+			t.Fatalf("message %d rejected by the IP limit", i+1)
+		}
+		clock.Advance(time.Second)
+	}
+}
+
+func testConcurrency(t *testing.T, backend Backend) {
+	t.Helper()
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(backend, Config{MaxConcurrentPerUser: 2})
+
+	release, rejection := limiter.AcquireGeneration(ctx, "u1")
+	if rejection != nil {
+		t.Fatalf("first slot rejected: %v", rejection)
+	}
+	if _, rejection := limiter.AcquireGeneration(ctx, "u1"); rejection != nil {
+		t.Fatalf("second slot rejected: %v", rejection)
+	}
+	if _, rejection := limiter.AcquireGeneration(ctx, "u1"); rejection == nil || rejection.Limit != LimitConcurrency {
+		t.Fatalf("third slot = %+v, want rejected", rejection)
+	}
+	if _, rejection := limiter.AcquireGeneration(ctx, "u2"); rejection != nil {
+		t.Errorf("another user's slot rejected: %v", rejection)
+	}
+	release()
+	if _, rejection := limiter.AcquireGeneration(ctx, "u1"); rejection != nil {
+		t.Errorf("released slot rejected: %v", rejection)
+	}
+}
+
+func testQuota(t *testing.T, backend Backend) {
+	t.Helper()
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(backend, Config{DailyTokenQuota: 100})
+
+	limiter.RecordTokens(ctx, "u1", 60)
+	if rejection := limiter.CheckQuota(ctx, "u1"); rejection != nil {
+		t.Fatalf("rejected under the quota: %v", rejection)
+	}
+	limiter.RecordTokens(ctx, "u1", 40)
+	rejection := limiter.CheckQuota(ctx, "u1")
+	if rejection == nil || rejection.Limit != LimitDailyTokens || rejection.RetryAfter != time.Hour {
+		t.Fatalf("used up quota = %+v, want retry at midnight UTC", rejection)
+	}
+	if rejection := limiter.CheckQuota(ctx, "u2"); rejection != nil {
+		t.Errorf("another user rejected: %v", rejection)
+	}
+
+	clock.Advance(time.Hour)
+	if rejection := limiter.CheckQuota(ctx, "u1"); rejection != nil {
+		t.Errorf("rejected the next day: %v", rejection)
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	t.Run("refill", func(t *testing.T) { testRefill(t, NewMemoryBackend()) })
+	t.Run("concurrency", func(t *testing.T) { testConcurrency(t, NewMemoryBackend()) })
+	t.Run("quota", func(t *testing.T) { testQuota(t, NewMemoryBackend()) })
+}
+
+func TestRedisBackend(t *testing.T) {
+	backend := func() Backend {
+		server := miniredis.RunT(t)
+		return NewRedisBackend(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	}
+	t.Run("refill", func(t *testing.T) { testRefill(t, backend()) })
+	t.Run("concurrency", func(t *testing.T) { testConcurrency(t, backend()) })
+	t.Run("quota", func(t *testing.T) { testQuota(t, backend()) })
+}
+
+func TestMemoryBackendEvictsIdleBuckets(t *testing.T) {
+	backend := NewMemoryBackend()
+	ctx := context.Background()
+	now := time.Now()
+	rate := Rate{PerMinute: 60, Burst: 100}
+
+	backend.Allow(ctx, "msg:user:once", rate, now)
+	for i := 0; i < 100; i++ {
+		backend.Allow(ctx, "msg:user:busy", rate, now)
+	}
+
+	// A minute on, once has refilled and busy is still refilling
+	backend.Allow(ctx, "msg:user:other", rate, now.Add(bucketSweepInterval))
+	if _, ok := backend.buckets["msg:user:once"]; ok {
+		t.Error("an idle, full bucket was kept")
+	}
+	if _, ok := backend.buckets["msg:user:busy"]; !ok {
+		t.Error("a bucket still refilling was dropped")
+	}
+}
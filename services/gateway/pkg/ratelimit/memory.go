@@ -0,0 +1,142 @@
+// pkg/ratelimit/memory.go
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucketSweepInterval is how often buckets left full by idle users are
+// dropped.
+const bucketSweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled, after which dropping it
+	// is the same as keeping it.
+	full time.Time
+}
+
+type usage struct {
+	total    int64
+	expireAt time.Time
+}
+
+// MemoryBackend keeps limiter state in the process. Limits are enforced per
+// replica.
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	counters  map[string]int
+	usage     map[string]*usage
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]int),
+		usage:    make(map[string]*usage),
+	}
+}
+
+func (m *MemoryBackend) Allow(ctx context.Context, key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= bucketSweepInterval {
+		m.sweepBuckets(now)
+	}
+
+	capacity := rate.capacity()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate.perSecond())
+		b.last = now
+	}
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((capacity - b.tokens) / rate.perSecond() * float64(time.Second)))
+	if allowed {
+		return true, 0, nil
+	}
+
+	wait := (1 - b.tokens) / rate.perSecond()
+	return false, time.Duration(math.Ceil(wait*1000)) * time.Millisecond, nil
+}
+
+// sweepBuckets drops the buckets that have refilled, so users and IPs seen
+// once do not stay in memory for good.
+func (m *MemoryBackend) sweepBuckets(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+func (m *MemoryBackend) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counters[key] >= max {
+		return false, nil
+	}
+	m.counters[key]++
+	return true, nil
+}
+
+func (m *MemoryBackend) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counters[key] <= 1 {
+		delete(m.counters, key)
+		return nil
+	}
+	m.counters[key]--
+	return nil
+}
+
+func (m *MemoryBackend) AddUsage(ctx context.Context, key string, n int64, expireAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for k, u := range m.usage {
+		if now.After(u.expireAt) {
+			delete(m.usage, k)
+		}
+	}
+
+	u, ok := m.usage[key]
+	if !ok {
+		u = &usage{expireAt: expireAt}
+		m.usage[key] = u
+	}
+	u.total += n
+	return u.total, nil
+}
+
+func (m *MemoryBackend) Usage(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.usage[key]; ok && time.Now().Before(u.expireAt) {
+		return u.total, nil
+	}
+	return 0, nil
+}
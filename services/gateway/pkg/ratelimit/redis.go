@@ -0,0 +1,120 @@
+// pkg/ratelimit/redis.go
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "zephyr:ratelimit:"
+
+// tokenBucketScript refills and takes from a bucket atomically. It returns
+// {allowed, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+if now > ts then
+  tokens = math.min(capacity, tokens + (now - ts) * rate)
+  ts = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, retry}
+`)
+
+var acquireScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count > tonumber(ARGV[1]) then
+  redis.call('DECR', KEYS[1])
+  return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var releaseScript = redis.NewScript(`
+local count = redis.call('DECR', KEYS[1])
+if count <= 0 then
+  redis.call('DEL', KEYS[1])
+end
+return count
+`)
+
+// RedisBackend shares limiter state between gateway replicas.
+type RedisBackend struct {
+	client *redis.Client
+}
+
+func NewRedisBackend(client *redis.Client) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+func (r *RedisBackend) Allow(ctx context.Context, key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	perMs := rate.perSecond() / 1000
+	result, err := tokenBucketScript.Run(ctx, r.client, []string{redisKeyPrefix + key},
+		rate.capacity(), perMs, now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("token bucket script failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected token bucket result %v", result)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func (r *RedisBackend) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (bool, error) {
+	acquired, err := acquireScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, max, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("acquire script failed: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+func (r *RedisBackend) Release(ctx context.Context, key string) error {
+	if err := releaseScript.Run(ctx, r.client, []string{redisKeyPrefix + key}).Err(); err != nil {
+		return fmt.Errorf("release script failed: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisBackend) AddUsage(ctx context.Context, key string, n int64, expireAt time.Time) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, redisKeyPrefix+key, n)
+		pipe.ExpireAt(ctx, redisKeyPrefix+key, expireAt)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record usage: %w", err)
+	}
+	return incr.Val(), nil
+}
+
+func (r *RedisBackend) Usage(ctx context.Context, key string) (int64, error) {
+	used, err := r.client.Get(ctx, redisKeyPrefix+key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read usage: %w", err)
+	}
+	return used, nil
+}
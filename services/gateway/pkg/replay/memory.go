@@ -0,0 +1,106 @@
+// pkg/replay/memory.go
+package replay
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryStream struct {
+	frames   []Frame
+	expireAt time.Time
+	// changed is closed and replaced by every append.
+	changed chan struct{}
+}
+
+// MemoryBuffer keeps streams in the process, so a client can only resume
+// on the replica that ran its generation.
+type MemoryBuffer struct {
+	retention time.Duration
+	maxFrames int
+
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+}
+
+// NewMemoryBuffer keeps up to maxFrames frames per stream, for retention
+// after its last frame. A maxFrames of zero keeps every frame.
+func NewMemoryBuffer(retention time.Duration, maxFrames int) *MemoryBuffer {
+	return &MemoryBuffer{retention: retention, maxFrames: maxFrames, streams: make(map[string]*memoryStream)}
+}
+
+func (m *MemoryBuffer) Append(ctx context.Context, key string, frames ...Frame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	stream, ok := m.streams[key]
+	if !ok || now.After(stream.expireAt) || frames[0].Seq == 1 {
+		// Every generation starts a stream, so sweeping here bounds the
+		// expired streams to those of the last retention window
+		m.sweep(now)
+		if ok {
+			close(stream.changed)
+		}
+		stream = &memoryStream{changed: make(chan struct{})}
+		m.streams[key] = stream
+	}
+	stream.frames = append(stream.frames, frames...)
+	if m.maxFrames > 0 && len(stream.frames) > m.maxFrames {
+		stream.frames = append(stream.frames[:0:0], stream.frames[len(stream.frames)-m.maxFrames:]...)
+	}
+	stream.expireAt = now.Add(m.retention)
+	close(stream.changed)
+	stream.changed = make(chan struct{})
+	return nil
+}
+
+func (m *MemoryBuffer) sweep(now time.Time) {
+	for key, stream := range m.streams {
+		if now.After(stream.expireAt) {
+			delete(m.streams, key)
+		}
+	}
+}
+
+func (m *MemoryBuffer) Read(ctx context.Context, key string, after int64, wait time.Duration) ([]Frame, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		frames, changed, err := m.read(key, after)
+		if err != nil || len(frames) > 0 {
+			return frames, err
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// read returns the frames after seq, or a channel closed once more arrive.
+func (m *MemoryBuffer) read(key string, after int64) ([]Frame, <-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, ok := m.streams[key]
+	if !ok || time.Now().After(stream.expireAt) {
+		return nil, nil, ErrNotFound
+	}
+	if stream.frames[0].Seq > after+1 {
+		return nil, nil, ErrTruncated
+	}
+	for i, frame := range stream.frames {
+		if frame.Seq > after {
+			return append([]Frame(nil), stream.frames[i:]...), nil, nil
+		}
+	}
+	return nil, stream.changed, nil
+}
@@ -0,0 +1,107 @@
+// pkg/replay/redis.go
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "zephyr:replay:"
+
+// redisPollInterval is how often a waiting reader checks for new frames.
+const redisPollInterval = 50 * time.Millisecond
+
+// RedisBuffer keeps each stream in a sorted set scored by seq, so a client
+// can resume on any replica.
+type RedisBuffer struct {
+	client    *redis.Client
+	retention time.Duration
+	maxFrames int
+}
+
+// NewRedisBuffer keeps up to maxFrames frames per stream, for retention
+// after its last frame. A maxFrames of zero keeps every frame.
+func NewRedisBuffer(client *redis.Client, retention time.Duration, maxFrames int) *RedisBuffer {
+	return &RedisBuffer{client: client, retention: retention, maxFrames: maxFrames}
+}
+
+func (r *RedisBuffer) Append(ctx context.Context, key string, frames ...Frame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	members := make([]redis.Z, len(frames))
+	for i, frame := range frames {
+		data, err := json.Marshal(frame)
+		if err != nil {
+			return fmt.Errorf("failed to encode frame: %w", err)
+		}
+		members[i] = redis.Z{Score: float64(frame.Seq), Member: data}
+	}
+	key = redisKeyPrefix + key
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if frames[0].Seq == 1 {
+			pipe.Del(ctx, key)
+		}
+		pipe.ZAdd(ctx, key, members...)
+		if r.maxFrames > 0 {
+			pipe.ZRemRangeByRank(ctx, key, 0, int64(-r.maxFrames-1))
+		}
+		pipe.PExpire(ctx, key, r.retention)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to buffer frames %d-%d: %w", frames[0].Seq, frames[len(frames)-1].Seq, err)
+	}
+	return nil
+}
+
+func (r *RedisBuffer) Read(ctx context.Context, key string, after int64, wait time.Duration) ([]Frame, error) {
+	deadline := time.Now().Add(wait)
+	ticker := time.NewTicker(redisPollInterval)
+	defer ticker.Stop()
+	for {
+		frames, err := r.read(ctx, redisKeyPrefix+key, after)
+		if err != nil || len(frames) > 0 || !time.Now().Before(deadline) {
+			return frames, err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (r *RedisBuffer) read(ctx context.Context, key string, after int64) ([]Frame, error) {
+	var first *redis.ZSliceCmd
+	var rest *redis.StringSliceCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		first = pipe.ZRangeWithScores(ctx, key, 0, 0)
+		rest = pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + strconv.FormatInt(after, 10), Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buffered stream: %w", err)
+	}
+	if len(first.Val()) == 0 {
+		return nil, ErrNotFound
+	}
+	if int64(first.Val()[0].Score) > after+1 {
+		return nil, ErrTruncated
+	}
+
+	frames := make([]Frame, 0, len(rest.Val()))
+	for _, value := range rest.Val() {
+		var frame Frame
+		if err := json.Unmarshal([]byte(value), &frame); err != nil {
+			return nil, fmt.Errorf("failed to decode buffered frame: %w", err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
@@ -0,0 +1,39 @@
+// pkg/replay/replay.go
+package replay
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for a stream that was never buffered or whose
+	// retention window has passed.
+	ErrNotFound = errors.New("no buffered stream")
+	// ErrTruncated is returned when frames a reader asked for were already
+	// dropped to keep the stream within its frame limit.
+	ErrTruncated = errors.New("buffered stream no longer holds the requested frames")
+)
+
+// Frame is one sequence-numbered frame of a generation, encoded by the
+// caller. Final marks the last frame a generation sends.
+type Frame struct {
+	Seq   int64  `json:"seq"`
+	Data  []byte `json:"data"`
+	Final bool   `json:"final,omitempty"`
+}
+
+// Buffer keeps the most recent frames of each generation for a while after
+// the last one, so clients that lose their connection mid-answer can catch
+// up on what they missed. Streams are identified by an opaque key.
+type Buffer interface {
+	// Append adds frames to a stream. Frames must be appended in seq
+	// order. A frame with seq 1 starts a new generation, replacing any
+	// earlier stream under the same key.
+	Append(ctx context.Context, key string, frames ...Frame) error
+	// Read returns the frames of a stream after seq, oldest first. If there
+	// are none yet it waits up to wait for one, returning none if nothing
+	// arrived.
+	Read(ctx context.Context, key string, after int64, wait time.Duration) ([]Frame, error)
+}
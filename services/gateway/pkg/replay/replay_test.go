@@ -0,0 +1,69 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testBuffer(t *testing.T, buffer Buffer, expire func()) {
+	t.Helper()
+	ctx := context.Background()
+	for seq := int64(1); seq <= 5; seq++ {
+		if err := buffer.Append(ctx, "u\x00m1", Frame{Seq: seq, Data: []byte{byte('a' + seq - 1)}, Final: seq == 5}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	frames, err := buffer.Read(ctx, "u\x00m1", 2, 0)
+	if err != nil || len(frames) != 3 || frames[0].Seq != 3 || string(frames[0].Data) != "c" || !frames[2].Final {
+		t.Fatalf("Read after 2 = %+v, %v", frames, err)
+	}
+	if _, err := buffer.Read(ctx, "u\x00m1", 0, 0); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Read of dropped frames = %v, want ErrTruncated", err)
+	}
+	if _, err := buffer.Read(ctx, "u\x00other", 0, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of unknown stream = %v, want ErrNotFound", err)
+	}
+
+	// A reader that caught up waits for the next frame
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		buffer.Append(ctx, "u\x00m1", Frame{Seq: 6, Data: []byte("f")})
+	}()
+	frames, err = buffer.Read(ctx, "u\x00m1", 5, 5*time.Second)
+	if err != nil || len(frames) != 1 || frames[0].Seq != 6 {
+		t.Errorf("waiting Read = %+v, %v", frames, err)
+	}
+	if frames, err := buffer.Read(ctx, "u\x00m1", 6, 10*time.Millisecond); err != nil || len(frames) != 0 {
+		t.Errorf("Read past the end = %+v, %v", frames, err)
+	}
+
+	// A new generation with the same key replaces the stream
+	if err := buffer.Append(ctx, "u\x00m1", Frame{Seq: 1, Data: []byte("x")}, Frame{Seq: 2, Data: []byte("y")}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	frames, err = buffer.Read(ctx, "u\x00m1", 0, 0)
+	if err != nil || len(frames) != 2 || string(frames[0].Data) != "x" || frames[1].Seq != 2 {
+		t.Errorf("Read of the new generation = %+v, %v", frames, err)
+	}
+
+	expire()
+	if _, err := buffer.Read(ctx, "u\x00m1", 5, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after retention = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryBuffer(t *testing.T) {
+	testBuffer(t, NewMemoryBuffer(200*time.Millisecond, 4), func() { time.Sleep(250 * time.Millisecond) })
+}
+
+func TestRedisBuffer(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	testBuffer(t, NewRedisBuffer(client, time.Minute, 4), func() { server.FastForward(2 * time.Minute) })
+}
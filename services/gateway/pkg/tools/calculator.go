@@ -0,0 +1,389 @@
+// pkg/tools/calculator.go
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// Limits that keep a hostile expression from costing more than a parse.
+const (
+	maxExpressionLength = 500
+	maxExpressionDepth  = 64
+)
+
+// Calculator evaluates arithmetic expressions so models do not have to do
+// arithmetic in their heads, and converts between units. Expressions are
+// parsed by a small grammar of numbers, operators and math functions;
+// nothing is ever executed.
+type Calculator struct{}
+
+func (Calculator) Declaration() llm.FunctionDeclaration {
+	return llm.FunctionDeclaration{
+		Name: "calculator",
+		Description: "Evaluates an arithmetic expression and optionally converts the result between units. " +
+			"Supports + - * / % ^, parentheses, the constants pi and e, and the functions " +
+			"sqrt, cbrt, abs, exp, ln, log10, log2, sin, cos, tan, asin, acos, atan (radians), " +
+			"floor, ceil, round, min, max and pow. Use it for any arithmetic instead of computing by hand.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"expression": map[string]any{
+					"type":        "string",
+					"description": "The expression to evaluate, e.g. \"9.81 * 2.5^2 / 2\".",
+				},
+				"from_unit": map[string]any{
+					"type":        "string",
+					"description": "Unit of the expression's value, e.g. \"km\", \"degF\", \"eV\". Requires to_unit.",
+				},
+				"to_unit": map[string]any{
+					"type":        "string",
+					"description": "Unit to convert the value to. Must measure the same quantity as from_unit.",
+				},
+			},
+			"required": []string{"expression"},
+		},
+	}
+}
+
+type calculatorArgs struct {
+	Expression string `json:"expression"`
+	FromUnit   string `json:"from_unit"`
+	ToUnit     string `json:"to_unit"`
+}
+
+// CalculatorResult is the calculator's answer. Unit is set for conversions.
+type CalculatorResult struct {
+	Result float64 `json:"result"`
+	Unit   string  `json:"unit,omitempty"`
+}
+
+func (Calculator) Call(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args calculatorArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	value, err := Evaluate(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	if args.FromUnit == "" && args.ToUnit == "" {
+		return CalculatorResult{Result: value}, nil
+	}
+	if args.FromUnit == "" || args.ToUnit == "" {
+		return nil, fmt.Errorf("from_unit and to_unit must be given together")
+	}
+	converted, err := ConvertUnit(value, args.FromUnit, args.ToUnit)
+	if err != nil {
+		return nil, err
+	}
+	return CalculatorResult{Result: converted, Unit: args.ToUnit}, nil
+}
+
+// Evaluate computes the value of an arithmetic expression. ^ binds tighter
+// than unary minus and is right associative, so -2^2 is -4 and 2^3^2 is
+// 512.
+func Evaluate(expression string) (float64, error) {
+	if strings.TrimSpace(expression) == "" {
+		return 0, fmt.Errorf("expression is empty")
+	}
+	if len(expression) > maxExpressionLength {
+		return 0, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	p := &parser{input: expression}
+	value, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+	depth int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips spaces and then token if it comes next.
+func (p *parser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// expression = term { ("+" | "-") term }
+func (p *parser) expression() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return 0, p.errorf("expression is nested too deeply")
+	}
+
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.consume("+"):
+			rhs, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value += rhs
+		case p.consume("-"):
+			rhs, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value -= rhs
+		default:
+			return value, nil
+		}
+	}
+}
+
+// term = unary { ("*" | "/" | "%") unary }
+func (p *parser) term() (float64, error) {
+	value, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var op string
+		for _, candidate := range []string{"*", "/", "%"} {
+			if p.consume(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return value, nil
+		}
+		rhs, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "*":
+			value *= rhs
+		case "/":
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value /= rhs
+		case "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("modulo by zero")
+			}
+			value = math.Mod(value, rhs)
+		}
+	}
+}
+
+// unary = ("-" | "+") unary | power
+func (p *parser) unary() (float64, error) {
+	if p.consume("-") {
+		value, err := p.unary()
+		return -value, err
+	}
+	if p.consume("+") {
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power = primary [ ("^" | "**") unary ]
+func (p *parser) power() (float64, error) {
+	base, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.consume("^") || p.consume("**") {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxExpressionDepth {
+			return 0, p.errorf("expression is nested too deeply")
+		}
+		exponent, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exponent), nil
+	}
+	return base, nil
+}
+
+// primary = number | constant | function "(" arguments ")" | "(" expression ")"
+func (p *parser) primary() (float64, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0, p.errorf("expression ends too early")
+	}
+	if p.consume("(") {
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if !p.consume(")") {
+			return 0, p.errorf("missing )")
+		}
+		return value, nil
+	}
+
+	c := p.input[p.pos]
+	if c == '.' || (c >= '0' && c <= '9') {
+		return p.number()
+	}
+	if unicode.IsLetter(rune(c)) {
+		return p.identifier()
+	}
+	return 0, p.errorf("unexpected %q", string(c))
+}
+
+func (p *parser) number() (float64, error) {
+	start := p.pos
+	digits := func() {
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+	}
+	digits()
+	if p.pos < len(p.input) && p.input[p.pos] == '.' {
+		p.pos++
+		digits()
+	}
+	// An exponent only counts if digits follow it
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		mark := p.pos
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		if p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			digits()
+		} else {
+			p.pos = mark
+		}
+	}
+	text := p.input[start:p.pos]
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("invalid number %q", text)
+	}
+	return value, nil
+}
+
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var functions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"cbrt":  math.Cbrt,
+	"abs":   math.Abs,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log10": math.Log10,
+	"log2":  math.Log2,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+func (p *parser) identifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+
+	if !p.consume("(") {
+		if value, ok := constants[name]; ok {
+			return value, nil
+		}
+		p.pos = start
+		return 0, p.errorf("unknown name %q", name)
+	}
+
+	var args []float64
+	if !p.consume(")") {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, arg)
+			if p.consume(")") {
+				break
+			}
+			if !p.consume(",") {
+				return 0, p.errorf("expected , or ) in arguments of %s", name)
+			}
+		}
+	}
+
+	if fn, ok := functions[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s takes 1 argument, got %d", name, len(args))
+		}
+		return fn(args[0]), nil
+	}
+	switch name {
+	case "pow":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("pow takes 2 arguments, got %d", len(args))
+		}
+		return math.Pow(args[0], args[1]), nil
+	case "min", "max":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("%s needs at least 1 argument", name)
+		}
+		value := args[0]
+		for _, arg := range args[1:] {
+			if name == "min" {
+				value = math.Min(value, arg)
+			} else {
+				value = math.Max(value, arg)
+			}
+		}
+		return value, nil
+	}
+	return 0, fmt.Errorf("unknown function %q", name)
+}
@@ -0,0 +1,76 @@
+// pkg/tools/datetime.go
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	// The runtime image has no zoneinfo, so embed it
+	_ "time/tzdata"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// DateTime tells the model the current date and time, which it otherwise
+// only knows up to its training cutoff.
+type DateTime struct {
+	// Now returns the current time. Nil means time.Now.
+	Now func() time.Time
+}
+
+func (DateTime) Declaration() llm.FunctionDeclaration {
+	return llm.FunctionDeclaration{
+		Name:        "datetime",
+		Description: "Returns the current date, time and weekday. Use it whenever the answer depends on today's date or the time.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"timezone": map[string]any{
+					"type":        "string",
+					"description": "IANA time zone such as \"America/New_York\". Defaults to UTC.",
+				},
+			},
+		},
+	}
+}
+
+// DateTimeResult is the current time in the requested zone.
+type DateTimeResult struct {
+	ISO8601  string `json:"iso8601"`
+	Date     string `json:"date"`
+	Time     string `json:"time"`
+	Weekday  string `json:"weekday"`
+	Timezone string `json:"timezone"`
+	Unix     int64  `json:"unix"`
+}
+
+func (d DateTime) Call(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Timezone == "" {
+		args.Timezone = "UTC"
+	}
+	location, err := time.LoadLocation(args.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q, use an IANA name such as Europe/London", args.Timezone)
+	}
+
+	now := time.Now
+	if d.Now != nil {
+		now = d.Now
+	}
+	t := now().In(location)
+	return DateTimeResult{
+		ISO8601:  t.Format(time.RFC3339),
+		Date:     t.Format("2006-01-02"),
+		Time:     t.Format("15:04:05"),
+		Weekday:  t.Weekday().String(),
+		Timezone: location.String(),
+		Unix:     t.Unix(),
+	}, nil
+}
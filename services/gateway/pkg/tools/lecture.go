@@ -0,0 +1,72 @@
+// pkg/tools/lecture.go
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/lecture"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+// maxLectureResults caps how many frames the model can ask for, since every
+// frame costs prompt tokens on the next turn.
+const maxLectureResults = 10
+
+// LectureSearch finds frames of processed lecture videos, so the model can
+// point students at the moment a topic was covered.
+type LectureSearch struct {
+	Searcher lecture.Searcher
+}
+
+func (LectureSearch) Declaration() llm.FunctionDeclaration {
+	return llm.FunctionDeclaration{
+		Name: "lecture_search",
+		Description: "Searches the frames of processed lecture videos for slides, board work or scenes matching a description. " +
+			"Returns the best matching frames with their video, timestamp in seconds and any text shown on them.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "What the frame should show, e.g. \"free body diagram of a block on an incline\".",
+				},
+				"video_id": map[string]any{
+					"type":        "string",
+					"description": "Only search this video.",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of frames to return, at most %d.", maxLectureResults),
+				},
+			},
+			"required": []string{"query"},
+		},
+	}
+}
+
+func (l LectureSearch) Call(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		Query   string `json:"query"`
+		VideoID string `json:"video_id"`
+		Limit   int    `json:"limit"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if args.Limit <= 0 {
+		args.Limit = lecture.DefaultSearchLimit
+	}
+	args.Limit = min(args.Limit, maxLectureResults)
+
+	frames, err := l.Searcher.SearchFrames(ctx, lecture.Query{Text: args.Query, VideoID: args.VideoID, Limit: args.Limit})
+	if err != nil {
+		return nil, fmt.Errorf("lecture search failed: %w", err)
+	}
+	return map[string]any{"frames": frames}, nil
+}
@@ -0,0 +1,173 @@
+// pkg/tools/tools.go
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/metrics"
+)
+
+// DefaultTimeout bounds a tool call when neither the tool's registration nor
+// the registry sets a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Tool is a function the gateway runs on a model's behalf during a chat.
+type Tool interface {
+	// Declaration is what the model is told about the tool. Its Name is
+	// the name the tool is registered and called under.
+	Declaration() llm.FunctionDeclaration
+	// Call runs the tool with the arguments the model produced, a JSON
+	// object matching the declared parameters. The result must encode to
+	// JSON. Errors are shown to the model, so they should say what to fix.
+	Call(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+// ErrUnknownTool is returned for calls to a tool that is not registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+type registered struct {
+	tool    Tool
+	timeout time.Duration
+}
+
+// Registry holds the tools models can be offered, each with its own
+// timeout.
+type Registry struct {
+	defaultTimeout time.Duration
+
+	mu    sync.RWMutex
+	tools map[string]registered
+}
+
+// NewRegistry returns an empty registry whose tools time out after
+// defaultTimeout unless registered with their own. Zero means
+// DefaultTimeout.
+func NewRegistry(defaultTimeout time.Duration) *Registry {
+	if defaultTimeout <= 0 {
+		defaultTimeout = DefaultTimeout
+	}
+	return &Registry{defaultTimeout: defaultTimeout, tools: make(map[string]registered)}
+}
+
+// Register adds tool, replacing any tool of the same name. A zero timeout
+// uses the registry default.
+func (r *Registry) Register(tool Tool, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = r.defaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[tool.Declaration().Name] = registered{tool: tool, timeout: timeout}
+}
+
+// Has reports whether a tool is registered under name.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.tools[name]
+	return ok
+}
+
+// Names returns the registered tool names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Declarations returns the declarations of the named tools, skipping names
+// that are not registered.
+func (r *Registry) Declarations(names []string) []llm.FunctionDeclaration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var declarations []llm.FunctionDeclaration
+	for _, name := range names {
+		if entry, ok := r.tools[name]; ok {
+			declarations = append(declarations, entry.tool.Declaration())
+		}
+	}
+	return declarations
+}
+
+// Call runs a function call under the tool's timeout. The call is
+// abandoned when the timeout passes even if the tool ignores its context,
+// and a panicking tool is reported as an error rather than taking the
+// gateway down.
+func (r *Registry) Call(ctx context.Context, call llm.FunctionCall) (any, error) {
+	r.mu.RLock()
+	entry, ok := r.tools[call.Name]
+	r.mu.RUnlock()
+	if !ok {
+		metrics.ToolCalls.WithLabelValues("unknown", "unknown").Inc()
+		return nil, fmt.Errorf("%w %q", ErrUnknownTool, call.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, entry.timeout)
+	defer cancel()
+
+	args := call.Args
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	type outcome struct {
+		result any
+		err    error
+	}
+	done := make(chan outcome, 1)
+	started := time.Now()
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Tool %s panicked: %v", call.Name, p)
+				done <- outcome{err: fmt.Errorf("tool %s failed", call.Name)}
+			}
+		}()
+		result, err := entry.tool.Call(ctx, args)
+		done <- outcome{result, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+	metrics.ToolDuration.WithLabelValues(call.Name).Observe(time.Since(started).Seconds())
+
+	label := "ok"
+	switch {
+	case errors.Is(out.err, context.DeadlineExceeded) && ctx.Err() != nil:
+		label = "timeout"
+		out = outcome{err: fmt.Errorf("tool %s timed out after %v", call.Name, entry.timeout)}
+	case out.err != nil:
+		label = "error"
+	}
+	metrics.ToolCalls.WithLabelValues(call.Name, label).Inc()
+	return out.result, out.err
+}
+
+// decodeArgs unmarshals args into v, rejecting unknown fields so the model
+// learns about misspelled parameters.
+func decodeArgs(args json.RawMessage, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/zephyr-v2/services/gateway/pkg/llm"
+)
+
+func TestEvaluate(t *testing.T) {
+	cases := map[string]float64{
+		"1 + 2 * 3":           7,
+		"(1 + 2) * 3":         9,
+		"-2^2":                -4,
+		"2^3^2":               512,
+		"2**10":               1024,
+		"10 % 4":              2,
+		"1.5e3 / 3":           500,
+		"sqrt(16) + abs(-2)":  6,
+		"max(1, 7, 3)":        7,
+		"pow(2, 0.5)^2":       2,
+		"2 * pi":              2 * math.Pi,
+		"round(9.81 * 2.5^2)": 61,
+	}
+	for expression, want := range cases {
+		got, err := Evaluate(expression)
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", expression, err)
+			continue
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", expression, got, want)
+		}
+	}
+
+	for _, expression := range []string{"", "1 +", "1 / 0", "sqrt(-1)", "foo(1)", "2 3", "os.exit(1)", strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100)} {
+		if _, err := Evaluate(expression); err == nil {
+			t.Errorf("Evaluate(%q) succeeded, want an error", expression)
+		}
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	cases := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{100, "degC", "degF", 212},
+		{0, "K", "celsius", -273.15},
+		{1, "mile", "km", 1.609344},
+		{1, "kWh", "J", 3.6e6},
+		{180, "degrees", "rad", math.Pi},
+	}
+	for _, c := range cases {
+		got, err := ConvertUnit(c.value, c.from, c.to)
+		if err != nil {
+			t.Errorf("ConvertUnit(%v, %s, %s): %v", c.value, c.from, c.to, err)
+			continue
+		}
+		if math.Abs(got-c.want) > 1e-9*math.Max(1, math.Abs(c.want)) {
+			t.Errorf("ConvertUnit(%v, %s, %s) = %v, want %v", c.value, c.from, c.to, got, c.want)
+		}
+	}
+
+	if _, err := ConvertUnit(1, "kg", "m"); err == nil {
+		t.Errorf("converting mass to length succeeded")
+	}
+}
+
+// stallingTool ignores its context and never returns on its own.
+type stallingTool struct{ release chan struct{} }
+
+func (stallingTool) Declaration() llm.FunctionDeclaration {
+	return llm.FunctionDeclaration{Name: "stall"}
+}
+
+func (s stallingTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	<-s.release
+	return "late", nil
+}
+
+func TestRegistryCallTimesOut(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	tool := stallingTool{release: make(chan struct{})}
+	defer close(tool.release)
+	registry.Register(tool, 20*time.Millisecond)
+
+	started := time.Now()
+	_, err := registry.Call(context.Background(), llm.FunctionCall{Name: "stall"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Call error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("Call returned after %v, want the 20ms tool timeout", elapsed)
+	}
+
+	if _, err := registry.Call(context.Background(), llm.FunctionCall{Name: "missing"}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("unknown tool error = %v", err)
+	}
+}
+
+func TestCalculatorRejectsUnknownArguments(t *testing.T) {
+	_, err := Calculator{}.Call(context.Background(), json.RawMessage(`{"expr": "1+1"}`))
+	if err == nil || !strings.Contains(err.Error(), "expr") {
+		t.Errorf("Call error = %v, want the unknown field named", err)
+	}
+
+	result, err := Calculator{}.Call(context.Background(), json.RawMessage(`{"expression": "3 * 4", "from_unit": "km", "to_unit": "m"}`))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := result.(CalculatorResult); got.Result != 12000 || got.Unit != "m" {
+		t.Errorf("result = %+v", got)
+	}
+}
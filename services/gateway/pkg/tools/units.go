@@ -0,0 +1,117 @@
+// pkg/tools/units.go
+package tools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// unit converts to the base unit of its quantity as value*factor + offset.
+// Only temperatures have an offset.
+type unit struct {
+	quantity string
+	factor   float64
+	offset   float64
+}
+
+// units are keyed by symbol. Symbols are case-sensitive; unitAliases
+// accepts spelled-out names and lower-case spellings of the common ones.
+var units = map[string]unit{
+	// length, in metres
+	"m": {"length", 1, 0}, "km": {"length", 1e3, 0}, "cm": {"length", 1e-2, 0},
+	"mm": {"length", 1e-3, 0}, "um": {"length", 1e-6, 0}, "nm": {"length", 1e-9, 0},
+	"mi": {"length", 1609.344, 0}, "yd": {"length", 0.9144, 0}, "ft": {"length", 0.3048, 0},
+	"in": {"length", 0.0254, 0}, "au": {"length", 1.495978707e11, 0}, "ly": {"length", 9.4607304725808e15, 0},
+
+	// mass, in kilograms
+	"kg": {"mass", 1, 0}, "g": {"mass", 1e-3, 0}, "mg": {"mass", 1e-6, 0},
+	"t": {"mass", 1e3, 0}, "lb": {"mass", 0.45359237, 0}, "oz": {"mass", 0.028349523125, 0},
+
+	// time, in seconds
+	"s": {"time", 1, 0}, "ms": {"time", 1e-3, 0}, "us": {"time", 1e-6, 0},
+	"min": {"time", 60, 0}, "h": {"time", 3600, 0}, "day": {"time", 86400, 0},
+	"week": {"time", 604800, 0}, "year": {"time", 31557600, 0},
+
+	// temperature, in kelvin
+	"K": {"temperature", 1, 0}, "degC": {"temperature", 1, 273.15},
+	"degF": {"temperature", 5.0 / 9, 273.15 - 32*5.0/9},
+
+	// speed, in metres per second
+	"m/s": {"speed", 1, 0}, "km/h": {"speed", 1 / 3.6, 0}, "mph": {"speed", 0.44704, 0},
+	"knot": {"speed", 1852.0 / 3600, 0},
+
+	// energy, in joules
+	"J": {"energy", 1, 0}, "kJ": {"energy", 1e3, 0}, "cal": {"energy", 4.184, 0},
+	"kcal": {"energy", 4184, 0}, "eV": {"energy", 1.602176634e-19, 0}, "kWh": {"energy", 3.6e6, 0},
+
+	// pressure, in pascals
+	"Pa": {"pressure", 1, 0}, "kPa": {"pressure", 1e3, 0}, "bar": {"pressure", 1e5, 0},
+	"atm": {"pressure", 101325, 0}, "psi": {"pressure", 6894.757293168, 0}, "mmHg": {"pressure", 133.322387415, 0},
+
+	// angle, in radians
+	"rad": {"angle", 1, 0}, "deg": {"angle", math.Pi / 180, 0},
+
+	// volume, in cubic metres
+	"m3": {"volume", 1, 0}, "L": {"volume", 1e-3, 0}, "mL": {"volume", 1e-6, 0},
+	"gal": {"volume", 3.785411784e-3, 0},
+
+	// force, in newtons
+	"N": {"force", 1, 0}, "kN": {"force", 1e3, 0}, "lbf": {"force", 4.4482216152605, 0},
+
+	// power, in watts
+	"W": {"power", 1, 0}, "kW": {"power", 1e3, 0}, "hp": {"power", 745.69987158227, 0},
+}
+
+var unitAliases = map[string]string{
+	"meter": "m", "meters": "m", "metre": "m", "metres": "m",
+	"kilometer": "km", "kilometers": "km", "mile": "mi", "miles": "mi",
+	"foot": "ft", "feet": "ft", "inch": "in", "inches": "in",
+	"gram": "g", "grams": "g", "kilogram": "kg", "kilograms": "kg", "pound": "lb", "pounds": "lb",
+	"second": "s", "seconds": "s", "sec": "s", "minute": "min", "minutes": "min",
+	"hour": "h", "hours": "h", "hr": "h", "days": "day", "weeks": "week", "years": "year",
+	"kelvin": "K", "celsius": "degC", "c": "degC", "°c": "degC", "fahrenheit": "degF", "f": "degF", "°f": "degF",
+	"joule": "J", "joules": "J", "j": "J", "calorie": "cal", "calories": "cal", "ev": "eV",
+	"pascal": "Pa", "pa": "Pa", "kpa": "kPa", "mmhg": "mmHg",
+	"radian": "rad", "radians": "rad", "degree": "deg", "degrees": "deg", "°": "deg",
+	"liter": "L", "liters": "L", "litre": "L", "litres": "L", "l": "L", "ml": "mL", "gallon": "gal", "gallons": "gal",
+	"newton": "N", "newtons": "N", "n": "N", "watt": "W", "watts": "W", "w": "W", "kw": "kW", "kwh": "kWh",
+}
+
+func lookupUnit(name string) (unit, error) {
+	name = strings.TrimSpace(name)
+	if u, ok := units[name]; ok {
+		return u, nil
+	}
+	if symbol, ok := unitAliases[strings.ToLower(name)]; ok {
+		return units[symbol], nil
+	}
+	return unit{}, fmt.Errorf("unknown unit %q; known units are %s", name, strings.Join(unitSymbols(), ", "))
+}
+
+func unitSymbols() []string {
+	symbols := make([]string, 0, len(units))
+	for symbol := range units {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// ConvertUnit converts value from one unit to another of the same quantity.
+func ConvertUnit(value float64, from, to string) (float64, error) {
+	fromUnit, err := lookupUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toUnit, err := lookupUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	if fromUnit.quantity != toUnit.quantity {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, fromUnit.quantity, to, toUnit.quantity)
+	}
+	base := value*fromUnit.factor + fromUnit.offset
+	return (base - toUnit.offset) / toUnit.factor, nil
+}
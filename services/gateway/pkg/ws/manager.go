@@ -2,36 +2,292 @@
 package ws
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"golang.org/x/net/websocket"
+	"github.com/gorilla/websocket"
 )
 
+// closeTimeout bounds how long sending a close frame may block.
+const closeTimeout = time.Second
+
+var (
+	// ErrIdleTimeout is returned by ReadMessage when nothing, not even a
+	// pong, arrived within the idle timeout.
+	ErrIdleTimeout = errors.New("connection idle timeout")
+	// ErrPingFailed is returned by ReadMessage after a keepalive ping could
+	// not be written within the write timeout.
+	ErrPingFailed = errors.New("keepalive ping failed")
+)
+
+// Timeouts configure keepalive pings and deadlines for a connection. Zero
+// values disable the corresponding behaviour.
+type Timeouts struct {
+	// PingInterval is how often the server pings the client.
+	PingInterval time.Duration
+	// IdleTimeout is how long the connection may go without receiving a
+	// message or pong before it is reaped. It must exceed PingInterval.
+	IdleTimeout time.Duration
+	// WriteTimeout bounds every frame written, including pings.
+	WriteTimeout time.Duration
+}
+
 type Connection struct {
 	Conn *websocket.Conn
-	mu   sync.Mutex
+	// OnShutdown is called once when the server begins shutting down. It
+	// should stop new work, let running work finish and then Close the
+	// connection. reconnectAfter is a hint to pass on to the client.
+	OnShutdown func(reconnectAfter time.Duration)
+
+	timeouts  Timeouts
+	closeOnce sync.Once
+	done      chan struct{}
+	pingErr   atomic.Pointer[error]
+}
+
+// NewConnection wraps conn and starts pinging the client. Close must be
+// called to stop the pings.
+func NewConnection(conn *websocket.Conn, timeouts Timeouts) *Connection {
+	c := &Connection{Conn: conn, timeouts: timeouts, done: make(chan struct{})}
+
+	c.extendReadDeadline()
+	conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+	if timeouts.PingInterval > 0 {
+		go c.keepAlive()
+	}
+	return c
+}
+
+func (c *Connection) extendReadDeadline() {
+	if c.timeouts.IdleTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeouts.IdleTimeout))
+	}
+}
+
+func (c *Connection) writeDeadline() time.Time {
+	if c.timeouts.WriteTimeout > 0 {
+		return time.Now().Add(c.timeouts.WriteTimeout)
+	}
+	return time.Time{}
+}
+
+func (c *Connection) keepAlive() {
+	ticker := time.NewTicker(c.timeouts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, c.writeDeadline()); err != nil {
+				// A peer that stopped reading fills the socket buffers; give
+				// up on it and let the blocked reader fail.
+				c.pingErr.Store(&err)
+				c.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// WriteJSON writes v as a single frame within the write timeout. Like the
+// underlying connection it supports only one writer at a time.
+func (c *Connection) WriteJSON(v interface{}) error {
+	c.Conn.SetWriteDeadline(c.writeDeadline())
+	return c.Conn.WriteJSON(v)
+}
+
+// ReadMessage reads the next data message and extends the idle deadline.
+// Connections that went silent fail with ErrIdleTimeout or ErrPingFailed.
+func (c *Connection) ReadMessage() ([]byte, error) {
+	_, data, err := c.Conn.ReadMessage()
+	if err == nil {
+		c.extendReadDeadline()
+		return data, nil
+	}
+
+	if pingErr := c.pingErr.Load(); pingErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPingFailed, *pingErr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, fmt.Errorf("%w after %v", ErrIdleTimeout, c.timeouts.IdleTimeout)
+	}
+	return nil, err
+}
+
+// IsReaped reports whether err from ReadMessage means the client went
+// silent rather than closing the connection.
+func IsReaped(err error) bool {
+	return errors.Is(err, ErrIdleTimeout) || errors.Is(err, ErrPingFailed)
+}
+
+// Close sends a close frame with code and reason, stops the pings and
+// closes the underlying connection, which also ends its read loop. Only
+// the first call has any effect.
+func (c *Connection) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		msg := websocket.FormatCloseMessage(code, reason)
+		err := c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+		if err != nil && !errors.Is(err, websocket.ErrCloseSent) && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to send close frame: %v", err)
+		}
+		c.Conn.Close()
+	})
+}
+
+// ConnectionStats counts connections since the manager was created.
+type ConnectionStats struct {
+	Active int64
+	Opened int64
+	Closed int64
+	// Reaped connections are the closed ones whose client went silent.
+	Reaped int64
 }
 
 type ConnectionManager struct {
-	connections sync.Map
+	connections  sync.Map
+	shuttingDown atomic.Bool
+
+	opened atomic.Int64
+	closed atomic.Int64
+	reaped atomic.Int64
 }
 
 func NewConnectionManager() *ConnectionManager {
 	return &ConnectionManager{}
 }
 
-func (m *ConnectionManager) Add(conn *Connection) {
+// Add tracks conn. It returns false once shutdown has begun, in which case
+// the caller should close the connection instead of serving it.
+func (m *ConnectionManager) Add(conn *Connection) bool {
+	if m.shuttingDown.Load() {
+		return false
+	}
 	m.connections.Store(conn, struct{}{})
+	// Shutdown may have started between the check and the store; it would
+	// not have seen conn, so back out.
+	if m.shuttingDown.Load() {
+		m.connections.Delete(conn)
+		return false
+	}
+	m.opened.Add(1)
+	return true
 }
 
+// Remove stops tracking conn. It may be called more than once.
 func (m *ConnectionManager) Remove(conn *Connection) {
-	m.connections.Delete(conn)
+	if _, ok := m.connections.LoadAndDelete(conn); ok {
+		m.closed.Add(1)
+	}
+}
+
+// Reap closes a connection whose client went silent and records it as
+// reaped. err is the ReadMessage error that detected it.
+func (m *ConnectionManager) Reap(conn *Connection, err error) {
+	if _, ok := m.connections.LoadAndDelete(conn); ok {
+		m.closed.Add(1)
+		m.reaped.Add(1)
+	}
+	log.Printf("Reaped connection from %s: %v", conn.Conn.RemoteAddr(), err)
+	conn.Close(websocket.CloseGoingAway, "idle timeout")
+}
+
+// Stats returns connection churn counters.
+func (m *ConnectionManager) Stats() ConnectionStats {
+	return ConnectionStats{
+		Active: int64(m.Count()),
+		Opened: m.opened.Load(),
+		Closed: m.closed.Load(),
+		Reaped: m.reaped.Load(),
+	}
+}
+
+// LogStats logs the churn counters every interval while they change, until
+// ctx is done.
+func (m *ConnectionManager) LogStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last ConnectionStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if stats := m.Stats(); stats != last {
+				log.Printf("Connections: %d active, %d opened, %d closed, %d reaped",
+					stats.Active, stats.Opened, stats.Closed, stats.Reaped)
+				last = stats
+			}
+		}
+	}
+}
+
+// Count returns the number of tracked connections.
+func (m *ConnectionManager) Count() int {
+	count := 0
+	m.connections.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func (m *ConnectionManager) ShuttingDown() bool {
+	return m.shuttingDown.Load()
+}
+
+// Shutdown stops accepting connections and calls OnShutdown on every
+// tracked connection, each with a random reconnect hint of up to
+// reconnectDelay so clients do not all reconnect at once. It waits for the
+// connections to close themselves and closes any left when ctx is done.
+func (m *ConnectionManager) Shutdown(ctx context.Context, reconnectDelay time.Duration) error {
+	m.shuttingDown.Store(true)
+
+	m.connections.Range(func(key, value interface{}) bool {
+		if conn, ok := key.(*Connection); ok && conn.OnShutdown != nil {
+			var hint time.Duration
+			if reconnectDelay > 0 {
+				hint = time.Duration(rand.Int63n(int64(reconnectDelay)))
+			}
+			conn.OnShutdown(hint)
+		}
+		return true
+	})
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for m.Count() > 0 {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutdown deadline reached, closing %d connections", m.Count())
+			m.CloseAll(websocket.CloseGoingAway, "server shutting down")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
 
-func (m *ConnectionManager) CloseAll() {
+// CloseAll sends every tracked connection a close frame and closes it.
+func (m *ConnectionManager) CloseAll(code int, reason string) {
 	m.connections.Range(func(key, value interface{}) bool {
 		if conn, ok := key.(*Connection); ok {
-			conn.Conn.Close()
+			conn.Close(code, reason)
 		}
 		return true
 	})
@@ -0,0 +1,205 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dial opens a connection to a test server and returns both ends: the
+// server's, wrapped with timeouts, and the client's.
+func dial(t *testing.T, timeouts Timeouts) (*Connection, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *Connection, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		accepted <- NewConnection(conn, timeouts)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-accepted
+	t.Cleanup(func() { conn.Close(websocket.CloseNormalClosure, "") })
+	return conn, client
+}
+
+// readClose reads from client until the server's close frame and returns
+// its code.
+func readClose(t *testing.T, client *websocket.Conn) int {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := client.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("read %v, want a close frame", err)
+			}
+			return closeErr.Code
+		}
+	}
+}
+
+func TestPingsKeepReadingClientAlive(t *testing.T) {
+	conn, client := dial(t, Timeouts{PingInterval: 20 * time.Millisecond, IdleTimeout: 60 * time.Millisecond, WriteTimeout: time.Second})
+
+	var pings atomic.Int32
+	client.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return client.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		// Reading runs the ping handler
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		client.WriteMessage(websocket.TextMessage, []byte("still here"))
+	}()
+
+	// Pongs extend the idle deadline well past IdleTimeout
+	data, err := conn.ReadMessage()
+	if err != nil || string(data) != "still here" {
+		t.Fatalf("ReadMessage = %q, %v", data, err)
+	}
+	if n := pings.Load(); n < 5 {
+		t.Errorf("client got %d pings in 200ms, want one every 20ms", n)
+	}
+}
+
+func TestSilentClientIsReaped(t *testing.T) {
+	conn, client := dial(t, Timeouts{PingInterval: 20 * time.Millisecond, IdleTimeout: 60 * time.Millisecond, WriteTimeout: time.Second})
+	manager := NewConnectionManager()
+	manager.Add(conn)
+
+	// The client never reads, so it answers no pings
+	started := time.Now()
+	_, err := conn.ReadMessage()
+	if !IsReaped(err) || !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("ReadMessage = %v, want an idle timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("reaped after %v, want about 60ms", elapsed)
+	}
+
+	manager.Reap(conn, err)
+	if stats := manager.Stats(); stats != (ConnectionStats{Opened: 1, Closed: 1, Reaped: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	// Answering the pings now would fail on the closed socket
+	client.SetPingHandler(func(string) error { return nil })
+	if code := readClose(t, client); code != websocket.CloseGoingAway {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+	// Removing a reaped connection again does not count it twice
+	manager.Remove(conn)
+	if stats := manager.Stats(); stats.Closed != 1 {
+		t.Errorf("closed = %d after a second Remove", stats.Closed)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	conn, _ := dial(t, Timeouts{WriteTimeout: 50 * time.Millisecond})
+
+	// The client reads nothing, so the socket buffers fill and a write
+	// blocks until the timeout
+	frame := strings.Repeat("x", 1<<20)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		err := conn.WriteJSON(frame)
+		if err == nil {
+			continue
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("WriteJSON = %v, want a timeout", err)
+		}
+		return
+	}
+	t.Fatal("writes to a client that reads nothing never timed out")
+}
+
+func TestShutdown(t *testing.T) {
+	manager := NewConnectionManager()
+	polite, politeClient := dial(t, Timeouts{})
+	stubborn, stubbornClient := dial(t, Timeouts{})
+
+	var hint atomic.Int64
+	polite.OnShutdown = func(reconnectAfter time.Duration) {
+		hint.Store(int64(reconnectAfter))
+		go func() {
+			polite.Close(websocket.CloseServiceRestart, "restarting")
+			manager.Remove(polite)
+		}()
+	}
+	stubborn.OnShutdown = func(time.Duration) {}
+	for _, conn := range []*Connection{polite, stubborn} {
+		if !manager.Add(conn) {
+			t.Fatal("Add refused a connection before shutdown")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := manager.Shutdown(ctx, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the deadline exceeded by the stubborn connection", err)
+	}
+	if !manager.ShuttingDown() {
+		t.Error("not shutting down")
+	}
+	if h := time.Duration(hint.Load()); h < 0 || h >= time.Second {
+		t.Errorf("reconnect hint %v, want under the reconnect delay", h)
+	}
+	if code := readClose(t, politeClient); code != websocket.CloseServiceRestart {
+		t.Errorf("polite close code = %d", code)
+	}
+	if code := readClose(t, stubbornClient); code != websocket.CloseGoingAway {
+		t.Errorf("stubborn close code = %d, want closed at the deadline", code)
+	}
+
+	late, _ := dial(t, Timeouts{})
+	if manager.Add(late) {
+		t.Error("Add accepted a connection during shutdown")
+	}
+}
+
+func TestShutdownWaitsForConnectionsToClose(t *testing.T) {
+	manager := NewConnectionManager()
+	conn, _ := dial(t, Timeouts{})
+	conn.OnShutdown = func(time.Duration) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			conn.Close(websocket.CloseServiceRestart, "")
+			manager.Remove(conn)
+		}()
+	}
+	manager.Add(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx, 0); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	if stats := manager.Stats(); stats.Active != 0 || stats.Closed != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -10,6 +10,11 @@ import Config
 config :zephyr_backend,
   generators: [timestamp_type: :utc_datetime]
 
+# Go gateway connection pool. Each socket carries many concurrent chats.
+config :zephyr_backend, :go_gateway,
+  url: "ws://localhost:8000/chat",
+  pool_size: 4
+
 # Configures the endpoint
 config :zephyr_backend, ZephyrBackendWeb.Endpoint,
   url: [host: "localhost"],
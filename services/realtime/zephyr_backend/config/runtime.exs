@@ -20,6 +20,14 @@ if System.get_env("PHX_SERVER") do
   config :zephyr_backend, ZephyrBackendWeb.Endpoint, server: true
 end
 
+# Service token presented to the Go gateway, which requires a JWT on /chat.
+if token = System.get_env("ZEPHYR_GATEWAY_TOKEN") do
+  config :zephyr_backend, :go_gateway,
+    url: System.get_env("ZEPHYR_GATEWAY_URL", "ws://localhost:8000/chat"),
+    pool_size: String.to_integer(System.get_env("ZEPHYR_GATEWAY_POOL_SIZE", "4")),
+    token: token
+end
+
 if config_env() == :prod do
   # The secret key base is used to sign/encrypt cookies and other secrets.
   # A default value is used in config/dev.exs and config/test.exs but you
@@ -20,6 +20,9 @@ defmodule ZephyrBackend.Application do
         name: ZephyrBackend.WSConnectionSupervisor
       },
 
+      # Long-lived, multiplexed sockets to the Go gateway
+      ZephyrWeb.GoSocketPool,
+
       # Start the endpoint last
       ZephyrBackendWeb.Endpoint
     ]
@@ -3,33 +3,60 @@ defmodule ZephyrWeb.ChatChannel do
   use Phoenix.Channel
   require Logger
 
-  @go_server_url "ws://localhost:8000/chat"
-
   def join("chat:" <> chat_id, _params, socket) do
     Logger.info("Client joined chat:#{chat_id}")
     {:ok, assign(socket, :chat_id, chat_id)}
   end
 
-  def handle_in("new_message", %{"content" => content}, socket) do
+  def handle_in("new_message", params, socket) do
+    content = Map.get(params, "content", "")
+
     Logger.info("Processing message: #{inspect(content)}")
 
     message_id = "msg_" <> Base.encode16(:crypto.strong_rand_bytes(8), case: :lower)
 
-    case WebSockex.start_link(
-      @go_server_url,
-      ZephyrWeb.GoWebSocket,
-      %{
-        content: content,
-        message_id: message_id,
-        socket: self()
-      }
-    ) do
-      {:ok, pid} ->
-        Process.monitor(pid)
-        {:reply, :ok, assign(socket, :ws_pid, pid)}
+    # The gateway charges rate limits and quotas to metadata.user_id
+    metadata =
+      case socket.assigns[:user_id] do
+        nil -> %{}
+        user_id -> %{user_id: user_id}
+      end
+
+    # Pick a subject assistant; without one the gateway routes by content
+    metadata =
+      case params["assistant"] do
+        assistant when is_binary(assistant) and assistant != "" -> Map.put(metadata, :assistant, assistant)
+        _ -> metadata
+      end
+
+    # Ground the answer in a processed lecture video, optionally one part of it
+    metadata =
+      case params["video_id"] do
+        video_id when is_binary(video_id) and video_id != "" ->
+          metadata
+          |> Map.put(:video_id, video_id)
+          |> put_time_range(params["time_range"])
+
+        _ ->
+          metadata
+      end
+
+    # Files uploaded to the gateway's /v1/uploads, or small ones inline
+    attachments =
+      case params["attachments"] do
+        list when is_list(list) ->
+          for %{} = attachment <- list, do: Map.take(attachment, ["upload_id", "data", "name"])
+
+        _ ->
+          []
+      end
+
+    case ZephyrWeb.GoSocketPool.send_chat(message_id, content, metadata, attachments) do
+      :ok ->
+        {:reply, :ok, socket}
 
       {:error, reason} ->
-        Logger.error("Failed to connect to Go server: #{inspect(reason)}")
+        Logger.error("Failed to send message to Go server: #{inspect(reason)}")
         {:reply, {:error, %{reason: "server_connection_failed"}}, socket}
     end
   end
@@ -43,8 +70,13 @@ defmodule ZephyrWeb.ChatChannel do
     {:noreply, socket}
   end
 
-  def handle_info(:ai_complete, socket) do
-    broadcast!(socket, "ai_complete", %{})
+  def handle_info({:ai_tool, type, tool}, socket) do
+    broadcast!(socket, "ai_" <> type, tool)
+    {:noreply, socket}
+  end
+
+  def handle_info({:ai_complete, citations}, socket) do
+    broadcast!(socket, "ai_complete", %{citations: citations})
     {:noreply, socket}
   end
 
@@ -56,11 +88,14 @@ defmodule ZephyrWeb.ChatChannel do
     {:noreply, socket}
   end
 
-  def handle_info({:DOWN, _ref, :process, pid, reason}, socket) do
-    ws_pid = socket.assigns[:ws_pid]
-    if pid == ws_pid do
-      Logger.info("WebSocket process down: #{inspect(reason)}")
-    end
+  def handle_info(:ai_cancelled, socket) do
+    broadcast!(socket, "ai_cancelled", %{})
     {:noreply, socket}
   end
+
+  defp put_time_range(metadata, %{} = range) do
+    Map.put(metadata, :time_range, Map.take(range, ["start", "end"]))
+  end
+
+  defp put_time_range(metadata, _range), do: metadata
 end
@@ -0,0 +1,97 @@
+defmodule ZephyrWeb.GoSocketPool do
+  @moduledoc """
+  A small pool of long-lived WebSocket connections to the Go gateway.
+
+  The gateway multiplexes concurrent generations on one socket by
+  `message_id`, so each chat message is sent on one of the pooled sockets
+  and the frames for it are routed back to the caller through an ETS table.
+  """
+
+  use Supervisor
+  require Logger
+
+  @routes :go_socket_routes
+
+  def start_link(opts) do
+    Supervisor.start_link(__MODULE__, opts, name: __MODULE__)
+  end
+
+  @impl true
+  def init(opts) do
+    config = Application.get_env(:zephyr_backend, :go_gateway, [])
+    url = Keyword.get(opts, :url, Keyword.get(config, :url, "ws://localhost:8000/chat"))
+    size = Keyword.get(opts, :pool_size, Keyword.get(config, :pool_size, 4))
+    token = Keyword.get(opts, :token, Keyword.get(config, :token))
+
+    :ets.new(@routes, [:named_table, :set, :public, read_concurrency: true])
+    :persistent_term.put({__MODULE__, :size}, size)
+
+    children =
+      for index <- 1..size do
+        {ZephyrWeb.GoWebSocket, {url, index, token}}
+      end
+
+    Supervisor.init(children, strategy: :one_for_one)
+  end
+
+  @doc """
+  Sends a chat message to the gateway, with `attachments` given as maps with
+  either `"upload_id"` or base64 `"data"`, and an optional `"name"`. Frames
+  for `message_id` are delivered
+  to `reply_to` as `{:ai_stream, content}`, `{:ai_tool, type, tool}`,
+  `{:ai_complete, citations}`, `{:ai_error, error}` and `:ai_cancelled`.
+  """
+  def send_chat(message_id, content, metadata \\ %{}, attachments \\ [], reply_to \\ self()) do
+    index = socket_for(message_id)
+    :ets.insert(@routes, {message_id, reply_to, index})
+
+    frame = %{type: "chat", content: content, message_id: message_id, metadata: metadata}
+    frame = if attachments == [], do: frame, else: Map.put(frame, :attachments, attachments)
+
+    case send_frame(index, frame) do
+      :ok ->
+        :ok
+
+      error ->
+        release(message_id)
+        error
+    end
+  end
+
+  @doc "Asks the gateway to stop generating `message_id`."
+  def cancel(message_id) do
+    send_frame(socket_for(message_id), %{type: "cancel", message_id: message_id})
+  end
+
+  @doc false
+  def route(message_id) do
+    case :ets.lookup(@routes, message_id) do
+      [{^message_id, pid, _index}] -> {:ok, pid}
+      [] -> :error
+    end
+  end
+
+  @doc false
+  def release(message_id) do
+    :ets.delete(@routes, message_id)
+    :ok
+  end
+
+  @doc false
+  def release_socket(index) do
+    routes = :ets.match_object(@routes, {:_, :_, index})
+    Enum.each(routes, fn {message_id, _pid, _index} -> release(message_id) end)
+    routes
+  end
+
+  defp socket_for(message_id) do
+    size = :persistent_term.get({__MODULE__, :size})
+    :erlang.phash2(message_id, size) + 1
+  end
+
+  defp send_frame(index, frame) do
+    with {:ok, json} <- Jason.encode(frame) do
+      ZephyrWeb.GoWebSocket.send_json(index, json)
+    end
+  end
+end
@@ -2,28 +2,43 @@ defmodule ZephyrWeb.GoWebSocket do
   use WebSockex
   require Logger
 
-  def start_link(url, state) do
-    Logger.info("Starting WebSocket connection to #{url}")
-    WebSockex.start_link(url, __MODULE__, state)
-  end
+  alias ZephyrWeb.GoSocketPool
 
-  @impl true
-  def handle_connect(_conn, state) do
-    Logger.info("WebSocket connected, sending initial message")
+  @max_backoff 5_000
+  @subprotocol "zephyr.chat.v1"
 
-    message = %{
-      type: "chat",
-      content: state.content,
-      message_id: state.message_id
+  def child_spec({url, index, token}) do
+    %{
+      id: {__MODULE__, index},
+      start: {__MODULE__, :start_link, [url, index, token]}
     }
+  end
 
-    with {:ok, json} <- Jason.encode(message) do
-      {:reply, {:text, json}, state}
-    else
-      error ->
-        Logger.error("Failed to encode message: #{inspect(error)}")
-        {:close, state}
-    end
+  def start_link(url, index, token \\ nil) do
+    Logger.info("Starting WebSocket connection #{index} to #{url}")
+
+    WebSockex.start_link(url, __MODULE__, %{index: index},
+      name: name(index),
+      extra_headers: auth_headers(token),
+      handle_initial_conn_failure: true
+    )
+  end
+
+  defp auth_headers(nil), do: [{"Sec-WebSocket-Protocol", @subprotocol}]
+
+  defp auth_headers(token),
+    do: [{"Sec-WebSocket-Protocol", @subprotocol}, {"Authorization", "Bearer " <> token}]
+
+  def send_json(index, json) do
+    WebSockex.send_frame(name(index), {:text, json})
+  end
+
+  defp name(index), do: Module.concat(__MODULE__, "Conn#{index}")
+
+  @impl true
+  def handle_connect(_conn, state) do
+    Logger.info("WebSocket #{state.index} connected to Go gateway")
+    {:ok, state}
   end
 
   @impl true
@@ -31,17 +46,24 @@ defmodule ZephyrWeb.GoWebSocket do
     Logger.debug("Received frame: #{inspect(msg)}")
 
     case Jason.decode(msg) do
-      {:ok, %{"type" => "token", "content" => content}} ->
-        send(state.socket, {:ai_stream, content})
+      {:ok, %{"message_id" => message_id} = frame} ->
+        case GoSocketPool.route(message_id) do
+          {:ok, pid} -> deliver(pid, message_id, frame)
+          :error -> Logger.debug("No route for message #{message_id}")
+        end
+
         {:ok, state}
 
-      {:ok, %{"type" => "complete"}} ->
-        send(state.socket, :ai_complete)
-        {:close, state}
+      {:ok, %{"type" => "server_shutdown"} = frame} ->
+        # The gateway finishes in-flight answers and then closes the socket;
+        # reconnect after its hint so replicas are not hit all at once.
+        delay = get_in(frame, ["error", "retry_after_ms"]) || 0
+        Logger.info("Go gateway for socket #{state.index} is shutting down, reconnecting in #{delay}ms")
+        {:ok, Map.put(state, :reconnect_after, delay)}
 
-      {:ok, %{"type" => "error", "content" => error}} ->
-        send(state.socket, {:ai_error, error})
-        {:close, state}
+      {:ok, frame} ->
+        Logger.warning("Dropping frame without message_id: #{inspect(frame)}")
+        {:ok, state}
 
       {:error, error} ->
         Logger.error("Failed to decode message: #{inspect(error)}")
@@ -50,14 +72,57 @@ defmodule ZephyrWeb.GoWebSocket do
   end
 
   @impl true
-  def handle_disconnect(%{reason: reason}, state) do
-    Logger.info("WebSocket disconnected: #{inspect(reason)}")
-    {:ok, state}
+  def handle_disconnect(%{reason: reason, attempt_number: attempt}, state) do
+    Logger.info("WebSocket #{state.index} disconnected: #{inspect(reason)}")
+
+    # Generations in flight on this socket were cancelled by the gateway
+    for {_message_id, pid, _index} <- GoSocketPool.release_socket(state.index) do
+      send(pid, {:ai_error, "Connection to AI server lost"})
+    end
+
+    {delay, state} = Map.pop(state, :reconnect_after)
+    Process.sleep(delay || min(attempt * 500, @max_backoff))
+    {:reconnect, state}
   end
 
   @impl true
   def terminate(reason, state) do
-    Logger.info("WebSocket terminated: #{inspect(reason)}")
+    Logger.info("WebSocket #{state.index} terminated: #{inspect(reason)}")
     {:ok, state}
   end
+
+  defp deliver(pid, _message_id, %{"type" => "token", "content" => content}) do
+    send(pid, {:ai_stream, content})
+  end
+
+  defp deliver(pid, _message_id, %{"type" => type, "tool" => tool})
+       when type in ["tool_call", "tool_result"] do
+    send(pid, {:ai_tool, type, tool})
+  end
+
+  defp deliver(pid, message_id, %{"type" => "complete"} = frame) do
+    GoSocketPool.release(message_id)
+    # Lecture answers cite timestamps of the video they were grounded in
+    citations = get_in(frame, ["metadata", "citations"]) || []
+    send(pid, {:ai_complete, citations})
+  end
+
+  defp deliver(pid, message_id, %{"type" => type, "error" => error})
+       when type in ["error", "rate_limited"] do
+    Logger.debug("Gateway error #{error["code"]} (#{error["name"]}) for #{message_id}")
+    GoSocketPool.release(message_id)
+    send(pid, {:ai_error, error["message"]})
+  end
+
+  defp deliver(pid, message_id, %{"type" => "server_shutdown"}) do
+    GoSocketPool.release(message_id)
+    send(pid, {:ai_error, "AI server is restarting, please try again"})
+  end
+
+  defp deliver(pid, message_id, %{"type" => "cancelled"}) do
+    GoSocketPool.release(message_id)
+    send(pid, :ai_cancelled)
+  end
+
+  defp deliver(_pid, _message_id, _frame), do: :ok
 end